@@ -1,10 +1,17 @@
 package cmd
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/gilbe/claude-foundry-manager/internal/backup"
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+	"github.com/gilbe/claude-foundry-manager/internal/ui"
 	"github.com/spf13/cobra"
 )
 
@@ -14,14 +21,34 @@ var backupCmd = &cobra.Command{
 	Long: `Manage configuration backups for Claude Code settings.
 
 Subcommands:
-  list    - List all available backups
-  create  - Create a manual backup
-  restore - Restore from a specific backup
+  list     - List all available backups
+  create   - Create a manual backup
+  restore  - Restore from a specific backup
+  show     - Show the variables and details of a backup
+  diff     - Show what differs between two backups, or a backup and now
+  delete   - Delete a backup
+  settings - Choose how API keys and tokens are kept in backups, and the
+             retention policy for automatic backups
+  prune    - Remove automatic backups the retention policy no longer keeps
+  pin      - Keep a backup forever (unpin to undo)
+
+Backups are named after their time and a hash of their content, e.g.
+backup_20240115_143022_3f9a1c2e.json. Commands take the file name, its ID
+(20240115_143022_3f9a1c2e) or any unique start of the ID, such as
+20240115_1430. An automatic backup identical to the latest backup is not
+made again.
+
+Backups are written to a directory only you can read. With backup settings,
+secrets can also be redacted (only a fingerprint is kept) or encrypted with
+a passphrase or to an age recipient.
 
 Examples:
   claude-foundry-manager backup list
   claude-foundry-manager backup create "My manual backup"
-  claude-foundry-manager backup restore backup_20240115_143022.json`,
+  claude-foundry-manager backup show 20240115_1430
+  claude-foundry-manager backup diff 20240115_1430
+  claude-foundry-manager backup restore 20240115_1430
+  claude-foundry-manager backup prune --dry-run`,
 }
 
 var backupListCmd = &cobra.Command{
@@ -41,14 +68,27 @@ var backupListCmd = &cobra.Command{
 
 		fmt.Printf("\n=== Available Backups (%d total) ===\n\n", len(backups))
 		for i, b := range backups {
-			fmt.Printf("[%d] %s\n", i+1, b.Filename)
+			if b.Problem != "" {
+				fmt.Printf("[%d] %s\n", i+1, b.Filename)
+				fmt.Printf("    Unreadable: %s\n\n", b.Problem)
+				continue
+			}
+			fmt.Printf("[%d] %s%s\n", i+1, b.Filename, backupMarkers(b))
 			fmt.Printf("    Created: %s\n", b.Timestamp.Format("2006-01-02 15:04:05"))
 			fmt.Printf("    Description: %s\n", b.Description)
 			if b.UseFoundry {
 				fmt.Printf("    Resource: %s\n", b.Resource)
+			} else if b.Provider != config.Anthropic.Title() {
+				fmt.Printf("    Provider: %s\n", b.Provider)
 			} else {
 				fmt.Printf("    Resource: (default Anthropic)\n")
 			}
+			if b.Secrets != backup.SecretsPlain {
+				fmt.Printf("    Secrets: %s\n", secretsLabel(b.Secrets))
+			}
+			if len(b.Tags) > 0 {
+				fmt.Printf("    Tags: %s\n", strings.Join(b.Tags, ", "))
+			}
 			fmt.Println()
 		}
 
@@ -57,6 +97,8 @@ var backupListCmd = &cobra.Command{
 	},
 }
 
+var backupTags []string
+
 var backupCreateCmd = &cobra.Command{
 	Use:   "create [description]",
 	Short: "Create a manual backup",
@@ -64,8 +106,16 @@ var backupCreateCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		description := args[0]
 
-		filename, err := backup.CreateManualBackup(description)
+		store, err := openStore()
 		if err != nil {
+			return err
+		}
+
+		filename, err := backup.CreateManualBackup(store, description, backupTags...)
+		var warning *backup.Warning
+		if errors.As(err, &warning) {
+			fmt.Fprintf(os.Stderr, "Warning: Backup created, but %v\n", warning)
+		} else if err != nil {
 			return fmt.Errorf("failed to create backup: %w", err)
 		}
 
@@ -76,20 +126,88 @@ var backupCreateCmd = &cobra.Command{
 }
 
 var backupRestoreCmd = &cobra.Command{
-	Use:   "restore [filename]",
+	Use:   "restore [id]",
 	Short: "Restore from a specific backup",
-	Args:  cobra.ExactArgs(1),
+	Long: `Restore the variables of a backup. The changes are shown first and
+confirmed, unless --yes is given; --dry-run only shows them.
+
+With --only, only some variables are restored and the others are kept as
+they are. It takes groups (models, endpoint, auth) and variable names:
+  models    model overrides, e.g. ANTHROPIC_DEFAULT_SONNET_MODEL
+  endpoint  provider switches, resources, base URLs and regions
+  auth      API keys, tokens and AWS_PROFILE
+
+With --files, the shell profiles, env files and settings files snapshotted
+in the backup (see backup settings --file-snapshots) are put back byte for
+byte instead, e.g. after a profile was damaged. Secrets redacted in the
+snapshots are filled in from the backup. The current files are backed up
+first.
+
+A key the backup reads from a cmd: reference is only resolved once the
+command is confirmed, or with --allow-commands, as a backup file may come
+from someone else.
+
+Examples:
+  claude-foundry-manager backup restore 20240115_1430
+  claude-foundry-manager backup restore 20240115_1430 --dry-run
+  claude-foundry-manager backup restore 20240115_1430 --only=models --yes
+  claude-foundry-manager backup restore 20240115_1430 --only=auth,ANTHROPIC_FOUNDRY_RESOURCE
+  claude-foundry-manager backup restore 20240115_1430 --files`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		filename := args[0]
+		filename, err := backup.ResolveBackup(args[0])
+		if err != nil {
+			return err
+		}
+
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+
+		if restoreFiles {
+			if len(restoreOnly) > 0 {
+				return fmt.Errorf("--only cannot be combined with --files")
+			}
+			return restoreBackupFiles(store, filename)
+		}
+
+		var match func(string) bool
+		if len(restoreOnly) > 0 {
+			if match, err = backup.ParseOnly(restoreOnly); err != nil {
+				return err
+			}
+		}
+
+		changes, err := backup.PreviewRestore(store, filename, match)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\n=== Restoring %s ===\n", filename)
+		printBackupChanges(changes)
+		if restoreDryRun {
+			fmt.Println("\nDry run; nothing was changed.")
+			return nil
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+		if ok, err := confirmRestore(); err != nil || !ok {
+			return err
+		}
 
 		// Create a backup before restoring (in case user wants to undo)
-		if err := backup.CreateAutoBackup("Before restore operation"); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: Failed to create pre-restore backup: %v\n", err)
+		if err := backup.CreateRestoreBackup(store, filename); err != nil {
+			warnBackup(err)
 		}
 
-		if err := backup.RestoreBackup(filename); err != nil {
+		warnings, err := backup.RestoreSelected(store, filename, match)
+		if err != nil {
 			return fmt.Errorf("failed to restore backup: %w", err)
 		}
+		for _, warning := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
 
 		fmt.Printf("\n✓ Configuration restored from: %s\n", filename)
 		fmt.Println("\nPlease restart your terminal for the changes to take effect.")
@@ -97,9 +215,630 @@ var backupRestoreCmd = &cobra.Command{
 	},
 }
 
+var backupShowCmd = &cobra.Command{
+	Use:   "show [id]",
+	Short: "Show the variables and details of a backup",
+	Long: `Show the details and variables of a backup. API keys and tokens are masked
+and shown with their fingerprint, which changes when the key does.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filename, err := backup.ResolveBackup(args[0])
+		if err != nil {
+			return err
+		}
+		b, err := backup.LoadBackup(filename)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("\n=== Backup %s ===\n\n", filename)
+		fmt.Printf("Created: %s\n", b.Timestamp.Format("2006-01-02 15:04:05"))
+		fmt.Printf("Description: %s\n", b.Description)
+		kind := "automatic"
+		if b.Kind == backup.KindManual {
+			kind = "manual"
+		}
+		fmt.Printf("Kind: %s\n", kind)
+		if b.Pinned {
+			fmt.Println("Pinned: yes")
+		}
+		fmt.Printf("Provider: %s\n", config.DetectProvider(b.Variables).Title())
+		if b.Sealed != nil {
+			fmt.Printf("Secrets: %s\n", secretsLabel(b.Sealed.Mode))
+		}
+		printBackupMetadata(b.Metadata)
+
+		printBackupEntries(b.Entries())
+		printBackupFiles(b.Files)
+		fmt.Println()
+		return nil
+	},
+}
+
+var backupDiffJSON bool
+
+var backupDiffCmd = &cobra.Command{
+	Use:   "diff [id] [id|current]",
+	Short: "Show what differs between two backups, or a backup and now",
+	Long: `Show the variables added, removed and changed going from the first backup to
+the second. Without a second backup, or with "current", the backup is
+compared with the current configuration.
+
+API keys and tokens are compared by fingerprint and masked in the output,
+so encrypted backups compare without their passphrase.
+
+Examples:
+  claude-foundry-manager backup diff 20240115_1430
+  claude-foundry-manager backup diff 20240115_1430 20240116_0915
+  claude-foundry-manager backup diff 20240115_1430 current --json`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		fromName, err := backup.ResolveBackup(args[0])
+		if err != nil {
+			return err
+		}
+		from, err := backup.LoadBackup(fromName)
+		if err != nil {
+			return err
+		}
+
+		toName := "current"
+		if len(args) == 2 && args[1] != "current" {
+			if toName, err = backup.ResolveBackup(args[1]); err != nil {
+				return err
+			}
+		}
+		var to *backup.Backup
+		if toName == "current" {
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			if to, err = backup.Snapshot(store); err != nil {
+				return err
+			}
+		} else if to, err = backup.LoadBackup(toName); err != nil {
+			return err
+		}
+
+		changes := backup.Diff(from, to)
+		if backupDiffJSON {
+			data, err := json.MarshalIndent(struct {
+				From    string          `json:"from"`
+				To      string          `json:"to"`
+				Changes []backup.Change `json:"changes"`
+			}{fromName, toName, changes}, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		fmt.Printf("\n=== %s -> %s ===\n", fromName, toName)
+		printBackupChanges(changes)
+		fmt.Println()
+		return nil
+	},
+}
+
+var backupDeleteCmd = &cobra.Command{
+	Use:   "delete [id]",
+	Short: "Delete a backup",
+	Long: `Delete a backup. Pinned backups must be unpinned first. Files that cannot
+be read as a backup (shown at the end of 'backup list') are deleted as well.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filename, err := backup.ResolveBackup(args[0])
+		if err != nil {
+			return err
+		}
+		// A file that is not a readable backup cannot be pinned either
+		b, err := backup.LoadBackup(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s is not a readable backup: %v\n", filename, err)
+		} else if b.Pinned {
+			return fmt.Errorf("%s is pinned; unpin it first with 'backup unpin %s'", filename, backup.BackupID(filename))
+		}
+		if err := backup.DeleteBackup(filename); err != nil {
+			return fmt.Errorf("failed to delete backup: %w", err)
+		}
+		fmt.Printf("✓ Deleted %s\n", filename)
+		return nil
+	},
+}
+
+var (
+	backupSecrets      string
+	backupAgeRecipient string
+	backupAgeIdentity  string
+	backupKeepLast     int
+	backupSnapshots    bool
+	backupSnapshotMax  int64
+	restoreFiles       bool
+	restoreOnly        []string
+	restoreDryRun      bool
+	restoreYes         bool
+	restoreCommands    bool
+	backupKeepDaily    int
+	backupMaxAge       int
+	pruneDryRun        bool
+)
+
+var backupSettingsCmd = &cobra.Command{
+	Use:   "settings",
+	Short: "Choose how API keys and tokens are kept in backups",
+	Long: `Choose how secret variables (API keys and tokens) are kept in new backups:
+  plain       as is (default)
+  redact      only a fingerprint; restoring keeps the current key
+  passphrase  encrypted with AES-256-GCM under a passphrase, asked for once
+              here and then on every backup, unless
+              CLAUDE_FOUNDRY_BACKUP_PASSPHRASE is set
+  age         encrypted to an age recipient with the age CLI
+
+Restoring asks for the passphrase only when a secret in the backup differs
+from the current one. When no passphrase can be asked for, e.g. in a
+script, backups are redacted instead.
+
+Automatic backups are pruned after each new one: those older than
+--max-age days go, and otherwise only the --keep-last newest and the newest
+of each of the last --keep-daily days are kept. Manual and pinned backups
+are never pruned. The default keeps the last 10 and one a day for 30 days;
+setting all three to 0 keeps everything.
+
+With --file-snapshots, each backup also keeps a byte-exact copy of the
+shell profiles, env files and settings files, which backup restore --files
+puts back. Files larger than --snapshot-max-size are left out. Unless
+secrets are kept plain, secrets in the files are replaced by placeholders
+and filled in from the backup on restore.
+
+Without flags, the current settings are shown.
+
+Examples:
+  claude-foundry-manager backup settings --keep-last=20 --keep-daily=14 --max-age=90
+  claude-foundry-manager backup settings --secrets=redact
+  claude-foundry-manager backup settings --file-snapshots --snapshot-max-size=262144
+  claude-foundry-manager backup settings --secrets=passphrase
+  claude-foundry-manager backup settings --secrets=age --age-recipient=age1... --age-identity=~/.config/age/keys.txt`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		settings, err := backup.LoadSettings()
+		if err != nil {
+			return err
+		}
+		if cmd.Flags().NFlag() == 0 {
+			fmt.Printf("Secrets: %s\n", secretsLabel(settings.Secrets))
+			if settings.AgeRecipient != "" {
+				fmt.Printf("age recipient: %s\n", settings.AgeRecipient)
+			}
+			if settings.AgeIdentity != "" {
+				fmt.Printf("age identity: %s\n", settings.AgeIdentity)
+			}
+			fmt.Printf("Retention: %s\n", settings.RetentionPolicy())
+			if settings.FileSnapshots {
+				fmt.Printf("File snapshots: on, up to %d bytes a file\n", settings.SnapshotMaxBytesLimit())
+			} else {
+				fmt.Println("File snapshots: off")
+			}
+			return nil
+		}
+
+		retention := settings.RetentionPolicy()
+		if cmd.Flags().Changed("keep-last") {
+			retention.KeepLast = backupKeepLast
+		}
+		if cmd.Flags().Changed("keep-daily") {
+			retention.KeepDaily = backupKeepDaily
+		}
+		if cmd.Flags().Changed("max-age") {
+			retention.MaxAgeDays = backupMaxAge
+		}
+		if retention != settings.RetentionPolicy() {
+			settings.Retention = &retention
+		}
+
+		if cmd.Flags().Changed("file-snapshots") {
+			settings.FileSnapshots = backupSnapshots
+		}
+		if cmd.Flags().Changed("snapshot-max-size") {
+			settings.SnapshotMaxBytes = backupSnapshotMax
+		}
+		if cmd.Flags().Changed("age-recipient") {
+			settings.AgeRecipient = backupAgeRecipient
+		}
+		if cmd.Flags().Changed("age-identity") {
+			identity, err := expandHome(backupAgeIdentity)
+			if err != nil {
+				return err
+			}
+			settings.AgeIdentity = identity
+		}
+		if cmd.Flags().Changed("secrets") {
+			settings.Secrets = backupSecrets
+			if settings.Secrets == backup.SecretsPassphrase {
+				passphrase, err := newBackupPassphrase()
+				if err != nil {
+					return err
+				}
+				if err := settings.SetPassphrase(passphrase); err != nil {
+					return err
+				}
+			}
+		}
+		if err := backup.SaveSettings(settings); err != nil {
+			return err
+		}
+
+		if cmd.Flags().Changed("secrets") || cmd.Flags().Changed("age-recipient") || cmd.Flags().Changed("age-identity") {
+			fmt.Printf("✓ Secrets in new backups: %s\n", secretsLabel(settings.Secrets))
+			if settings.Secrets == backup.SecretsPlain {
+				fmt.Println("Existing backups are unchanged.")
+			} else {
+				fmt.Println("Existing backups keep their secrets as they are, but are now readable only by you.")
+			}
+		}
+		if cmd.Flags().Changed("keep-last") || cmd.Flags().Changed("keep-daily") || cmd.Flags().Changed("max-age") {
+			fmt.Printf("✓ Retention: %s\n", settings.RetentionPolicy())
+		}
+		if cmd.Flags().Changed("file-snapshots") || cmd.Flags().Changed("snapshot-max-size") {
+			if settings.FileSnapshots {
+				fmt.Printf("✓ File snapshots: on, up to %d bytes a file\n", settings.SnapshotMaxBytesLimit())
+			} else {
+				fmt.Println("✓ File snapshots: off")
+			}
+		}
+		return nil
+	},
+}
+
+var backupPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove automatic backups the retention policy no longer keeps",
+	Long: `Remove the automatic backups the retention policy no longer keeps (see
+backup settings). Manual and pinned backups are never removed.
+
+Examples:
+  claude-foundry-manager backup prune --dry-run
+  claude-foundry-manager backup prune`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pruned, err := backup.Prune(pruneDryRun)
+		for _, b := range pruned {
+			fmt.Printf("  %s  %s  %s\n", b.Filename, b.Timestamp.Format("2006-01-02 15:04:05"), b.Description)
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case len(pruned) == 0:
+			fmt.Println("Nothing to prune.")
+		case pruneDryRun:
+			fmt.Printf("\n%d backup(s) would be removed (dry run)\n", len(pruned))
+		default:
+			fmt.Printf("\n✓ Removed %d backup(s)\n", len(pruned))
+		}
+		return nil
+	},
+}
+
+var backupPinCmd = &cobra.Command{
+	Use:   "pin [id]",
+	Short: "Keep a backup forever; it is never pruned",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filename, err := backup.ResolveBackup(args[0])
+		if err != nil {
+			return err
+		}
+		if err := backup.PinBackup(filename, true); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Pinned %s\n", filename)
+		return nil
+	},
+}
+
+var backupUnpinCmd = &cobra.Command{
+	Use:   "unpin [id]",
+	Short: "Let the retention policy prune a pinned backup again",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filename, err := backup.ResolveBackup(args[0])
+		if err != nil {
+			return err
+		}
+		if err := backup.PinBackup(filename, false); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Unpinned %s\n", filename)
+		return nil
+	},
+}
+
+// restoreBackupFiles puts back the files snapshotted in a backup, after
+// snapshotting the current ones
+func restoreBackupFiles(store config.EnvStore, filename string) error {
+	b, err := backup.LoadBackup(filename)
+	if err != nil {
+		return err
+	}
+	if len(b.Files) == 0 {
+		return fmt.Errorf("%s has no file snapshots; turn them on with 'backup settings --file-snapshots'", filename)
+	}
+	if err := b.CheckFiles(store); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n=== Restoring the files of %s ===\n\n", filename)
+	files := []string{}
+	for _, f := range b.Files {
+		files = append(files, f.Path)
+		switch {
+		case f.Missing || f.Skipped != "":
+			fmt.Printf("  %s: left as is\n", f.Path)
+		case f.Differs():
+			fmt.Printf("  %s: changed since the backup\n", f.Path)
+		default:
+			fmt.Printf("  %s: unchanged\n", f.Path)
+		}
+	}
+	if restoreDryRun {
+		fmt.Println("\nDry run; nothing was changed.")
+		return nil
+	}
+	if ok, err := confirmRestore(); err != nil || !ok {
+		return err
+	}
+
+	var warning *backup.Warning
+	if err := backup.CreateFilesBackup(store, "Before restoring files", files...); errors.As(err, &warning) {
+		fmt.Fprintf(os.Stderr, "Warning: Backup created, but %v\n", warning)
+	} else if err != nil {
+		return fmt.Errorf("failed to back up the current files: %w", err)
+	}
+
+	restored, warnings, err := backup.RestoreFiles(store, filename)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+	for _, path := range restored {
+		fmt.Printf("✓ Restored %s\n", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore files: %w", err)
+	}
+	if len(restored) > 0 {
+		fmt.Println("\nPlease restart your terminal for the changes to take effect.")
+	}
+	return nil
+}
+
+// confirmRestore asks whether to go ahead with a restore, unless --yes
+// was given. Without a terminal to ask on, --yes is required.
+func confirmRestore() (bool, error) {
+	if restoreYes {
+		return true, nil
+	}
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false, fmt.Errorf("no terminal to confirm the restore on; pass --yes to restore anyway")
+	}
+	fmt.Print("\nRestore? [y/N]: ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+		fmt.Println("Restore cancelled.")
+		return false, nil
+	}
+	return true, nil
+}
+
+// expandHome replaces a leading ~ of a path flag with the home directory,
+// as the shell leaves --flag=~/path alone
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
+
+// confirmBackupCommand asks whether to run the command of a cmd: reference
+// in a backup being restored, unless --allow-commands was given. Without a
+// terminal to ask on, --allow-commands is required.
+func confirmBackupCommand(key, command string) (bool, error) {
+	if restoreCommands {
+		return true, nil
+	}
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false, fmt.Errorf("the backup reads %s from the command %q; pass --allow-commands to run it", key, command)
+	}
+	fmt.Printf("\nThe backup reads %s from the command:\n  %s\nRun it? [y/N]: ", key, command)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// warnBackup warns that the automatic backup before a change failed, or
+// of a problem with the backup that was created anyway
+func warnBackup(err error) {
+	var warning *backup.Warning
+	if errors.As(err, &warning) {
+		fmt.Fprintf(os.Stderr, "Warning: Backup created, but %v\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warning: Failed to create backup: %v\n", err)
+}
+
+// backupMarkers tags manual and pinned backups in listings
+func backupMarkers(b backup.BackupInfo) string {
+	markers := ""
+	if b.Manual {
+		markers += " [manual]"
+	}
+	if b.Pinned {
+		markers += " [pinned]"
+	}
+	return markers
+}
+
+// printBackupMetadata prints what is known of where a backup was made;
+// older backups have none of it
+func printBackupMetadata(m backup.Metadata) {
+	fields := []struct{ label, value string }{
+		{"Host", m.Hostname},
+		{"OS", m.OS},
+		{"Shell", m.Shell},
+		{"Location", m.Location},
+		{"Made by", m.Command},
+		{"Tool version", m.ToolVersion},
+		{"Tags", strings.Join(m.Tags, ", ")},
+	}
+	for _, f := range fields {
+		if f.value != "" {
+			fmt.Printf("%s: %s\n", f.label, f.value)
+		}
+	}
+}
+
+// printBackupFiles prints the file snapshots of a backup
+func printBackupFiles(files []backup.FileSnapshot) {
+	if len(files) == 0 {
+		return
+	}
+	fmt.Println("\nFiles:")
+	for _, f := range files {
+		switch {
+		case f.Missing:
+			fmt.Printf("  %s (did not exist)\n", f.Path)
+		case f.Skipped != "":
+			fmt.Printf("  %s (not kept: %s)\n", f.Path, f.Skipped)
+		case len(f.Redacted) > 0:
+			fmt.Printf("  %s (%d bytes, %s redacted)\n", f.Path, f.Size, strings.Join(f.Redacted, ", "))
+		default:
+			fmt.Printf("  %s (%d bytes)\n", f.Path, f.Size)
+		}
+	}
+}
+
+// printBackupEntries prints the variables of a backup, grouped by the
+// settings file they are in
+func printBackupEntries(entries []backup.Entry) {
+	if len(entries) == 0 {
+		fmt.Println("\n(no variables)")
+		return
+	}
+	path := "-"
+	for _, e := range entries {
+		if e.Path != path {
+			path = e.Path
+			if path == "" {
+				fmt.Println("\nVariables:")
+			} else {
+				fmt.Printf("\nSettings %s:\n", path)
+			}
+		}
+		if e.Note != "" {
+			fmt.Printf("  %s=%s [%s]\n", e.Key, e.Value, e.Note)
+		} else {
+			fmt.Printf("  %s=%s\n", e.Key, e.Value)
+		}
+	}
+}
+
+// printBackupChanges prints the changes of a diff, grouped by the settings
+// file they are in
+func printBackupChanges(changes []backup.Change) {
+	if len(changes) == 0 {
+		fmt.Println("\nNo differences.")
+		return
+	}
+	path := "-"
+	for _, c := range changes {
+		if c.Path != path {
+			path = c.Path
+			if path == "" {
+				fmt.Println("\nVariables:")
+			} else {
+				fmt.Printf("\nSettings %s:\n", path)
+			}
+		}
+		switch c.Change {
+		case backup.ChangeAdded:
+			fmt.Printf("  + %s=%s\n", c.Key, c.New)
+		case backup.ChangeRemoved:
+			fmt.Printf("  - %s=%s\n", c.Key, c.Old)
+		default:
+			fmt.Printf("  ~ %s: %s -> %s\n", c.Key, c.Old, c.New)
+		}
+	}
+}
+
+// newBackupPassphrase asks for a new passphrase twice, or takes it from
+// CLAUDE_FOUNDRY_BACKUP_PASSPHRASE
+func newBackupPassphrase() (string, error) {
+	if passphrase := os.Getenv(backup.PassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	passphrase, err := ui.ReadPassword("New backup passphrase: ")
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	again, err := ui.ReadPassword("Repeat the passphrase: ")
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if passphrase != again {
+		return "", fmt.Errorf("the passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// secretsLabel describes a secret mode of backups
+func secretsLabel(mode string) string {
+	switch mode {
+	case backup.SecretsRedact:
+		return "redacted (fingerprint only)"
+	case backup.SecretsPassphrase:
+		return "encrypted with a passphrase"
+	case backup.SecretsAge:
+		return "encrypted with age"
+	}
+	return mode
+}
+
 func init() {
 	rootCmd.AddCommand(backupCmd)
 	backupCmd.AddCommand(backupListCmd)
 	backupCmd.AddCommand(backupCreateCmd)
 	backupCmd.AddCommand(backupRestoreCmd)
+	backupCmd.AddCommand(backupShowCmd)
+	backupCmd.AddCommand(backupDiffCmd)
+	backupCmd.AddCommand(backupDeleteCmd)
+	backupCmd.AddCommand(backupSettingsCmd)
+	backupCmd.AddCommand(backupPruneCmd)
+	backupCmd.AddCommand(backupPinCmd)
+	backupCmd.AddCommand(backupUnpinCmd)
+
+	backupCreateCmd.Flags().StringArrayVar(&backupTags, "tag", nil, "Tag the backup (repeatable)")
+	backupDiffCmd.Flags().BoolVar(&backupDiffJSON, "json", false, "Print the changes as JSON")
+	backupPruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "Show which backups would be removed without removing them")
+	backupSettingsCmd.Flags().IntVar(&backupKeepLast, "keep-last", 0, "Number of newest automatic backups always kept")
+	backupSettingsCmd.Flags().IntVar(&backupKeepDaily, "keep-daily", 0, "Number of days for which the newest automatic backup of each day is kept")
+	backupSettingsCmd.Flags().IntVar(&backupMaxAge, "max-age", 0, "Days after which automatic backups are removed (0 for no limit)")
+
+	backupSettingsCmd.Flags().BoolVar(&backupSnapshots, "file-snapshots", false, "Keep a byte-exact copy of the profile and settings files in each backup")
+	backupSettingsCmd.Flags().Int64Var(&backupSnapshotMax, "snapshot-max-size", 0, "Largest file snapshotted, in bytes (0 for the default of 1 MiB)")
+	backupSettingsCmd.Flags().StringVar(&backupSecrets, "secrets", "", "How secrets are kept in new backups: plain, redact, passphrase or age")
+	backupSettingsCmd.Flags().StringVar(&backupAgeRecipient, "age-recipient", "", "age recipient secrets are encrypted to")
+	backupSettingsCmd.Flags().StringVar(&backupAgeIdentity, "age-identity", "", "age identity file used to decrypt secrets when restoring")
+
+	backupRestoreCmd.Flags().StringSliceVar(&restoreOnly, "only", nil, "Restore only these groups (models, endpoint, auth) or variables, comma separated")
+	backupRestoreCmd.Flags().BoolVar(&restoreDryRun, "dry-run", false, "Show what would change without restoring")
+	backupRestoreCmd.Flags().BoolVarP(&restoreYes, "yes", "y", false, "Restore without asking for confirmation")
+	backupRestoreCmd.Flags().BoolVar(&restoreCommands, "allow-commands", false, "Run the commands of cmd: references in the backup without asking")
+	backupRestoreCmd.Flags().BoolVar(&restoreFiles, "files", false, "Put back the profile and settings files snapshotted in the backup instead of restoring variables")
+	addShellsFlag(backupRestoreCmd)
 }
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gilbe/claude-foundry-manager/internal/backup"
+)
+
+func TestBackupSettingsExpandsAgeIdentity(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	resetFlags()
+	rootCmd.SetArgs([]string{"backup", "settings", "--age-identity=~/.config/age/keys.txt"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("backup settings failed: %v", err)
+	}
+	settings, err := backup.LoadSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(home, ".config", "age", "keys.txt"); settings.AgeIdentity != want {
+		t.Errorf("Expected the identity %s, got %s", want, settings.AgeIdentity)
+	}
+}
+
+func TestBackupDeleteRemovesUnreadableBackups(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	if err := os.MkdirAll(backup.GetBackupDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(backup.GetBackupDir(), "backup_20240115_143022.json")
+	if err := os.WriteFile(broken, []byte("{truncated"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	resetFlags()
+	rootCmd.SetArgs([]string{"backup", "delete", "20240115_143022"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("backup delete failed: %v", err)
+	}
+	if _, err := os.Stat(broken); !os.IsNotExist(err) {
+		t.Errorf("Expected the unreadable backup to be deleted, got %v", err)
+	}
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/gilbe/claude-foundry-manager/internal/backup"
 	"github.com/gilbe/claude-foundry-manager/internal/config"
+	"github.com/gilbe/claude-foundry-manager/internal/layers"
+	"github.com/gilbe/claude-foundry-manager/internal/secrets"
 	"github.com/spf13/cobra"
 )
 
@@ -16,18 +18,49 @@ var (
 	sonnetModel string
 	haikuModel  string
 	opusModel   string
+
+	configureScope    string
+	configureProvider string
+	region            string
+	projectID         string
+	awsProfile        string
+	envAssignments    []string
+	envUnsets         []string
+	useKeyHelper      bool
+	apiKeyStdin       bool
 )
 
 var configureCmd = &cobra.Command{
 	Use:   "configure",
-	Short: "Configure Azure Foundry settings",
+	Short: "Configure Azure Foundry or another provider",
 	Long: `Configure Claude Code to use Azure AI Foundry with the specified resource and models.
 
+Other providers are chosen with --provider:
+  foundry    Azure AI Foundry (default): --resource or --base-url, --api-key
+  bedrock    Amazon Bedrock: --region, --aws-profile, --api-key, --base-url
+  vertex     Google Vertex AI: --region, --project-id, --base-url
+  gateway    LLM gateway: --base-url, --api-key (sent as ANTHROPIC_AUTH_TOKEN)
+  anthropic  Direct Anthropic API (same as rollback, keeps model overrides)
+Every provider accepts --sonnet-model, --haiku-model and --opus-model.
+Switching providers removes the variables of the previous one.
+
+--env KEY=VALUE and --unset KEY manage further Claude Code variables. Only
+Claude Code, proxy and certificate variables are accepted; PATH-like and
+other protected variables are refused. Given alone, they leave the provider
+configuration untouched.
+
 You can configure using either:
   1. --resource (resource name) - auto-generates the base URL
   2. --base-url (full URL) - provide the complete base URL
 
 If --api-key is not provided, the tool will configure for Entra ID authentication.
+To keep the key out of shell history and ps output, pass --api-key-stdin or
+a reference: env:VAR, file:PATH or cmd:COMMAND. References are resolved when
+the configuration is applied, and backups keep the reference rather than
+the key, so a restore resolves it again.
+With --api-key-helper, the key (or the one already configured) is kept in
+the secret backend and Claude Code reads it through apiKeyHelper, so it
+never appears in the shell profile.
 
 Examples:
   # Configure with resource name (recommended)
@@ -36,29 +69,71 @@ Examples:
   # Configure with full base URL
   claude-foundry-manager configure --base-url=https://my-foundry.services.ai.azure.com --api-key=sk-xxx
 
+  # Read the key from a file or a vault instead of the command line
+  claude-foundry-manager configure --resource=my-foundry --api-key=file:/run/secrets/foundry
+  claude-foundry-manager configure --resource=my-foundry --api-key="cmd:az keyvault secret show --vault-name kv --name foundry --query value -o tsv"
+  pass show foundry | claude-foundry-manager configure --resource=my-foundry --api-key-stdin
+
+  # Keep the key out of the shell profile
+  claude-foundry-manager configure --resource=my-foundry --api-key=sk-xxx --api-key-helper
+
   # Configure with Entra ID (no API key)
   claude-foundry-manager configure --resource=my-foundry
 
   # Configure with custom model deployments
-  claude-foundry-manager configure --resource=my-foundry --sonnet-model=claude-4-5 --haiku-model=claude-haiku`,
+  claude-foundry-manager configure --resource=my-foundry --sonnet-model=claude-4-5 --haiku-model=claude-haiku
+
+  # Use Amazon Bedrock with an AWS profile
+  claude-foundry-manager configure --provider=bedrock --region=us-east-1 --aws-profile=dev
+
+  # Manage extra Claude Code variables next to the provider settings
+  claude-foundry-manager configure --env ANTHROPIC_SMALL_FAST_MODEL=claude-haiku-4-5 --env DISABLE_TELEMETRY=1
+  claude-foundry-manager configure --unset DISABLE_TELEMETRY
+
+  # Write the configuration to the profile of every installed shell
+  claude-foundry-manager configure --resource=my-foundry --shells=detected
+
+  # Pin the Sonnet deployment for this project only; the other settings
+  # come from the system, team and user layers
+  claude-foundry-manager configure --scope=project --sonnet-model=claude-sonnet-4-5
+
+With --scope, only the settings given on the command line are saved to that
+layer, and the merged result of all layers is applied (see show --layers).`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Validate that either resource or base-url is provided (but not both)
-		if resource == "" && baseURL == "" {
-			return fmt.Errorf("either --resource or --base-url is required")
+		extra, err := parseEnvFlags()
+		if err != nil {
+			return err
+		}
+		if apiKeyStdin {
+			if cmd.Flags().Changed("api-key") {
+				return fmt.Errorf("--api-key and --api-key-stdin cannot be used together")
+			}
+			key, err := readSecret("API key: ")
+			if err != nil {
+				return err
+			}
+			if err := cmd.Flags().Set("api-key", key); err != nil {
+				return err
+			}
 		}
-		if resource != "" && baseURL != "" {
-			return fmt.Errorf("cannot specify both --resource and --base-url, choose one")
+		if len(changedSettings(cmd)) == 0 && !cmd.Flags().Changed("provider") && configureScope == "" && !extra.empty() {
+			return configureExtraEnv(extra)
 		}
 
-		// Set defaults for model names if not provided
-		if sonnetModel == "" {
-			sonnetModel = "claude-sonnet-4-5"
+		provider, err := config.LookupProvider(configureProvider)
+		if err != nil {
+			return err
 		}
-		if haikuModel == "" {
-			haikuModel = "claude-haiku-4-5"
+		if provider != config.Foundry {
+			if configureScope != "" {
+				return fmt.Errorf("--scope only supports the foundry provider")
+			}
+			return configureProviderVars(provider, changedSettings(cmd), extra)
 		}
-		if opusModel == "" {
-			opusModel = "claude-opus-4-5"
+		for name := range changedSettings(cmd) {
+			if !acceptsSetting(provider, name) {
+				return fmt.Errorf("%s does not accept --%s, choose the provider with --provider", provider.Title(), flagNames[name])
+			}
 		}
 
 		cfg := &config.FoundryConfig{
@@ -70,15 +145,90 @@ Examples:
 			OpusModel:   opusModel,
 		}
 
+		if configureScope != "" {
+			resolved, err := writeScope(cmd, configureScope)
+			if err != nil {
+				return err
+			}
+			cfg = resolved
+		}
+
+		// Validate that either resource or base-url is provided (but not both)
+		if err := validateFoundry(cfg); err != nil {
+			return err
+		}
+
+		apiKeyRef := ""
+		if secrets.IsRef(cfg.APIKey) {
+			apiKeyRef = cfg.APIKey
+			if cfg.APIKey, err = secrets.Resolve(apiKeyRef); err != nil {
+				return fmt.Errorf("failed to resolve --api-key: %w", err)
+			}
+		}
+
+		// Set defaults for model names if not provided
+		if cfg.SonnetModel == "" {
+			cfg.SonnetModel = "claude-sonnet-4-5"
+		}
+		if cfg.HaikuModel == "" {
+			cfg.HaikuModel = "claude-haiku-4-5"
+		}
+		if cfg.OpusModel == "" {
+			cfg.OpusModel = "claude-opus-4-5"
+		}
+
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+
+		// Without --api-key the plaintext key already configured moves
+		// behind apiKeyHelper
+		helperKey := cfg.APIKey
+		if useKeyHelper && helperKey == "" {
+			if helperKey, err = store.Get(config.EnvFoundryAPIKey); err != nil {
+				return fmt.Errorf("failed to read %s: %w", config.EnvFoundryAPIKey, err)
+			}
+		}
+
 		// Create backup before making changes
-		if err := backup.CreateAutoBackup("Before configuring Azure Foundry"); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: Failed to create backup: %v\n", err)
+		if err := backup.CreateAutoBackup(store, "Before configuring Azure Foundry"); err != nil {
+			warnBackup(err)
+		}
+
+		// Store the key behind apiKeyHelper before the profile loses it,
+		// and take it back out should the configuration not apply
+		undoSecret := func() error { return nil }
+		if useKeyHelper {
+			settings, err := secrets.LoadSettings()
+			if err != nil {
+				return err
+			}
+			if undoSecret, err = storeSecret(settings, helperKey); err != nil {
+				return err
+			}
+			cfg.APIKey = ""
+			apiKeyRef = ""
 		}
 
 		// Apply configuration
-		if err := config.ApplyFoundryConfig(cfg); err != nil {
+		if err := config.ApplyFoundryConfig(store, cfg); err != nil {
+			if undoErr := undoSecret(); undoErr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: Failed to undo apiKeyHelper: %v\n", undoErr)
+			}
 			return fmt.Errorf("failed to apply configuration: %w", err)
 		}
+		if err := config.RecordSecretRef(config.EnvFoundryAPIKey, apiKeyRef, cfg.APIKey); err != nil {
+			return err
+		}
+		if !useKeyHelper && cfg.APIKey != "" {
+			if err := unwireKeyHelper(); err != nil {
+				return err
+			}
+		}
+		if err := extra.apply(store); err != nil {
+			return err
+		}
 
 		fmt.Println("\n✓ Azure Foundry configuration applied successfully!")
 		fmt.Println("\nPlease restart your terminal for the changes to take effect.")
@@ -87,16 +237,217 @@ Examples:
 	},
 }
 
+// flagNames maps provider setting names to the configure flags that set them
+var flagNames = map[string]string{
+	"resource":     "resource",
+	"base_url":     "base-url",
+	"api_key":      "api-key",
+	"region":       "region",
+	"project_id":   "project-id",
+	"aws_profile":  "aws-profile",
+	"sonnet_model": "sonnet-model",
+	"haiku_model":  "haiku-model",
+	"opus_model":   "opus-model",
+}
+
+// changedSettings returns the provider settings given on the command line
+func changedSettings(cmd *cobra.Command) map[string]string {
+	settings := map[string]string{}
+	for name, flag := range flagNames {
+		if cmd.Flags().Changed(flag) {
+			settings[name] = cmd.Flags().Lookup(flag).Value.String()
+		}
+	}
+	return settings
+}
+
+// acceptsSetting reports whether provider has a setting with the given name
+func acceptsSetting(provider config.Provider, name string) bool {
+	for _, field := range provider.Fields() {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// configureProviderVars switches to a provider other than Azure Foundry
+func configureProviderVars(provider config.Provider, settings map[string]string, extra extraEnv) error {
+	if err := provider.Validate(settings); err != nil {
+		return err
+	}
+
+	apiKeyRef := settings["api_key"]
+	if secrets.IsRef(apiKeyRef) {
+		value, err := secrets.Resolve(apiKeyRef)
+		if err != nil {
+			return fmt.Errorf("failed to resolve --api-key: %w", err)
+		}
+		settings["api_key"] = value
+	} else {
+		apiKeyRef = ""
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+
+	if err := backup.CreateAutoBackup(store, "Before configuring "+provider.Title()); err != nil {
+		warnBackup(err)
+	}
+
+	if err := config.ApplyProvider(store, provider, settings); err != nil {
+		return fmt.Errorf("failed to apply configuration: %w", err)
+	}
+	for _, field := range provider.Fields() {
+		if field.Name == "api_key" {
+			if err := config.RecordSecretRef(field.Env, apiKeyRef, settings["api_key"]); err != nil {
+				return err
+			}
+		}
+	}
+	if err := unwireKeyHelper(); err != nil {
+		return err
+	}
+	if err := extra.apply(store); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n✓ %s configuration applied successfully!\n", provider.Title())
+	fmt.Println("\nPlease restart your terminal for the changes to take effect.")
+	return nil
+}
+
+// extraEnv holds the --env and --unset flags
+type extraEnv struct {
+	sets   map[string]string
+	unsets []string
+}
+
+// parseEnvFlags validates --env and --unset before anything is changed
+func parseEnvFlags() (extraEnv, error) {
+	extra := extraEnv{sets: map[string]string{}}
+	for _, arg := range envAssignments {
+		key, value, err := config.ParseEnvAssignment(arg)
+		if err != nil {
+			return extraEnv{}, err
+		}
+		extra.sets[key] = value
+	}
+	for _, key := range envUnsets {
+		if err := config.ValidateExtraKey(key); err != nil {
+			return extraEnv{}, err
+		}
+		if _, ok := extra.sets[key]; ok {
+			return extraEnv{}, fmt.Errorf("%s is given to both --env and --unset", key)
+		}
+		extra.unsets = append(extra.unsets, key)
+	}
+	return extra, nil
+}
+
+// empty reports whether no extra variable is set or unset
+func (e extraEnv) empty() bool {
+	return len(e.sets) == 0 && len(e.unsets) == 0
+}
+
+// apply writes the extra variables to the store
+func (e extraEnv) apply(store config.EnvStore) error {
+	if e.empty() {
+		return nil
+	}
+	if err := config.ApplyEnv(store, e.sets, e.unsets); err != nil {
+		return fmt.Errorf("failed to apply extra variables: %w", err)
+	}
+	return nil
+}
+
+// configureExtraEnv changes only extra variables, leaving the provider alone
+func configureExtraEnv(extra extraEnv) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+
+	if err := backup.CreateAutoBackup(store, "Before changing extra variables"); err != nil {
+		warnBackup(err)
+	}
+
+	if err := extra.apply(store); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n✓ Extra variables updated (%d set, %d removed)\n", len(extra.sets), len(extra.unsets))
+	fmt.Println("\nPlease restart your terminal for the changes to take effect.")
+	return nil
+}
+
+// writeScope saves the flags the user set to the layer named by scope and
+// returns the configuration all layers resolve to afterwards. Nothing is
+// saved when that configuration is invalid.
+func writeScope(cmd *cobra.Command, scope string) (*config.FoundryConfig, error) {
+	target, err := layers.ParseScope(scope)
+	if err != nil {
+		return nil, err
+	}
+	locations, err := layers.DefaultLocations()
+	if err != nil {
+		return nil, err
+	}
+
+	values := changedSettings(cmd)
+	if len(values) == 0 {
+		return nil, fmt.Errorf("nothing to write to the %s layer, pass at least one setting", target)
+	}
+	if values["api_key"] != "" && (target == layers.ScopeTeam || target == layers.ScopeProject) {
+		fmt.Fprintf(os.Stderr, "Warning: the %s layer is usually shared, consider keeping the API key in the user layer\n", target)
+	}
+
+	// Check the merged result before saving anything to the layer
+	loaded, err := locations.Load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range loaded {
+		if loaded[i].Scope == target {
+			loaded[i] = loaded[i].WithValues(values)
+		}
+	}
+	resolved := layers.Resolve(loaded)
+	if err := validateFoundry(&resolved.Config); err != nil {
+		return nil, err
+	}
+
+	path := locations.Path(target)
+	if err := layers.Write(path, values); err != nil {
+		return nil, fmt.Errorf("failed to write %s layer: %w", target, err)
+	}
+	fmt.Printf("\n✓ Saved to the %s layer: %s\n", target, path)
+	return &resolved.Config, nil
+}
+
 func init() {
 	rootCmd.AddCommand(configureCmd)
 
 	configureCmd.Flags().StringVar(&resource, "resource", "", "Azure Foundry resource name (mutually exclusive with --base-url)")
-	configureCmd.Flags().StringVar(&baseURL, "base-url", "", "Full Azure Foundry base URL (mutually exclusive with --resource)")
-	configureCmd.Flags().StringVar(&apiKey, "api-key", "", "Azure Foundry API key (optional, uses Entra ID if not provided)")
+	configureCmd.Flags().StringVar(&baseURL, "base-url", "", "Full Azure Foundry base URL (mutually exclusive with --resource), or the base URL of the other providers")
+	configureCmd.Flags().StringVar(&apiKey, "api-key", "", "Azure Foundry API key (optional, uses Entra ID if not provided), Bedrock API key or gateway token; env:VAR, file:PATH or cmd:COMMAND reads it from there")
+	configureCmd.Flags().BoolVar(&apiKeyStdin, "api-key-stdin", false, "Read the API key from stdin")
 	configureCmd.Flags().StringVar(&sonnetModel, "sonnet-model", "", "Sonnet model deployment name (default: claude-sonnet-4-5)")
 	configureCmd.Flags().StringVar(&haikuModel, "haiku-model", "", "Haiku model deployment name (default: claude-haiku-4-5)")
 	configureCmd.Flags().StringVar(&opusModel, "opus-model", "", "Opus model deployment name (default: claude-opus-4-5)")
 
-	configureCmd.MarkFlagsOneRequired("resource", "base-url")
+	addShellsFlag(configureCmd)
+
+	configureCmd.Flags().StringVar(&configureProvider, "provider", config.ProviderFoundry, "Provider to configure: foundry, bedrock, vertex, gateway or anthropic")
+	configureCmd.Flags().StringVar(&region, "region", "", "Region (bedrock: AWS_REGION, vertex: CLOUD_ML_REGION)")
+	configureCmd.Flags().StringVar(&projectID, "project-id", "", "Google Cloud project ID (vertex)")
+	configureCmd.Flags().StringVar(&awsProfile, "aws-profile", "", "AWS profile to use (bedrock)")
+	configureCmd.Flags().StringArrayVar(&envAssignments, "env", nil, "Also manage an extra variable, e.g. --env DISABLE_TELEMETRY=1 (repeatable)")
+	configureCmd.Flags().StringArrayVar(&envUnsets, "unset", nil, "Remove an extra variable set with --env (repeatable)")
+	configureCmd.Flags().BoolVar(&useKeyHelper, "api-key-helper", false, "Keep the API key in the secret backend behind apiKeyHelper instead of the shell profile (see secret)")
+	configureCmd.Flags().StringVar(&configureScope, "scope", "", "Save the settings to a layer (system, team, user or project) and apply the merged result")
+
 	configureCmd.MarkFlagsMutuallyExclusive("resource", "base-url")
 }
@@ -0,0 +1,374 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gilbe/claude-foundry-manager/internal/backup"
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+	"github.com/gilbe/claude-foundry-manager/internal/profiles"
+	"github.com/spf13/cobra"
+)
+
+// profileFlags holds the flags shared by profile create and profile edit
+var profileFlags struct {
+	description string
+	resource    string
+	baseURL     string
+	apiKey      string
+	sonnetModel string
+	haikuModel  string
+	opusModel   string
+	fromCurrent bool
+}
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage named configuration profiles",
+	Long: `Manage named Foundry configurations, so switching between e.g. a dev
+resource, a prod resource and the direct Anthropic API is a single command.
+
+Profiles are stored in ~/.config/claude-foundry-manager/profiles. The built-in
+"anthropic" profile removes the Foundry configuration.
+
+Subcommands:
+  create - Save a new profile
+  list   - List profiles (the active one is marked)
+  show   - Show the settings of a profile
+  edit   - Change settings of a profile
+  delete - Delete a profile
+  diff   - Compare two profiles, or a profile with the current configuration
+
+Examples:
+  claude-foundry-manager profile create dev --resource=my-dev-foundry --api-key=sk-xxx
+  claude-foundry-manager profile create prod --from-current
+  claude-foundry-manager profile diff dev prod
+  claude-foundry-manager use dev`,
+}
+
+var profileCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Save a new profile",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p := &profiles.Profile{Name: args[0], Description: profileFlags.description}
+
+		if profileFlags.fromCurrent {
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			current, err := config.GetCurrentConfig(store)
+			if err != nil {
+				return fmt.Errorf("failed to read configuration: %w", err)
+			}
+			if !current.UseFoundry {
+				return fmt.Errorf("Azure Foundry is not configured, nothing to save")
+			}
+			p.Foundry = &config.FoundryConfig{
+				Resource:    current.Resource,
+				BaseURL:     current.BaseURL,
+				APIKey:      current.APIKey,
+				SonnetModel: current.SonnetModel,
+				HaikuModel:  current.HaikuModel,
+				OpusModel:   current.OpusModel,
+			}
+		} else {
+			p.Foundry = &config.FoundryConfig{
+				SonnetModel: "claude-sonnet-4-5",
+				HaikuModel:  "claude-haiku-4-5",
+				OpusModel:   "claude-opus-4-5",
+			}
+		}
+
+		applyProfileFlags(cmd, p)
+		if err := validateFoundry(p.Foundry); err != nil {
+			return err
+		}
+
+		if err := profiles.CreateProfile(p); err != nil {
+			return fmt.Errorf("failed to create profile: %w", err)
+		}
+
+		fmt.Printf("\n✓ Profile created: %s\n", p.Name)
+		fmt.Printf("Apply it with: claude-foundry-manager use %s\n\n", p.Name)
+		return nil
+	},
+}
+
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List profiles",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		list, err := profiles.ListProfiles()
+		if err != nil {
+			return fmt.Errorf("failed to list profiles: %w", err)
+		}
+
+		current := currentVars()
+
+		fmt.Printf("\n=== Profiles (%d total) ===\n\n", len(list))
+		for _, p := range list {
+			marker := " "
+			if current != nil && p.Matches(current) {
+				marker = "*"
+			}
+			fmt.Printf("%s %-20s %s\n", marker, p.Name, profileSummary(p))
+		}
+
+		fmt.Printf("\n* = matches the current configuration\n")
+		fmt.Printf("Profile location: %s\n\n", profiles.GetProfileDir())
+		return nil
+	},
+}
+
+var profileShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "Show the settings of a profile",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := profiles.LoadProfile(args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("\n=== Profile: %s ===\n", p.Name)
+		if p.Description != "" {
+			fmt.Printf("Description: %s\n", p.Description)
+		}
+		if p.IsAnthropic() {
+			fmt.Println("Uses the direct Anthropic API (no Foundry variables).")
+			fmt.Println()
+			return nil
+		}
+
+		fmt.Println("\nEnvironment Variables:")
+		vars := p.Vars()
+		for _, key := range config.ManagedKeys() {
+			fmt.Printf("  %-31s %s\n", key+":", formatEnvValue(maskIfSecret(key, vars[key])))
+		}
+		fmt.Printf("\nCreated: %s\n", p.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("Updated: %s\n\n", p.UpdatedAt.Format("2006-01-02 15:04:05"))
+		return nil
+	},
+}
+
+var profileEditCmd = &cobra.Command{
+	Use:   "edit <name>",
+	Short: "Change settings of a profile",
+	Long: `Change settings of a saved profile. Only the given flags are changed;
+pass an empty value (e.g. --api-key="") to clear a setting.
+
+Example:
+  claude-foundry-manager profile edit dev --opus-model=claude-opus-4-1`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := profiles.LoadProfile(args[0])
+		if err != nil {
+			return err
+		}
+		if p.IsAnthropic() {
+			return fmt.Errorf("the built-in %q profile cannot be changed", profiles.AnthropicProfile)
+		}
+
+		// Switching between resource and base URL replaces the other one
+		if cmd.Flags().Changed("resource") {
+			p.Foundry.BaseURL = ""
+		}
+		if cmd.Flags().Changed("base-url") {
+			p.Foundry.Resource = ""
+		}
+		applyProfileFlags(cmd, p)
+		if err := validateFoundry(p.Foundry); err != nil {
+			return err
+		}
+
+		if err := profiles.SaveProfile(p); err != nil {
+			return fmt.Errorf("failed to save profile: %w", err)
+		}
+
+		fmt.Printf("\n✓ Profile updated: %s\n\n", p.Name)
+		return nil
+	},
+}
+
+var profileDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a profile",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := profiles.DeleteProfile(args[0]); err != nil {
+			return fmt.Errorf("failed to delete profile: %w", err)
+		}
+
+		fmt.Printf("\n✓ Profile deleted: %s\n\n", args[0])
+		return nil
+	},
+}
+
+var profileDiffCmd = &cobra.Command{
+	Use:   "diff <name> [other]",
+	Short: "Compare two profiles, or a profile with the current configuration",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		a, err := profiles.LoadProfile(args[0])
+		if err != nil {
+			return err
+		}
+
+		otherName := "current"
+		var other map[string]string
+		if len(args) == 2 {
+			b, err := profiles.LoadProfile(args[1])
+			if err != nil {
+				return err
+			}
+			otherName = b.Name
+			other = b.Vars()
+		} else {
+			if other = currentVars(); other == nil {
+				return fmt.Errorf("failed to read the current configuration")
+			}
+		}
+
+		diffs := profiles.Diff(a.Vars(), other)
+		if len(diffs) == 0 {
+			fmt.Printf("\n%s and %s are identical.\n\n", a.Name, otherName)
+			return nil
+		}
+
+		fmt.Printf("\n=== %s vs %s ===\n\n", a.Name, otherName)
+		for _, d := range diffs {
+			fmt.Printf("  %s\n", d.Key)
+			fmt.Printf("    %-10s %s\n", a.Name+":", formatEnvValue(maskIfSecret(d.Key, d.A)))
+			fmt.Printf("    %-10s %s\n", otherName+":", formatEnvValue(maskIfSecret(d.Key, d.B)))
+		}
+		fmt.Println()
+		return nil
+	},
+}
+
+var useCmd = &cobra.Command{
+	Use:   "use <profile>",
+	Short: "Apply a named profile",
+	Long: `Apply a saved profile, replacing the current configuration.
+
+"use anthropic" rolls back to the direct Anthropic API.
+
+Examples:
+  claude-foundry-manager use dev
+  claude-foundry-manager use anthropic`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, err := profiles.LoadProfile(args[0])
+		if err != nil {
+			return err
+		}
+
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+
+		// Create backup before making changes
+		if err := backup.CreateAutoBackup(store, fmt.Sprintf("Before using profile %s", p.Name)); err != nil {
+			warnBackup(err)
+		}
+
+		if err := profiles.Apply(store, p); err != nil {
+			return fmt.Errorf("failed to apply profile: %w", err)
+		}
+		if p.IsAnthropic() || p.Foundry.APIKey != "" {
+			if err := unwireKeyHelper(); err != nil {
+				return err
+			}
+		}
+
+		fmt.Printf("\n✓ Now using profile: %s\n", p.Name)
+		fmt.Println("\nPlease restart your terminal for the changes to take effect.")
+		return nil
+	},
+}
+
+// applyProfileFlags copies the flags the user set onto p
+func applyProfileFlags(cmd *cobra.Command, p *profiles.Profile) {
+	set := func(flag string, field *string, value string) {
+		if cmd.Flags().Changed(flag) {
+			*field = value
+		}
+	}
+	set("description", &p.Description, profileFlags.description)
+	set("resource", &p.Foundry.Resource, profileFlags.resource)
+	set("base-url", &p.Foundry.BaseURL, profileFlags.baseURL)
+	set("api-key", &p.Foundry.APIKey, profileFlags.apiKey)
+	set("sonnet-model", &p.Foundry.SonnetModel, profileFlags.sonnetModel)
+	set("haiku-model", &p.Foundry.HaikuModel, profileFlags.haikuModel)
+	set("opus-model", &p.Foundry.OpusModel, profileFlags.opusModel)
+}
+
+// validateFoundry checks that exactly one of resource and base URL is set
+func validateFoundry(cfg *config.FoundryConfig) error {
+	if cfg.Resource == "" && cfg.BaseURL == "" {
+		return fmt.Errorf("either --resource or --base-url is required")
+	}
+	if cfg.Resource != "" && cfg.BaseURL != "" {
+		return fmt.Errorf("cannot specify both --resource and --base-url, choose one")
+	}
+	return nil
+}
+
+// currentVars returns the current configuration, or nil if it cannot be read
+func currentVars() map[string]string {
+	store, err := openStore()
+	if err != nil {
+		return nil
+	}
+	vars, err := store.List()
+	if err != nil {
+		return nil
+	}
+	return vars
+}
+
+// profileSummary describes a profile in one line
+func profileSummary(p *profiles.Profile) string {
+	summary := "(default Anthropic)"
+	if !p.IsAnthropic() {
+		summary = "resource: " + p.Foundry.Resource
+		if p.Foundry.BaseURL != "" {
+			summary = "base URL: " + p.Foundry.BaseURL
+		}
+	}
+	if p.Description != "" {
+		summary += " - " + p.Description
+	}
+	return summary
+}
+
+// addProfileFlags registers the settings flags of profile create and edit
+func addProfileFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&profileFlags.description, "description", "", "Description of the profile")
+	cmd.Flags().StringVar(&profileFlags.resource, "resource", "", "Azure Foundry resource name (mutually exclusive with --base-url)")
+	cmd.Flags().StringVar(&profileFlags.baseURL, "base-url", "", "Full Azure Foundry base URL (mutually exclusive with --resource)")
+	cmd.Flags().StringVar(&profileFlags.apiKey, "api-key", "", "Azure Foundry API key (optional, uses Entra ID if not provided)")
+	cmd.Flags().StringVar(&profileFlags.sonnetModel, "sonnet-model", "", "Sonnet model deployment name (default: claude-sonnet-4-5)")
+	cmd.Flags().StringVar(&profileFlags.haikuModel, "haiku-model", "", "Haiku model deployment name (default: claude-haiku-4-5)")
+	cmd.Flags().StringVar(&profileFlags.opusModel, "opus-model", "", "Opus model deployment name (default: claude-opus-4-5)")
+	cmd.MarkFlagsMutuallyExclusive("resource", "base-url")
+}
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	rootCmd.AddCommand(useCmd)
+	profileCmd.AddCommand(profileCreateCmd)
+	profileCmd.AddCommand(profileListCmd)
+	profileCmd.AddCommand(profileShowCmd)
+	profileCmd.AddCommand(profileEditCmd)
+	profileCmd.AddCommand(profileDeleteCmd)
+	profileCmd.AddCommand(profileDiffCmd)
+
+	addProfileFlags(profileCreateCmd)
+	addProfileFlags(profileEditCmd)
+	profileCreateCmd.Flags().BoolVar(&profileFlags.fromCurrent, "from-current", false, "Start from the current configuration")
+
+	addShellsFlag(useCmd)
+}
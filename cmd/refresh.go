@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/gilbe/claude-foundry-manager/internal/backup"
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+	"github.com/gilbe/claude-foundry-manager/internal/secrets"
+	"github.com/spf13/cobra"
+)
+
+var refreshDryRun bool
+
+var refreshSecretsCmd = &cobra.Command{
+	Use:   "refresh-secrets",
+	Short: "Pull keys again from their secret references",
+	Long: `Resolve the secret references the configuration was set from (env:, file:,
+cmd: and keyvault:) again and update the variables whose key changed, e.g.
+after it was rotated in Azure Key Vault.
+
+A variable changed some other way since it was set from its reference is
+left alone.
+
+Examples:
+  claude-foundry-manager configure --resource=my-foundry --api-key=keyvault:myvault/foundry-key
+  claude-foundry-manager refresh-secrets
+  claude-foundry-manager refresh-secrets --dry-run`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		refs, err := config.SecretRefs()
+		if err != nil {
+			return err
+		}
+		if len(refs) == 0 {
+			fmt.Println("No secret references recorded. Configure the key with e.g. --api-key=keyvault:VAULT/SECRET first.")
+			return nil
+		}
+
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+
+		keys := make([]string, 0, len(refs))
+		for key := range refs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		updated := map[string]string{}
+		failed := 0
+		for _, key := range keys {
+			ref := refs[key].Ref
+			current, err := store.Get(key)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", key, err)
+			}
+			if config.SecretRefFor(refs, key, current) == "" {
+				fmt.Printf("  %s: changed since it was set from %s, skipped\n", key, ref)
+				continue
+			}
+
+			value, err := secrets.Resolve(ref)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "  %s: %v\n", key, err)
+				failed++
+				continue
+			}
+			if value == current {
+				fmt.Printf("  %s: up to date (%s)\n", key, ref)
+				continue
+			}
+			fmt.Printf("  %s: new value from %s\n", key, ref)
+			updated[key] = value
+		}
+
+		if len(updated) > 0 && !refreshDryRun {
+			if err := backup.CreateAutoBackup(store, "Before refreshing secrets"); err != nil {
+				warnBackup(err)
+			}
+			tx := config.Begin(store)
+			for key, value := range updated {
+				tx.Set(key, value)
+			}
+			if err := tx.Commit(); err != nil {
+				return fmt.Errorf("failed to update secrets: %w", err)
+			}
+			for key, value := range updated {
+				if err := config.RecordSecretRef(key, refs[key].Ref, value); err != nil {
+					return err
+				}
+			}
+			fmt.Printf("\n✓ Updated %d variable(s)\n", len(updated))
+			fmt.Println("\nPlease restart your terminal for the changes to take effect.")
+		} else if len(updated) > 0 {
+			fmt.Printf("\n%d variable(s) would be updated (dry run)\n", len(updated))
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d secret reference(s) could not be resolved", failed)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(refreshSecretsCmd)
+
+	refreshSecretsCmd.Flags().BoolVar(&refreshDryRun, "dry-run", false, "Show which variables would change without writing them")
+	addShellsFlag(refreshSecretsCmd)
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/gilbe/claude-foundry-manager/internal/backup"
 	"github.com/gilbe/claude-foundry-manager/internal/config"
@@ -16,21 +15,33 @@ var rollbackCmd = &cobra.Command{
 
 This command will:
   1. Create a backup of current settings
-  2. Remove all Azure Foundry environment variables
+  2. Remove the variables of every provider (Azure Foundry, Bedrock, Vertex
+     and gateway) along with the model overrides
   3. Restore default Claude Code behavior (direct Anthropic API)
 
-Example:
-  claude-foundry-manager rollback`,
+Examples:
+  claude-foundry-manager rollback
+
+  # Remove the configuration from the zsh and bash profiles
+  claude-foundry-manager rollback --shells=zsh,bash`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+
 		// Create backup before rolling back
-		if err := backup.CreateAutoBackup("Before rollback to default"); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: Failed to create backup: %v\n", err)
+		if err := backup.CreateAutoBackup(store, "Before rollback to default"); err != nil {
+			warnBackup(err)
 		}
 
-		// Remove all Foundry configuration
-		if err := config.RollbackToDefault(); err != nil {
+		// Remove the configuration of every provider
+		if err := config.RollbackToDefault(store); err != nil {
 			return fmt.Errorf("failed to rollback: %w", err)
 		}
+		if err := unwireKeyHelper(); err != nil {
+			return err
+		}
 
 		fmt.Println("\n✓ Successfully rolled back to default Anthropic configuration!")
 		fmt.Println("\nPlease restart your terminal for the changes to take effect.")
@@ -41,4 +52,6 @@ Example:
 
 func init() {
 	rootCmd.AddCommand(rollbackCmd)
+
+	addShellsFlag(rollbackCmd)
 }
@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/gilbe/claude-foundry-manager/internal/backup"
+	"github.com/gilbe/claude-foundry-manager/internal/config"
 	"github.com/gilbe/claude-foundry-manager/internal/ui"
 	"github.com/spf13/cobra"
 )
@@ -15,18 +20,173 @@ var rootCmd = &cobra.Command{
 
 This tool helps you easily switch between providers by managing environment variables across Windows, Linux, and macOS.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		store, err := openStore()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
 		// If no subcommand is provided, run interactive mode
-		if err := ui.RunInteractive(); err != nil {
+		backup.Command = cmd.CommandPath() + " (interactive)"
+		if err := ui.RunInteractive(store); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
 	},
 }
 
+// shellName selects the shell profile to manage (--shell)
+var shellName string
+
+// shellSet selects several shell profiles to write at once (--shells)
+var shellSet string
+
+// storageMode selects inline or file storage for shell profiles (--storage)
+var storageMode string
+
+// settingsScope selects a Claude Code settings file instead of the shell
+// profiles (--settings)
+var settingsScope string
+
+// addShellsFlag registers --shells on commands that write the configuration
+func addShellsFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&shellSet, "shells", "",
+		"Write to several shell profiles: all, detected, or a list such as zsh,bash")
+}
+
+// openStore returns the environment store commands operate on, switched to
+// the storage mode requested with --storage
+func openStore() (config.EnvStore, error) {
+	if settingsScope != "" {
+		return openSettingsStore()
+	}
+
+	store, err := openShellStore()
+	if err != nil || storageMode == "" {
+		return store, err
+	}
+
+	mode, err := config.ParseStorage(storageMode)
+	if err != nil {
+		return nil, err
+	}
+	profile, ok := store.(interface{ SetStorage(config.Storage) })
+	if !ok {
+		return nil, fmt.Errorf("--storage is only supported for shell profiles")
+	}
+	profile.SetStorage(mode)
+	return store, nil
+}
+
+// openShellStore returns the store selected by --shell or --shells, or the
+// platform default
+func openShellStore() (config.EnvStore, error) {
+	if shellSet != "" {
+		if shellName != "" {
+			return nil, fmt.Errorf("--shell and --shells cannot be used together")
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+		store, err := config.ShellsStore(home, shellSet)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	if shellName != "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+		store, err := config.NewShellStore(home, shellName)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	return config.DefaultStore()
+}
+
+// openSettingsStore returns the settings file selected by --settings
+func openSettingsStore() (config.EnvStore, error) {
+	if shellName != "" || shellSet != "" || storageMode != "" {
+		return nil, fmt.Errorf("--settings cannot be combined with --shell, --shells or --storage")
+	}
+	scope, err := config.ParseSettingsScope(settingsScope)
+	if err != nil {
+		return nil, err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	return config.NewSettingsStore(config.SettingsPath(scope, home, config.ProjectRoot(cwd))), nil
+}
+
+// offerGitignore asks to add .claude/settings.local.json to .gitignore once
+// the local settings file exists in a git repository, since it may hold an
+// API key and is meant to stay on this machine
+func offerGitignore() {
+	if settingsScope != string(config.SettingsLocal) {
+		return
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	root := config.ProjectRoot(cwd)
+	if _, err := os.Stat(filepath.Join(root, ".git")); err != nil {
+		return
+	}
+	entry := filepath.Join(".claude", "settings.local.json")
+	if _, err := os.Stat(filepath.Join(root, entry)); err != nil {
+		return
+	}
+	if covered, err := config.GitignoreCovers(root, entry); err != nil || covered {
+		return
+	}
+
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		fmt.Printf("\nNote: %s is not in .gitignore; add it so it is never committed.\n", filepath.ToSlash(entry))
+		return
+	}
+	fmt.Printf("\nAdd %s to .gitignore so it is never committed? [Y/n]: ", filepath.ToSlash(entry))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "" && answer != "y" && answer != "yes" {
+		return
+	}
+	if err := config.AddToGitignore(root, entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to update .gitignore: %v\n", err)
+		return
+	}
+	fmt.Println("✓ Added to .gitignore")
+}
+
 func Execute() error {
 	return rootCmd.Execute()
 }
 
 func init() {
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	backup.PassphraseFunc = ui.ReadPassword
+	backup.ConfirmCommandFunc = confirmBackupCommand
+
+	rootCmd.PersistentFlags().StringVar(&shellName, "shell", "",
+		fmt.Sprintf("Shell profile to manage instead of the detected one (%s)", strings.Join(config.SupportedShells(), ", ")))
+	rootCmd.PersistentFlags().StringVar(&settingsScope, "settings", "",
+		"Write to the env of a Claude Code settings file instead of the shell profile: user (~/.claude/settings.json), project (.claude/settings.json) or local (.claude/settings.local.json)")
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		backup.Command = cmd.CommandPath()
+	}
+	rootCmd.PersistentPostRun = func(cmd *cobra.Command, args []string) {
+		offerGitignore()
+	}
+	rootCmd.PersistentFlags().StringVar(&storageMode, "storage", "",
+		"Keep variables inline in the shell profile (inline) or in a managed env file it sources (file); the current mode is kept by default")
 }
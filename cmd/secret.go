@@ -0,0 +1,354 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gilbe/claude-foundry-manager/internal/backup"
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+	"github.com/gilbe/claude-foundry-manager/internal/secrets"
+	"github.com/gilbe/claude-foundry-manager/internal/ui"
+	"github.com/spf13/cobra"
+)
+
+var (
+	secretBackend   string
+	secretPassEntry string
+	secretCommand   string
+)
+
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "Keep the API key out of the shell profile",
+	Long: `Store the Azure Foundry API key outside the shell profile and let Claude Code
+ask for it through its apiKeyHelper setting.
+
+The key is kept in one of these backends:
+  file     AES-256-GCM encrypted file in ~/.config/claude-foundry-manager/secrets (default)
+  pass     an entry of the pass password manager (--pass-entry)
+  command  the output of a command of your own (--command), e.g. a vault CLI
+
+apiKeyHelper is written to ~/.claude/settings.json, or to the settings file
+chosen with --settings, as "claude-foundry-manager secret get".
+
+Examples:
+  # Store a key read from stdin and wire apiKeyHelper
+  echo "$KEY" | claude-foundry-manager secret set
+
+  # Move the plaintext key out of the shell profile
+  claude-foundry-manager secret migrate
+
+  # Read the key from 1Password instead
+  claude-foundry-manager secret set --backend=command --command="op read op://dev/foundry/key"`,
+}
+
+var secretGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Print the API key (used by apiKeyHelper)",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := secrets.OpenDefault()
+		if err != nil {
+			return err
+		}
+		key, err := store.Get()
+		if err != nil {
+			return err
+		}
+		fmt.Println(key)
+		return nil
+	},
+}
+
+var secretSetCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Store the API key and wire apiKeyHelper",
+	Long: `Store the API key in the chosen backend and point apiKeyHelper at it. The key
+is read from stdin; the command backend reads it from its command instead.
+A plaintext ANTHROPIC_FOUNDRY_API_KEY left in the shell profile is removed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		settings, err := secretSettings(cmd)
+		if err != nil {
+			return err
+		}
+		if settings.Backend == secrets.BackendCommand {
+			return useSecretBackend(settings, "")
+		}
+		key, err := readSecret("API key: ")
+		if err != nil {
+			return err
+		}
+		return useSecretBackend(settings, key)
+	},
+}
+
+var secretRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Replace the API key, re-encrypting it under a new key",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := secrets.OpenDefault()
+		if err != nil {
+			return err
+		}
+		key, err := readSecret("New API key: ")
+		if err != nil {
+			return err
+		}
+		if err := secrets.Rotate(store, key); err != nil {
+			return fmt.Errorf("failed to rotate API key: %w", err)
+		}
+		fmt.Printf("✓ API key rotated in %s\n", store.Describe())
+		return nil
+	},
+}
+
+var secretDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "Delete the stored API key and remove apiKeyHelper",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		settings, err := secrets.LoadSettings()
+		if err != nil {
+			return err
+		}
+		if settings.Backend != secrets.BackendCommand {
+			store, err := secrets.Open(settings)
+			if err != nil {
+				return err
+			}
+			if err := store.Delete(); err != nil {
+				return fmt.Errorf("failed to delete API key: %w", err)
+			}
+		}
+
+		helper, err := helperSettingsStore()
+		if err != nil {
+			return err
+		}
+		if err := secrets.UnwireHelper(helper); err != nil {
+			return fmt.Errorf("failed to remove apiKeyHelper: %w", err)
+		}
+		fmt.Println("✓ API key deleted and apiKeyHelper removed")
+		return nil
+	},
+}
+
+var secretMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Move a plaintext API key from the shell profile to the secret backend",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		settings, err := secretSettings(cmd)
+		if err != nil {
+			return err
+		}
+		if settings.Backend == secrets.BackendCommand {
+			return fmt.Errorf("the command backend cannot store a key, use the file or pass backend")
+		}
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		key, err := store.Get(config.EnvFoundryAPIKey)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", config.EnvFoundryAPIKey, err)
+		}
+		if key == "" {
+			return fmt.Errorf("no %s is set, nothing to migrate", config.EnvFoundryAPIKey)
+		}
+		return useSecretBackend(settings, key)
+	},
+}
+
+// secretSettings returns the backend chosen with --backend, or the saved one
+func secretSettings(cmd *cobra.Command) (secrets.Settings, error) {
+	settings, err := secrets.LoadSettings()
+	if err != nil {
+		return secrets.Settings{}, err
+	}
+	if cmd.Flags().Changed("backend") {
+		settings = secrets.Settings{Backend: secretBackend}
+	}
+	if cmd.Flags().Changed("pass-entry") {
+		settings.PassEntry = secretPassEntry
+	}
+	if cmd.Flags().Changed("command") {
+		settings.Command = secretCommand
+	}
+	return settings, nil
+}
+
+// useSecretBackend stores key in the backend, wires apiKeyHelper and
+// removes the plaintext key from the store
+func useSecretBackend(settings secrets.Settings, key string) error {
+	if _, err := storeSecret(settings, key); err != nil {
+		return err
+	}
+	return removePlaintextKey()
+}
+
+// storeSecret saves the backend settings, stores key in it unless it is
+// empty, and wires apiKeyHelper. Without a key, the backend must already
+// hold one. The returned undo puts the backend settings, the key and
+// apiKeyHelper back as they were, for when a change depending on them fails.
+func storeSecret(settings secrets.Settings, key string) (undo func() error, err error) {
+	previousSettings, err := secrets.LoadSettings()
+	if err != nil {
+		return nil, err
+	}
+	helper, err := helperSettingsStore()
+	if err != nil {
+		return nil, err
+	}
+	wired, err := secrets.HelperWired(helper)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := secrets.SaveSettings(settings); err != nil {
+		return nil, err
+	}
+	store, err := secrets.Open(settings)
+	if err != nil {
+		return nil, err
+	}
+	previous := ""
+	if key != "" {
+		previous, _ = store.Get()
+		if err := store.Set(key); err != nil {
+			return nil, fmt.Errorf("failed to store API key: %w", err)
+		}
+	} else if _, err := store.Get(); err != nil {
+		return nil, fmt.Errorf("failed to read API key from %s: %w", store.Describe(), err)
+	}
+
+	if err := secrets.WireHelper(helper); err != nil {
+		return nil, fmt.Errorf("failed to set apiKeyHelper: %w", err)
+	}
+	fmt.Printf("✓ API key kept in %s\n", store.Describe())
+	fmt.Printf("✓ apiKeyHelper set in %s\n", helper.Path())
+
+	undo = func() error {
+		if !wired {
+			if err := secrets.UnwireHelper(helper); err != nil {
+				return fmt.Errorf("failed to remove apiKeyHelper: %w", err)
+			}
+		}
+		switch {
+		case key == "":
+		case previous != "":
+			if err := store.Set(previous); err != nil {
+				return fmt.Errorf("failed to put back the previous API key: %w", err)
+			}
+		default:
+			if err := store.Delete(); err != nil {
+				return fmt.Errorf("failed to delete API key: %w", err)
+			}
+		}
+		return secrets.SaveSettings(previousSettings)
+	}
+	return undo, nil
+}
+
+// removePlaintextKey deletes ANTHROPIC_FOUNDRY_API_KEY from the store, now
+// that apiKeyHelper provides the key
+func removePlaintextKey() error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	if value, err := store.Get(config.EnvFoundryAPIKey); err != nil || value == "" {
+		return err
+	}
+
+	if err := backup.CreateAutoBackup(store, "Before moving the API key to apiKeyHelper"); err != nil {
+		warnBackup(err)
+	}
+	tx := config.Begin(store)
+	tx.Delete(config.EnvFoundryAPIKey)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", config.EnvFoundryAPIKey, err)
+	}
+	fmt.Printf("✓ Removed the plaintext %s\n", config.EnvFoundryAPIKey)
+	fmt.Println("\nOlder backups may still hold the key; delete them if that matters.")
+	fmt.Println("Please restart your terminal for the changes to take effect.")
+	return nil
+}
+
+// unwireKeyHelper removes the apiKeyHelper this tool set, once the
+// configuration no longer takes the Foundry key from the secret backend:
+// after a rollback, a switch to another provider or a plain --api-key
+func unwireKeyHelper() error {
+	helper, err := helperSettingsStore()
+	if err != nil {
+		return err
+	}
+	if wired, err := secrets.HelperWired(helper); err != nil || !wired {
+		return err
+	}
+	if err := secrets.UnwireHelper(helper); err != nil {
+		return fmt.Errorf("failed to remove apiKeyHelper: %w", err)
+	}
+	fmt.Printf("✓ apiKeyHelper removed from %s\n", helper.Path())
+	return nil
+}
+
+// helperSettingsStore returns the settings file apiKeyHelper is written to:
+// the one chosen with --settings, or the user settings
+func helperSettingsStore() (*config.SettingsStore, error) {
+	if settingsScope != "" {
+		store, err := openSettingsStore()
+		if err != nil {
+			return nil, err
+		}
+		return store.(*config.SettingsStore), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return config.NewSettingsStore(config.SettingsPath(config.SettingsUser, home, "")), nil
+}
+
+// readSecret reads a secret from stdin, prompting without echo when it is
+// a terminal
+func readSecret(prompt string) (string, error) {
+	var value string
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		line, err := ui.ReadPassword(prompt)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("failed to read API key: %w", err)
+		}
+		value = line
+	} else {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", fmt.Errorf("failed to read API key: %w", err)
+		}
+		value = string(data)
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", fmt.Errorf("no API key given on stdin")
+	}
+	return value, nil
+}
+
+func init() {
+	rootCmd.AddCommand(secretCmd)
+	secretCmd.AddCommand(secretGetCmd, secretSetCmd, secretRotateCmd, secretDeleteCmd, secretMigrateCmd)
+
+	for _, cmd := range []*cobra.Command{secretSetCmd, secretMigrateCmd} {
+		cmd.Flags().StringVar(&secretBackend, "backend", secrets.BackendFile, "Where to keep the key: file, pass or command")
+		cmd.Flags().StringVar(&secretPassEntry, "pass-entry", secrets.DefaultPassEntry, "pass entry holding the key (pass backend)")
+		cmd.Flags().StringVar(&secretCommand, "command", "", "Command printing the key (command backend)")
+	}
+	addShellsFlag(secretSetCmd)
+	addShellsFlag(secretMigrateCmd)
+}
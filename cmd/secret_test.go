@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+	"github.com/gilbe/claude-foundry-manager/internal/secrets"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// resetFlags puts every flag back to its default, as cobra keeps the
+// values of one Execute for the next
+func resetFlags() {
+	var reset func(cmd *cobra.Command)
+	reset = func(cmd *cobra.Command) {
+		for _, flags := range []*pflag.FlagSet{cmd.Flags(), cmd.PersistentFlags()} {
+			flags.VisitAll(func(f *pflag.Flag) {
+				if slice, ok := f.Value.(pflag.SliceValue); ok {
+					slice.Replace(nil)
+				} else {
+					f.Value.Set(f.DefValue)
+				}
+				f.Changed = false
+			})
+		}
+		for _, child := range cmd.Commands() {
+			reset(child)
+		}
+	}
+	reset(rootCmd)
+}
+
+func TestProviderChangesUnwireKeyHelper(t *testing.T) {
+	cases := [][]string{
+		{"rollback"},
+		{"configure", "--provider=bedrock", "--region=us-east-1"},
+		{"configure", "--resource=res", "--api-key=sk-plain-key"},
+	}
+	for _, args := range cases {
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		t.Setenv("USERPROFILE", home)
+		t.Setenv("SHELL", "/bin/bash")
+		if err := os.WriteFile(filepath.Join(home, ".bashrc"), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		settings := config.NewSettingsStore(filepath.Join(home, ".claude", "settings.json"))
+		if err := secrets.WireHelper(settings); err != nil {
+			t.Fatal(err)
+		}
+
+		resetFlags()
+		rootCmd.SetArgs(args)
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("%v failed: %v", args, err)
+		}
+		if wired, _ := secrets.HelperWired(settings); wired {
+			t.Errorf("Expected %v to remove apiKeyHelper", args)
+		}
+	}
+}
@@ -2,71 +2,288 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"sort"
 
 	"github.com/gilbe/claude-foundry-manager/internal/config"
+	"github.com/gilbe/claude-foundry-manager/internal/layers"
+	"github.com/gilbe/claude-foundry-manager/internal/secrets"
 	"github.com/spf13/cobra"
 )
 
+var showLayers bool
+
 var showCmd = &cobra.Command{
 	Use:   "show",
 	Short: "Show current configuration",
 	Long: `Display the current Claude Code configuration, including all Azure Foundry environment variables.
 
-This command shows:
-  - Whether Azure Foundry is enabled
-  - Azure Foundry resource name
-  - Base URL
-  - API key status (masked for security)
+The values shown are the persisted ones (shell profile or registry), which
+may not be loaded in the current shell yet. This command shows:
+  - The provider in use (Azure Foundry, Bedrock, Vertex, a gateway or the
+    direct Anthropic API) and any other provider that is enabled as well
+  - The provider's variables, with keys and tokens masked
   - Model deployment names
+  - Extra variables set with configure --env
+  - Where the API key is kept when apiKeyHelper provides it
+  - The file and line each variable is persisted in
+  - Variables whose value in this shell differs from the persisted one, or
+    that are also set outside the managed block (e.g. in ~/.zshenv)
+
+With --layers, show the configuration layers instead (system, team, user
+and project files) and which layer supplied each setting.
 
 Example:
-  claude-foundry-manager show`,
+  claude-foundry-manager show
+  claude-foundry-manager show --layers`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg, err := config.GetCurrentConfig()
+		if showLayers {
+			return showLayerResolution()
+		}
+
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+
+		cfg, err := config.GetCurrentConfig(store)
 		if err != nil {
 			return fmt.Errorf("failed to read configuration: %w", err)
 		}
 
 		fmt.Println("\n=== Current Claude Code Configuration ===")
 
-		if cfg.UseFoundry {
-			fmt.Println("Status: Azure Foundry ENABLED")
-		} else {
-			fmt.Println("Status: Azure Foundry DISABLED")
+		fmt.Printf("Provider: %s\n", cfg.Provider.Title())
+		for _, p := range cfg.Conflicts {
+			fmt.Printf("Warning: %s is enabled as well, run configure or rollback to remove it\n", p.Title())
 		}
 
-		// Always show environment variable values
-		fmt.Println("\nEnvironment Variables:")
-		fmt.Printf("  CLAUDE_CODE_USE_FOUNDRY:        %s\n", formatValue(cfg.UseFoundry))
-
-		if cfg.Resource != "" {
-			fmt.Printf("  ANTHROPIC_FOUNDRY_RESOURCE:     %s\n", formatEnvValue(cfg.Resource))
-			fmt.Printf("  ANTHROPIC_FOUNDRY_BASE_URL:     %s (auto-generated)\n", formatEnvValue(cfg.BaseURL))
-		} else {
-			fmt.Printf("  ANTHROPIC_FOUNDRY_RESOURCE:     %s\n", formatEnvValue(""))
-			fmt.Printf("  ANTHROPIC_FOUNDRY_BASE_URL:     %s\n", formatEnvValue(cfg.BaseURL))
-		}
+		showProviderVars(cfg.Provider, cfg.Settings)
+		showKeyHelper()
 
-		if cfg.APIKey != "" {
-			fmt.Printf("  ANTHROPIC_FOUNDRY_API_KEY:      %s... (masked)\n", maskAPIKey(cfg.APIKey))
-		} else {
-			fmt.Printf("  ANTHROPIC_FOUNDRY_API_KEY:      %s\n", formatEnvValue(""))
+		if len(cfg.Extra) > 0 {
+			fmt.Println("\nExtra Variables:")
+			keys := make([]string, 0, len(cfg.Extra))
+			for key := range cfg.Extra {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				fmt.Printf("  %-31s %s\n", key+":", maskIfSecret(key, cfg.Extra[key]))
+			}
 		}
 
-		fmt.Printf("\nModel Deployments:\n")
-		fmt.Printf("  ANTHROPIC_DEFAULT_SONNET_MODEL: %s\n", formatEnvValue(cfg.SonnetModel))
-		fmt.Printf("  ANTHROPIC_DEFAULT_HAIKU_MODEL:  %s\n", formatEnvValue(cfg.HaikuModel))
-		fmt.Printf("  ANTHROPIC_DEFAULT_OPUS_MODEL:   %s\n", formatEnvValue(cfg.OpusModel))
-
-		if !cfg.UseFoundry {
+		if cfg.Provider == config.Anthropic {
 			fmt.Println("\nNote: Using default Anthropic direct API configuration.")
 		}
 
+		showVarStatus(cfg.Vars)
+		showShellProfiles()
+
 		fmt.Println()
 		return nil
 	},
 }
 
+// showProviderVars prints the variables of the provider, with the model
+// overrides in a section of their own
+func showProviderVars(provider config.Provider, settings map[string]string) {
+	models := map[string]bool{
+		config.EnvDefaultSonnet: true,
+		config.EnvDefaultHaiku:  true,
+		config.EnvDefaultOpus:   true,
+	}
+
+	if provider != config.Anthropic {
+		fmt.Println("\nEnvironment Variables:")
+		for _, key := range provider.Keys() {
+			if !models[key] {
+				fmt.Printf("  %-31s %s\n", key+":", formatEnvValue(maskIfSecret(key, settings[key])))
+			}
+		}
+	}
+
+	fmt.Printf("\nModel Deployments:\n")
+	for _, key := range provider.Keys() {
+		if models[key] {
+			fmt.Printf("  %-31s %s\n", key+":", formatEnvValue(settings[key]))
+		}
+	}
+}
+
+// showKeyHelper tells where the API key comes from when apiKeyHelper runs
+// "secret get"
+func showKeyHelper() {
+	helper, err := helperSettingsStore()
+	if err != nil {
+		return
+	}
+	if wired, err := secrets.HelperWired(helper); err != nil || !wired {
+		return
+	}
+	store, err := secrets.OpenDefault()
+	if err != nil {
+		fmt.Printf("\nAPI Key: via apiKeyHelper in %s (%v)\n", helper.Path(), err)
+		return
+	}
+	fmt.Printf("\nAPI Key: via apiKeyHelper in %s, kept in %s\n", helper.Path(), store.Describe())
+}
+
+// showLayerResolution prints each configuration layer and the layer every
+// setting resolves from
+func showLayerResolution() error {
+	locations, err := layers.DefaultLocations()
+	if err != nil {
+		return err
+	}
+	loaded, err := locations.Load()
+	if err != nil {
+		return err
+	}
+	resolved := layers.Resolve(loaded)
+
+	fmt.Println("\n=== Configuration Layers (lowest priority first) ===")
+	for _, layer := range loaded {
+		state := fmt.Sprintf("%d settings", len(layer.Values))
+		if !layer.Exists {
+			state = "not found"
+		}
+		fmt.Printf("  %-8s %s (%s)\n", layer.Scope, layer.Path, state)
+	}
+
+	fmt.Println("\nResolved Settings:")
+	values := layers.ValuesOf(&resolved.Config)
+	for _, key := range layers.Keys {
+		origin, ok := resolved.Origins[key]
+		if !ok {
+			fmt.Printf("  %-13s %s\n", key+":", formatEnvValue(""))
+			continue
+		}
+		value := values[key]
+		if key == "api_key" {
+			value = maskAPIKey(value) + "... (masked)"
+		}
+		fmt.Printf("  %-13s %s\n", key+":", value)
+		fmt.Printf("    from %s\n", origin)
+		for _, overridden := range resolved.Overridden[key] {
+			fmt.Printf("    overrides %s\n", overridden)
+		}
+	}
+
+	fmt.Println()
+	return nil
+}
+
+// showVarStatus prints where each persisted variable comes from and where
+// the running shell differs from what is persisted
+func showVarStatus(vars []config.VarStatus) {
+	if home, err := os.UserHomeDir(); err == nil {
+		config.AddOutsideAssignments(vars, home)
+	}
+
+	sources := []config.VarStatus{}
+	drift := []config.VarStatus{}
+	for _, v := range vars {
+		if v.Source.Path != "" {
+			sources = append(sources, v)
+		}
+		if v.Drift() != "" {
+			drift = append(drift, v)
+		}
+	}
+
+	if len(sources) > 0 {
+		fmt.Println("\nPersisted In:")
+		for _, v := range sources {
+			fmt.Printf("  %-31s %s\n", v.Key+":", v.Source)
+		}
+	}
+
+	if len(drift) == 0 {
+		if len(sources) > 0 {
+			fmt.Println("\nThis shell matches the persisted configuration.")
+		}
+		return
+	}
+
+	fmt.Println("\nDrift:")
+	for _, v := range drift {
+		live := "(not set)"
+		if v.LiveSet {
+			live = formatEnvValue(maskIfSecret(v.Key, v.Live))
+		}
+		fmt.Printf("  %s: %s\n", v.Key, v.Drift())
+		fmt.Printf("    persisted: %s, this shell: %s\n", formatEnvValue(maskIfSecret(v.Key, v.Persisted)), live)
+	}
+}
+
+// showShellProfiles lists the shell profiles that contain a managed block
+// and whether they hold the same configuration
+func showShellProfiles() {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+
+	blocks := config.FindShellBlocks(home)
+	if len(blocks) == 0 {
+		return
+	}
+
+	fmt.Println("\nShell Profiles:")
+	for _, block := range blocks {
+		if block.Err != nil {
+			fmt.Printf("  %-6s %s (unreadable: %v)\n", block.Shell, block.Path, block.Err)
+			continue
+		}
+		if block.EnvFile != "" {
+			fmt.Printf("  %-6s %s (%d variables, via %s)\n", block.Shell, block.Path, len(block.Vars), block.EnvFile)
+			continue
+		}
+		fmt.Printf("  %-6s %s (%d variables)\n", block.Shell, block.Path, len(block.Vars))
+	}
+
+	if len(blocks) > 1 {
+		if config.BlocksAgree(blocks) {
+			fmt.Println("  All profiles agree.")
+		} else {
+			fmt.Println("  Warning: profiles differ, run configure --shells=... to bring them in line.")
+			for _, block := range blocks[1:] {
+				for _, key := range differingKeys(blocks[0].Vars, block.Vars) {
+					fmt.Printf("    %s: %s in %s, %s in %s\n", key,
+						formatEnvValue(maskIfSecret(key, blocks[0].Vars[key])), blocks[0].Shell,
+						formatEnvValue(maskIfSecret(key, block.Vars[key])), block.Shell)
+				}
+			}
+		}
+	}
+}
+
+// differingKeys returns the sorted keys whose values differ between a and b
+func differingKeys(a, b map[string]string) []string {
+	keys := []string{}
+	for key := range a {
+		if a[key] != b[key] {
+			keys = append(keys, key)
+		}
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// maskIfSecret masks the value of credential variables
+func maskIfSecret(key, value string) string {
+	if config.IsSecret(key) && value != "" {
+		return maskAPIKey(value) + "..."
+	}
+	return value
+}
+
 func maskAPIKey(key string) string {
 	if len(key) <= 8 {
 		return "***"
@@ -74,13 +291,6 @@ func maskAPIKey(key string) string {
 	return key[:8] + "***"
 }
 
-func formatValue(value bool) string {
-	if value {
-		return "true"
-	}
-	return "false"
-}
-
 func formatEnvValue(value string) string {
 	if value == "" {
 		return "(not set)"
@@ -90,4 +300,6 @@ func formatEnvValue(value string) string {
 
 func init() {
 	rootCmd.AddCommand(showCmd)
+
+	showCmd.Flags().BoolVar(&showLayers, "layers", false, "Show the configuration layers and which one supplied each setting")
 }
@@ -2,29 +2,57 @@ package backup
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/gilbe/claude-foundry-manager/internal/config"
+	"github.com/gilbe/claude-foundry-manager/internal/secrets"
 )
 
 // Backup represents a saved configuration backup
 type Backup struct {
-	Timestamp   time.Time         `json:"timestamp"`
-	Description string            `json:"description"`
-	Variables   map[string]string `json:"variables"`
+	SchemaVersion int               `json:"schema_version"` // see SchemaVersion
+	Timestamp     time.Time         `json:"timestamp"`
+	Description   string            `json:"description"`
+	Kind          string            `json:"kind,omitempty"` // KindAuto or KindManual
+	Pinned        bool              `json:"pinned,omitempty"`
+	Metadata      Metadata          `json:"metadata"`
+	Variables     map[string]string `json:"variables"`
+	// Settings holds the managed variables of each Claude Code settings
+	// file (see config.SettingsStore), keyed by path
+	Settings map[string]map[string]string `json:"settings,omitempty"`
+	// Refs names the variables whose value is a secret reference (see
+	// secrets.Resolve) rather than the key itself; restore resolves them
+	Refs []string `json:"refs,omitempty"`
+	// Sealed holds the secret variables when backups redact or encrypt
+	// them; they are then left out of Variables and Settings
+	Sealed *SealedSecrets `json:"sealed,omitempty"`
+	// Files holds copies of the profile and settings files, when file
+	// snapshots are on (see RestoreFiles)
+	Files []FileSnapshot `json:"files,omitempty"`
 }
 
 // BackupInfo represents metadata about a backup file
 type BackupInfo struct {
 	Filename    string
+	ID          string // Filename without backup_ and .json; see ResolveBackup
 	Timestamp   time.Time
 	Description string
 	UseFoundry  bool
 	Resource    string
+	Provider    string // title of the provider the backup selects
+	Secrets     string // how secrets are kept: SecretsPlain, SecretsRedact, SecretsPassphrase or SecretsAge
+	Manual      bool   // made with backup create; never pruned
+	Pinned      bool   // pinned with backup pin; never pruned
+	Tags        []string
+	// Problem says why the file could not be read as a backup; the other
+	// fields are then empty but for Filename and ID
+	Problem string
 }
 
 // GetBackupDir returns the directory where backups are stored
@@ -36,45 +64,143 @@ func GetBackupDir() string {
 	return filepath.Join(home, ".claude-code-backups")
 }
 
-// ensureBackupDir creates the backup directory if it doesn't exist
+// ensureBackupDir creates the backup directory if it doesn't exist, and
+// makes it private to the user, as backups may hold API keys
 func ensureBackupDir() error {
 	dir := GetBackupDir()
-	return os.MkdirAll(dir, 0755)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return os.Chmod(dir, 0700)
+}
+
+// Warning is returned for a problem with a backup that was created
+// anyway, such as secrets that could only be redacted or old backups that
+// could not be pruned
+type Warning struct {
+	Err error
+}
+
+func (w *Warning) Error() string {
+	return w.Err.Error()
+}
+
+func (w *Warning) Unwrap() error {
+	return w.Err
+}
+
+// warn adds problem to err, which is nil or the *Warning of a backup
+func warn(err, problem error) error {
+	if err == nil {
+		return &Warning{Err: problem}
+	}
+	return &Warning{Err: fmt.Errorf("%v; %w", err, problem)}
+}
+
+// isWarning reports whether err is nil or only a *Warning
+func isWarning(err error) bool {
+	var warning *Warning
+	return err == nil || errors.As(err, &warning)
+}
+
+// CreateAutoBackup creates an automatic backup of the store with a
+// description, then prunes old automatic backups by the retention policy.
+// Problems that did not stop the backup are returned as a *Warning.
+func CreateAutoBackup(store config.EnvStore, description string) error {
+	_, err := createBackup(store, description, KindAuto)
+	if !isWarning(err) {
+		return err
+	}
+	if _, pruneErr := Prune(false); pruneErr != nil {
+		return warn(err, fmt.Errorf("failed to prune old backups: %w", pruneErr))
+	}
+	return err
 }
 
-// CreateAutoBackup creates an automatic backup with a description
-func CreateAutoBackup(description string) error {
-	_, err := createBackup(description)
+// CreateRestoreBackup creates the automatic backup taken before restoring
+// the backup file filename. Pruning spares filename, so the restore can
+// still read it.
+func CreateRestoreBackup(store config.EnvStore, filename string) error {
+	_, err := createBackup(store, "Before restore operation", KindAuto)
+	if !isWarning(err) {
+		return err
+	}
+	if _, pruneErr := prune(false, filename); pruneErr != nil {
+		return warn(err, fmt.Errorf("failed to prune old backups: %w", pruneErr))
+	}
 	return err
 }
 
-// CreateManualBackup creates a manual backup with a user-provided description
-func CreateManualBackup(description string) (string, error) {
-	filename, err := createBackup(description)
-	if err != nil {
+// CreateManualBackup creates a manual backup of the store with a
+// user-provided description. Problems that did not stop the backup are
+// returned as a *Warning along with its filename.
+func CreateManualBackup(store config.EnvStore, description string, tags ...string) (string, error) {
+	filename, err := createBackup(store, description, KindManual, tags...)
+	if !isWarning(err) {
 		return "", err
 	}
-	return filepath.Base(filename), nil
+	return filepath.Base(filename), err
+}
+
+// CreateFilesBackup creates an automatic backup that snapshots the files
+// of the store and the given files even when file snapshots are off, so
+// files about to be replaced can be put back. Problems that did not stop
+// the backup are returned as a *Warning.
+func CreateFilesBackup(store config.EnvStore, description string, files ...string) error {
+	_, err := newBackup(store, description, KindAuto, files, nil)
+	return err
+}
+
+// createBackup creates a backup file with the current configuration of the
+// store, with file snapshots if they are on
+func createBackup(store config.EnvStore, description, kind string, tags ...string) (string, error) {
+	return newBackup(store, description, kind, nil, tags)
 }
 
-// createBackup creates a backup file with current configuration
-func createBackup(description string) (string, error) {
+// newBackup creates a backup file with the current configuration of the
+// store. With files given, the files are snapshotted along with those of
+// the store even when file snapshots are off. Problems that did not stop
+// the backup are returned as a *Warning along with its path.
+func newBackup(store config.EnvStore, description, kind string, files, tags []string) (string, error) {
+	settings, err := LoadSettings()
+	if err != nil {
+		return "", err
+	}
 	if err := ensureBackupDir(); err != nil {
 		return "", fmt.Errorf("failed to create backup directory: %w", err)
 	}
 
 	// Get current configuration
-	vars := config.GetAllVars()
+	vars := config.GetAllVars(store)
 
 	backup := Backup{
-		Timestamp:   time.Now(),
-		Description: description,
-		Variables:   vars,
+		SchemaVersion: SchemaVersion,
+		Timestamp:     time.Now(),
+		Description:   description,
+		Kind:          kind,
+		Metadata:      newMetadata(store, tags),
+		Variables:     vars,
+		Settings:      settingsVars(),
+	}
+	if settings.FileSnapshots || len(files) > 0 {
+		if err := backup.snapshotFiles(store, settings, files); err != nil {
+			return "", err
+		}
+	}
+	if err := backup.useRefs(); err != nil {
+		return "", err
+	}
+	hash := backup.contentHash()
+	if kind == KindAuto {
+		// Nothing changed since the last backup; it already covers this one
+		if existing := latestWithContent(hash); existing != "" {
+			return filepath.Join(GetBackupDir(), existing), nil
+		}
+	}
+	sealWarning, err := backup.seal()
+	if err != nil {
+		return "", fmt.Errorf("failed to protect secrets: %w", err)
 	}
-
-	// Generate filename with timestamp
-	filename := fmt.Sprintf("backup_%s.json", time.Now().Format("20060102_150405"))
-	filepath := filepath.Join(GetBackupDir(), filename)
 
 	// Marshal to JSON
 	data, err := json.MarshalIndent(backup, "", "  ")
@@ -82,15 +208,21 @@ func createBackup(description string) (string, error) {
 		return "", fmt.Errorf("failed to marshal backup: %w", err)
 	}
 
-	// Write to file
-	if err := os.WriteFile(filepath, data, 0644); err != nil {
+	// Write to a new file named after the time and content
+	path, err := writeBackupFile(backup.Timestamp, hash, data)
+	if err != nil {
 		return "", fmt.Errorf("failed to write backup file: %w", err)
 	}
 
-	return filepath, nil
+	if sealWarning != nil {
+		return path, &Warning{Err: sealWarning}
+	}
+	return path, nil
 }
 
-// ListBackups returns a list of all available backups, sorted by timestamp (newest first)
+// ListBackups returns a list of all available backups, sorted by timestamp
+// (newest first). Files that cannot be read as a backup come last, with
+// their Problem set.
 func ListBackups() ([]BackupInfo, error) {
 	dir := GetBackupDir()
 
@@ -106,6 +238,7 @@ func ListBackups() ([]BackupInfo, error) {
 	}
 
 	backups := []BackupInfo{}
+	broken := []BackupInfo{}
 	for _, entry := range entries {
 		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
 			continue
@@ -114,61 +247,278 @@ func ListBackups() ([]BackupInfo, error) {
 		// Read backup file
 		filepath := filepath.Join(dir, entry.Name())
 		data, err := os.ReadFile(filepath)
-		if err != nil {
-			continue // Skip files that can't be read
+		if err == nil {
+			var backup *Backup
+			if backup, err = parseBackup(data); err == nil {
+				backups = append(backups, backupInfo(entry.Name(), backup))
+				continue
+			}
 		}
+		broken = append(broken, BackupInfo{Filename: entry.Name(), ID: BackupID(entry.Name()), Problem: err.Error()})
+	}
+
+	// Sort by timestamp, newest first
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Timestamp.After(backups[j].Timestamp)
+	})
+
+	return append(backups, broken...), nil
+}
+
+// backupInfo summarizes a backup read from filename
+func backupInfo(filename string, backup *Backup) BackupInfo {
+	info := BackupInfo{
+		Filename:    filename,
+		ID:          BackupID(filename),
+		Timestamp:   backup.Timestamp,
+		Description: backup.Description,
+		UseFoundry:  backup.Variables[config.EnvUseFoundry] == "true",
+		Resource:    backup.Variables[config.EnvFoundryResource],
+		Provider:    config.DetectProvider(backup.Variables).Title(),
+		Secrets:     SecretsPlain,
+		Manual:      backup.Kind == KindManual,
+		Pinned:      backup.Pinned,
+		Tags:        backup.Metadata.Tags,
+	}
+	if backup.Sealed != nil {
+		info.Secrets = backup.Sealed.Mode
+	}
+	return info
+}
+
+// RestoreBackup restores configuration from a backup file into the store.
+// Secrets of an encrypted backup that differ from the current ones are
+// decrypted, asking for the passphrase if needed. The returned warnings
+// name redacted secrets that could not be restored.
+func RestoreBackup(store config.EnvStore, filename string) ([]string, error) {
+	return RestoreSelected(store, filename, nil)
+}
+
+// RestoreSelected restores the variables match selects (see ParseOnly)
+// from a backup file, like RestoreBackup, and keeps the others as they
+// are. A nil match restores everything.
+func RestoreSelected(store config.EnvStore, filename string, match func(key string) bool) ([]string, error) {
+	backup, err := LoadBackup(filename)
+	if err != nil {
+		return nil, err
+	}
+	if match == nil {
+		match = func(string) bool { return true }
+	}
+	backup.keepOnly(match)
+	skipped := backup.dropUnmanaged()
+
+	// Resolve secret references and unseal secrets before changing anything
+	refs, err := backup.resolveRefs()
+	if err != nil {
+		return nil, err
+	}
+	warnings, err := backup.unseal(store)
+	if err != nil {
+		return nil, err
+	}
+	warnings = append(skipped, warnings...)
 
-		var backup Backup
-		if err := json.Unmarshal(data, &backup); err != nil {
-			continue // Skip invalid JSON files
+	// Record the backup's extra variables first so the manifest never
+	// misses a variable the store holds
+	restored := []string{}
+	for key := range config.ExtraVars(backup.Variables) {
+		restored = append(restored, key)
+	}
+	for _, vars := range backup.Settings {
+		for key := range config.ExtraVars(vars) {
+			restored = append(restored, key)
 		}
+	}
+	if err := config.RecordExtraKeys(restored); err != nil {
+		return nil, fmt.Errorf("failed to record variables: %w", err)
+	}
 
-		info := BackupInfo{
-			Filename:    entry.Name(),
-			Timestamp:   backup.Timestamp,
-			Description: backup.Description,
-			UseFoundry:  backup.Variables[config.EnvUseFoundry] == "true",
-			Resource:    backup.Variables[config.EnvFoundryResource],
+	// Clear all variables and restore the backup in a single transaction,
+	// so a failure never leaves a half-restored configuration
+	current := config.GetAllVars(store)
+	tx := config.Begin(store)
+	for _, key := range config.ManagedKeys() {
+		if match(key) {
+			tx.Delete(key)
 		}
+	}
+	for key := range current {
+		if match(key) && config.ValidateManagedKey(key) == nil {
+			tx.Delete(key)
+		}
+	}
+	for key, value := range backup.Variables {
+		tx.Set(key, value)
+	}
 
-		backups = append(backups, info)
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to restore variables: %w", err)
 	}
 
-	// Sort by timestamp, newest first
-	sort.Slice(backups, func(i, j int) bool {
-		return backups[i].Timestamp.After(backups[j].Timestamp)
-	})
+	if err := restoreSettings(backup.Settings, match); err != nil {
+		return nil, err
+	}
+	for key, ref := range refs {
+		if err := config.RecordSecretRef(key, ref, backup.Variables[key]); err != nil {
+			return nil, err
+		}
+	}
 
-	return backups, nil
+	// Forget the extra variables the backup does not have
+	dropped := []string{}
+	for key := range config.ExtraVars(current) {
+		if _, ok := backup.Variables[key]; !ok && match(key) && config.ValidateManagedKey(key) == nil {
+			dropped = append(dropped, key)
+		}
+	}
+	return warnings, config.ForgetExtraKeys(dropped)
 }
 
-// RestoreBackup restores configuration from a backup file
-func RestoreBackup(filename string) error {
-	filepath := filepath.Join(GetBackupDir(), filename)
+// useRefs replaces the values resolved from a secret reference by the
+// reference, so the backup does not hold the secret
+func (b *Backup) useRefs() error {
+	refs, err := config.SecretRefs()
+	if err != nil || len(refs) == 0 {
+		return err
+	}
+
+	used := map[string]bool{}
+	replace := func(vars map[string]string) {
+		for key, value := range vars {
+			if ref := config.SecretRefFor(refs, key, value); ref != "" {
+				vars[key] = ref
+				used[key] = true
+			}
+		}
+	}
+	replace(b.Variables)
+	for _, vars := range b.Settings {
+		replace(vars)
+	}
 
-	// Read backup file
-	data, err := os.ReadFile(filepath)
+	for key := range used {
+		b.Refs = append(b.Refs, key)
+	}
+	sort.Strings(b.Refs)
+	return nil
+}
+
+// ConfirmCommandFunc asks whether to run command to resolve the cmd:
+// reference of key in a backup being restored, as backup files may come
+// from elsewhere. It is nil when nobody can be asked, and such commands
+// are refused.
+var ConfirmCommandFunc func(key, command string) (bool, error)
+
+// confirmCommand refuses to run the command of a cmd: reference unless
+// ConfirmCommandFunc allows it
+func confirmCommand(key, command string) error {
+	if ConfirmCommandFunc == nil {
+		return fmt.Errorf("the backup reads %s from the command %q, which nobody can confirm", key, command)
+	}
+	ok, err := ConfirmCommandFunc(key, command)
 	if err != nil {
-		return fmt.Errorf("failed to read backup file: %w", err)
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("not running the command %q for %s", command, key)
 	}
+	return nil
+}
 
-	var backup Backup
-	if err := json.Unmarshal(data, &backup); err != nil {
-		return fmt.Errorf("failed to parse backup file: %w", err)
+// resolveRefs replaces the secret references of the backup by their
+// values and returns the references of its variables, keyed by variable.
+// Commands run only once confirmed.
+func (b *Backup) resolveRefs() (map[string]string, error) {
+	refs := map[string]string{}
+	resolved := map[string]string{} // a command runs only once
+	resolve := func(vars map[string]string, key string) error {
+		ref, ok := vars[key]
+		if !ok || !secrets.IsRef(ref) {
+			return nil
+		}
+		if _, done := resolved[ref]; !done {
+			if command, ok := strings.CutPrefix(ref, secrets.RefCommand); ok {
+				if err := confirmCommand(key, command); err != nil {
+					return err
+				}
+			}
+			value, err := secrets.Resolve(ref)
+			if err != nil {
+				return fmt.Errorf("failed to resolve %s: %w", key, err)
+			}
+			resolved[ref] = value
+		}
+		vars[key] = resolved[ref]
+		return nil
+	}
+
+	for _, key := range b.Refs {
+		if ref := b.Variables[key]; secrets.IsRef(ref) {
+			refs[key] = ref
+		}
+		if err := resolve(b.Variables, key); err != nil {
+			return nil, err
+		}
+		for _, vars := range b.Settings {
+			if err := resolve(vars, key); err != nil {
+				return nil, err
+			}
+		}
 	}
+	return refs, nil
+}
 
-	// First, rollback to default to clear all variables
-	if err := config.RollbackToDefault(); err != nil {
-		return fmt.Errorf("failed to clear existing configuration: %w", err)
+// settingsVars returns the managed variables of the Claude Code settings
+// files of the user and the current project. Files without any are left
+// out, as are files that cannot be read.
+func settingsVars() map[string]map[string]string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil
 	}
 
-	// Then, restore variables from backup
-	if len(backup.Variables) > 0 {
-		if err := config.SetAllVars(backup.Variables); err != nil {
-			return fmt.Errorf("failed to restore variables: %w", err)
+	settings := map[string]map[string]string{}
+	for _, path := range config.SettingsFiles(home, config.ProjectRoot(cwd)) {
+		vars, err := config.NewSettingsStore(path).List()
+		if err == nil && len(vars) > 0 {
+			settings[path] = vars
 		}
 	}
+	if len(settings) == 0 {
+		return nil
+	}
+	return settings
+}
 
+// restoreSettings puts back the managed variables match selects of each
+// settings file in the backup, one transaction per file
+func restoreSettings(settings map[string]map[string]string, match func(key string) bool) error {
+	paths := make([]string, 0, len(settings))
+	for path := range settings {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		store := config.NewSettingsStore(path)
+		tx := config.Begin(store)
+		for _, key := range config.ManagedKeys() {
+			if match(key) {
+				tx.Delete(key)
+			}
+		}
+		for key, value := range settings[path] {
+			tx.Set(key, value)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", path, err)
+		}
+	}
 	return nil
 }
 
@@ -198,3 +198,111 @@ func TestEnsureBackupDir(t *testing.T) {
 		t.Error("Backup path exists but is not a directory")
 	}
 }
+
+func TestBackupKeepsSecretReference(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("TEST_FOUNDRY_KEY", "sk-secret")
+
+	store := config.NewMemoryStore()
+	if err := config.ApplyFoundryConfig(store, &config.FoundryConfig{Resource: "res", APIKey: "sk-secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.RecordSecretRef(config.EnvFoundryAPIKey, "env:TEST_FOUNDRY_KEY", "sk-secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := createBackup(store, "test", KindAuto)
+	if err != nil {
+		t.Fatalf("createBackup failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	var saved Backup
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Variables[config.EnvFoundryAPIKey] != "env:TEST_FOUNDRY_KEY" || len(saved.Refs) != 1 {
+		t.Errorf("Expected the reference instead of the key, got %v (refs %v)", saved.Variables, saved.Refs)
+	}
+
+	// The restore resolves the reference again, picking up a rotated key
+	t.Setenv("TEST_FOUNDRY_KEY", "sk-rotated")
+	if _, err := RestoreBackup(store, filepath.Base(path)); err != nil {
+		t.Fatalf("RestoreBackup failed: %v", err)
+	}
+	if value, _ := store.Get(config.EnvFoundryAPIKey); value != "sk-rotated" {
+		t.Errorf("Expected the resolved key, got %q", value)
+	}
+	refs, _ := config.SecretRefs()
+	if config.SecretRefFor(refs, config.EnvFoundryAPIKey, "sk-rotated") != "env:TEST_FOUNDRY_KEY" {
+		t.Errorf("Expected the reference to be recorded for the new value, got %v", refs)
+	}
+
+	// A key set to a plain value later is backed up as is
+	if err := store.Set(config.EnvFoundryAPIKey, "sk-plain"); err != nil {
+		t.Fatal(err)
+	}
+	path, err = createBackup(store, "plain", KindAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(path)
+	var plain Backup
+	if err := json.Unmarshal(data, &plain); err != nil {
+		t.Fatal(err)
+	}
+	if plain.Variables[config.EnvFoundryAPIKey] != "sk-plain" || len(plain.Refs) != 0 {
+		t.Errorf("Expected the plain value without a reference, got %v (refs %v)", plain.Variables, plain.Refs)
+	}
+}
+
+func TestRestoreConfirmsBackupCommands(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	saved := ConfirmCommandFunc
+	defer func() { ConfirmCommandFunc = saved }()
+
+	store := config.NewMemoryStore()
+	if err := config.ApplyFoundryConfig(store, &config.FoundryConfig{Resource: "res", APIKey: "sk-from-cmd"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.RecordSecretRef(config.EnvFoundryAPIKey, "cmd:echo sk-from-cmd", "sk-from-cmd"); err != nil {
+		t.Fatal(err)
+	}
+	path, err := createBackup(store, "test", KindAuto)
+	if err != nil {
+		t.Fatalf("createBackup failed: %v", err)
+	}
+	if err := store.Set(config.EnvFoundryAPIKey, "sk-current"); err != nil {
+		t.Fatal(err)
+	}
+
+	ConfirmCommandFunc = nil
+	if _, err := RestoreBackup(store, filepath.Base(path)); err == nil {
+		t.Error("Expected the command to be refused when nobody can confirm it")
+	}
+	var asked string
+	ConfirmCommandFunc = func(key, command string) (bool, error) {
+		asked = key + " " + command
+		return false, nil
+	}
+	if _, err := RestoreBackup(store, filepath.Base(path)); err == nil {
+		t.Error("Expected a declined command to stop the restore")
+	}
+	if asked != config.EnvFoundryAPIKey+" echo sk-from-cmd" {
+		t.Errorf("Expected to be asked about the command, got %q", asked)
+	}
+	if value, _ := store.Get(config.EnvFoundryAPIKey); value != "sk-current" {
+		t.Errorf("Expected the key to be left alone, got %q", value)
+	}
+
+	ConfirmCommandFunc = func(string, string) (bool, error) { return true, nil }
+	if _, err := RestoreBackup(store, filepath.Base(path)); err != nil {
+		t.Fatalf("RestoreBackup failed: %v", err)
+	}
+	if value, _ := store.Get(config.EnvFoundryAPIKey); value != "sk-from-cmd" {
+		t.Errorf("Expected the key from the confirmed command, got %q", value)
+	}
+}
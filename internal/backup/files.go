@@ -0,0 +1,332 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+// With file snapshots on (backup settings --file-snapshots), a backup also
+// keeps a byte-exact copy of each shell profile, env file and settings file
+// the tool writes, so a profile mangled by a bad write can be put back with
+// backup restore --files. Unless secrets are kept plain, each secret in a
+// file is replaced by a placeholder and filled in again on restore from
+// the backup's own (sealed) secrets; secrets set from a reference always
+// are, and are resolved again on restore.
+
+// DefaultSnapshotMaxBytes is the largest file snapshotted by default
+const DefaultSnapshotMaxBytes = 1 << 20
+
+// redactedPrefix and redactedSuffix wrap the name of a secret variable
+// replaced in a snapshot, followed by ":" and the dialect that quoted it
+// when the quoted string was replaced (see config.QuotedForms)
+const (
+	redactedPrefix = "<claude-foundry-manager:redacted:"
+	redactedSuffix = ">"
+)
+
+// minRedactLength is the shortest secret replaced where it appears bare;
+// shorter ones are only replaced as a whole quoted string, so that they
+// never match unrelated text
+const minRedactLength = 8
+
+// FileSnapshot is a copy of a file as it was when the backup was made
+type FileSnapshot struct {
+	Path    string `json:"path"`
+	Missing bool   `json:"missing,omitempty"` // the file did not exist
+	// Skipped says why the content was not kept, e.g. the file is too large
+	Skipped string `json:"skipped,omitempty"`
+	Mode    uint32 `json:"mode,omitempty"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256,omitempty"` // of the file itself, before redaction
+	// Redacted names the secret variables replaced by placeholders
+	Redacted []string `json:"redacted,omitempty"`
+	Content  []byte   `json:"content,omitempty"`
+}
+
+// SnapshotMaxBytesLimit returns the size limit of the settings, or the
+// default
+func (s Settings) SnapshotMaxBytesLimit() int64 {
+	if s.SnapshotMaxBytes == 0 {
+		return DefaultSnapshotMaxBytes
+	}
+	return s.SnapshotMaxBytes
+}
+
+// snapshotFiles copies the files the store and the backed up settings
+// live in, and the extra files. It must run before useRefs and seal, while
+// the secrets are still in Variables and Settings. Secrets set from a
+// reference are always redacted, as the backup keeps only the reference.
+func (b *Backup) snapshotFiles(store config.EnvStore, settings Settings, extra []string) error {
+	paths := append(config.StoreFiles(store), extra...)
+	for path := range b.Settings {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	refs, err := config.SecretRefs()
+	if err != nil {
+		return err
+	}
+	redact := map[string]string{} // secret value -> variable
+	secrets := SecretSet{Variables: b.Variables, Settings: b.Settings}
+	secrets.each(func(path, key, value string) {
+		if value == "" || !config.IsSecret(key) {
+			return
+		}
+		if settings.Secrets != SecretsPlain || config.SecretRefFor(refs, key, value) != "" {
+			redact[value] = key
+		}
+	})
+
+	seen := map[string]bool{}
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		b.Files = append(b.Files, snapshotFile(path, settings.SnapshotMaxBytesLimit(), redact))
+	}
+	return nil
+}
+
+// snapshotFile copies the file at path, replacing the secret values in it
+func snapshotFile(path string, maxBytes int64, redact map[string]string) FileSnapshot {
+	snapshot := FileSnapshot{Path: path}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		snapshot.Missing = true
+		return snapshot
+	}
+	if err != nil {
+		snapshot.Skipped = err.Error()
+		return snapshot
+	}
+	snapshot.Mode = uint32(info.Mode().Perm())
+	snapshot.Size = info.Size()
+	if info.Size() > maxBytes {
+		snapshot.Skipped = fmt.Sprintf("larger than %d bytes", maxBytes)
+		return snapshot
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		snapshot.Skipped = err.Error()
+		return snapshot
+	}
+	snapshot.Size = int64(len(data))
+	snapshot.SHA256 = sha256Hex(data)
+
+	// Longest first, so a quoted secret is replaced before the bare one
+	// and a secret containing another is replaced whole
+	replace := redactions(redact)
+	texts := make([]string, 0, len(replace))
+	for text := range replace {
+		texts = append(texts, text)
+	}
+	sort.Slice(texts, func(i, j int) bool {
+		return len(texts[i]) > len(texts[j]) || len(texts[i]) == len(texts[j]) && texts[i] < texts[j]
+	})
+	redacted := map[string]bool{}
+	for _, text := range texts {
+		if bytes.Contains(data, []byte(text)) {
+			r := replace[text]
+			data = bytes.ReplaceAll(data, []byte(text), []byte(r.placeholder))
+			redacted[r.key] = true
+		}
+	}
+	for key := range redacted {
+		snapshot.Redacted = append(snapshot.Redacted, key)
+	}
+	sort.Strings(snapshot.Redacted)
+	snapshot.Content = data
+	return snapshot
+}
+
+// CheckFiles refuses a backup with snapshots of files the tool does not
+// manage (see config.ManagedFiles), so that a crafted or damaged backup
+// cannot overwrite, or have snapshotted, any other file
+func (b *Backup) CheckFiles(store config.EnvStore) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	managed := map[string]bool{}
+	for _, path := range config.ManagedFiles(store, home, config.ProjectRoot(cwd)) {
+		managed[filepath.Clean(path)] = true
+	}
+	for _, f := range b.Files {
+		if !managed[filepath.Clean(f.Path)] {
+			return fmt.Errorf("the backup has a snapshot of %s, which is not a file this tool manages; refusing to restore it", f.Path)
+		}
+	}
+	return nil
+}
+
+// redaction is the placeholder of a secret and the variable it belongs to
+type redaction struct {
+	key         string
+	placeholder string
+}
+
+// redactions returns what to replace for the secrets of redact (secret ->
+// variable): each secret as every dialect and JSON quote it, and the bare
+// secret when it is at least minRedactLength long
+func redactions(redact map[string]string) map[string]redaction {
+	replace := map[string]redaction{}
+	for value, key := range redact {
+		forms := config.QuotedForms(value)
+		dialects := make([]string, 0, len(forms))
+		for dialect := range forms {
+			dialects = append(dialects, dialect)
+		}
+		sort.Strings(dialects)
+		for _, dialect := range dialects {
+			if _, ok := replace[forms[dialect]]; !ok {
+				replace[forms[dialect]] = redaction{key, placeholder(key, dialect)}
+			}
+		}
+		if _, ok := replace[value]; !ok && len(value) >= minRedactLength {
+			replace[value] = redaction{key, placeholder(key, "")}
+		}
+	}
+	return replace
+}
+
+// placeholder returns the text standing for the secret of key, as quoted
+// by dialect, or bare when dialect is empty
+func placeholder(key, dialect string) string {
+	if dialect == "" {
+		return redactedPrefix + key + redactedSuffix
+	}
+	return redactedPrefix + key + ":" + dialect + redactedSuffix
+}
+
+// RestoreFiles puts the files snapshotted in a backup back as they were.
+// Secrets redacted in the snapshots are filled in from the backup,
+// decrypting it if needed. It returns the files restored and warnings for
+// those left alone or not restored byte for byte.
+func RestoreFiles(store config.EnvStore, filename string) ([]string, []string, error) {
+	backup, err := LoadBackup(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(backup.Files) == 0 {
+		return nil, nil, fmt.Errorf("%s has no file snapshots; turn them on with 'backup settings --file-snapshots'", filename)
+	}
+	if err := backup.CheckFiles(store); err != nil {
+		return nil, nil, err
+	}
+
+	var warnings []string
+	for _, f := range backup.Files {
+		if len(f.Redacted) > 0 {
+			if _, err := backup.resolveRefs(); err != nil {
+				return nil, nil, err
+			}
+			unsealWarnings, err := backup.unseal(store)
+			if err != nil {
+				return nil, nil, err
+			}
+			warnings = append(warnings, unsealWarnings...)
+			break
+		}
+	}
+
+	// Prepare every file before writing any
+	contents := map[string][]byte{}
+	for _, f := range backup.Files {
+		switch {
+		case f.Missing:
+			if _, err := os.Stat(f.Path); err == nil {
+				warnings = append(warnings, fmt.Sprintf("%s did not exist when the backup was made; left as is", f.Path))
+			}
+			continue
+		case f.Skipped != "":
+			warnings = append(warnings, fmt.Sprintf("%s was not snapshotted (%s); left as is", f.Path, f.Skipped))
+			continue
+		}
+
+		data, missing := fillSecrets(f, backup)
+		switch {
+		case len(missing) > 0:
+			warnings = append(warnings, fmt.Sprintf("%s is restored with %s empty, as the backup has no value for it; configure it again", f.Path, strings.Join(missing, ", ")))
+		case sha256Hex(data) != f.SHA256 && len(f.Redacted) == 0:
+			return nil, nil, fmt.Errorf("the snapshot of %s is corrupt", f.Path)
+		case sha256Hex(data) != f.SHA256:
+			warnings = append(warnings, fmt.Sprintf("%s is restored with the current value of %s, which differs from the backup", f.Path, strings.Join(f.Redacted, ", ")))
+		}
+		contents[f.Path] = data
+	}
+
+	restored := []string{}
+	for _, f := range backup.Files {
+		data, ok := contents[f.Path]
+		if !ok {
+			continue
+		}
+		mode := os.FileMode(f.Mode)
+		if mode == 0 {
+			mode = 0600
+		}
+		if err := config.WriteFileAtomic(f.Path, data, mode); err != nil {
+			return restored, warnings, fmt.Errorf("failed to restore %s: %w", f.Path, err)
+		}
+		restored = append(restored, f.Path)
+	}
+	return restored, warnings, nil
+}
+
+// Differs reports whether the file now differs from its snapshot, or can
+// no longer be read
+func (f FileSnapshot) Differs() bool {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return true
+	}
+	return sha256Hex(data) != f.SHA256
+}
+
+// fillSecrets returns the content of a snapshot with its placeholders
+// replaced by the secrets of the backup, and the variables it has no
+// value for, which are left empty
+func fillSecrets(f FileSnapshot, backup *Backup) ([]byte, []string) {
+	data := f.Content
+	missing := []string{}
+	for _, key := range f.Redacted {
+		value := backup.Variables[key]
+		if value == "" {
+			for _, vars := range backup.Settings {
+				if vars[key] != "" {
+					value = vars[key]
+					break
+				}
+			}
+		}
+		if value == "" {
+			missing = append(missing, key)
+		}
+		data = bytes.ReplaceAll(data, []byte(placeholder(key, "")), []byte(value))
+		for dialect, quoted := range config.QuotedForms(value) {
+			data = bytes.ReplaceAll(data, []byte(placeholder(key, dialect)), []byte(quoted))
+		}
+	}
+	return data, missing
+}
+
+// sha256Hex returns the hex SHA-256 of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
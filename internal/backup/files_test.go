@@ -0,0 +1,222 @@
+package backup
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+// filesTestSetup returns a bash profile store configured with an API key,
+// with some lines of the user's own around the managed block
+func filesTestSetup(t *testing.T, settings Settings) (*config.ProfileStore, []byte) {
+	sealTestSetup(t, settings)
+	home := os.Getenv("HOME")
+	rc := filepath.Join(home, ".bashrc")
+	if err := os.WriteFile(rc, []byte("alias ll='ls -l'\nexport EDITOR=vim\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	store, err := config.NewShellStore(home, "bash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.ApplyFoundryConfig(store, &config.FoundryConfig{Resource: "res", APIKey: "sk-snapshotted-key"}); err != nil {
+		t.Fatal(err)
+	}
+	original, err := os.ReadFile(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, original
+}
+
+func TestRestoreFilesPlain(t *testing.T) {
+	store, original := filesTestSetup(t, Settings{Secrets: SecretsPlain, FileSnapshots: true})
+	filename, err := CreateManualBackup(store, "with files")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(store.Path(), []byte("mangled"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	restored, warnings, err := RestoreFiles(store, filename)
+	if err != nil {
+		t.Fatalf("RestoreFiles failed: %v", err)
+	}
+	if len(restored) != 1 || restored[0] != store.Path() || len(warnings) != 0 {
+		t.Errorf("Expected only the profile restored without warnings, got %v %v", restored, warnings)
+	}
+	if data, _ := os.ReadFile(store.Path()); string(data) != string(original) {
+		t.Errorf("Expected the profile restored byte for byte, got:\n%s", data)
+	}
+}
+
+func TestRestoreFilesFillsRedactedSecrets(t *testing.T) {
+	store, original := filesTestSetup(t, Settings{Secrets: SecretsPassphrase, FileSnapshots: true})
+	t.Setenv(PassphraseEnv, "correct horse")
+	filename, err := CreateManualBackup(store, "encrypted with files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(GetBackupDir(), filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := LoadBackup(filename)
+	if strings.Contains(string(data), "sk-snapshotted-key") || len(b.Files) == 0 || strings.Join(b.Files[0].Redacted, ",") != config.EnvFoundryAPIKey {
+		t.Fatalf("Expected the key to be redacted from the snapshot, got %+v", b.Files)
+	}
+
+	// The key changed since, so it is decrypted from the backup
+	if err := config.ApplyFoundryConfig(store, &config.FoundryConfig{Resource: "other", APIKey: "sk-new-key"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, warnings, err := RestoreFiles(store, filename); err != nil || len(warnings) != 0 {
+		t.Fatalf("RestoreFiles failed: %v %v", warnings, err)
+	}
+	if data, _ := os.ReadFile(store.Path()); string(data) != string(original) {
+		t.Errorf("Expected the profile restored byte for byte, got:\n%s", data)
+	}
+}
+
+func TestSnapshotSizeLimit(t *testing.T) {
+	store, _ := filesTestSetup(t, Settings{Secrets: SecretsPlain, FileSnapshots: true, SnapshotMaxBytes: 10})
+	filename, err := CreateManualBackup(store, "too large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := LoadBackup(filename)
+	if len(b.Files) == 0 || b.Files[0].Skipped == "" || b.Files[0].Content != nil {
+		t.Fatalf("Expected the profile to be left out, got %+v", b.Files)
+	}
+
+	if err := os.WriteFile(store.Path(), []byte("changed"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	restored, warnings, err := RestoreFiles(store, filename)
+	if err != nil || len(restored) != 0 || len(warnings) == 0 {
+		t.Errorf("Expected nothing restored and a warning, got %v %v %v", restored, warnings, err)
+	}
+	if data, _ := os.ReadFile(store.Path()); string(data) != "changed" {
+		t.Errorf("Expected the profile left alone, got %q", data)
+	}
+}
+
+func TestRestoreFilesWithLostRedactedSecret(t *testing.T) {
+	store, original := filesTestSetup(t, Settings{Secrets: SecretsRedact, FileSnapshots: true})
+	filename, err := CreateManualBackup(store, "redacted with files")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The damaged profile no longer holds the key, and the backup never had it
+	if err := os.WriteFile(store.Path(), []byte("mangled"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	restored, warnings, err := RestoreFiles(store, filename)
+	if err != nil || len(restored) != 1 || len(warnings) == 0 {
+		t.Fatalf("Expected the profile restored with a warning, got %v %v %v", restored, warnings, err)
+	}
+	expected := strings.Replace(string(original), "sk-snapshotted-key", "", 1)
+	if data, _ := os.ReadFile(store.Path()); string(data) != expected {
+		t.Errorf("Expected the profile restored with an empty key, got:\n%s", data)
+	}
+}
+
+func TestRestoreFilesOnlyWritesManagedFiles(t *testing.T) {
+	store, _ := filesTestSetup(t, Settings{Secrets: SecretsPlain})
+	home := os.Getenv("HOME")
+	if err := ensureBackupDir(); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name string, files ...FileSnapshot) {
+		data, err := json.Marshal(Backup{Timestamp: time.Now(), Variables: map[string]string{}, Files: files})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(GetBackupDir(), name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshot := func(path, content string) FileSnapshot {
+		return FileSnapshot{Path: path, Size: int64(len(content)), SHA256: sha256Hex([]byte(content)), Content: []byte(content)}
+	}
+
+	outside := filepath.Join(home, ".ssh", "authorized_keys")
+	write("crafted.json", snapshot(store.Path(), "profile\n"), snapshot(outside, "ssh-ed25519 attacker\n"))
+	if _, _, err := RestoreFiles(store, "crafted.json"); err == nil {
+		t.Error("Expected a snapshot of an unmanaged file to be refused")
+	}
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Errorf("Expected %s not to be written", outside)
+	}
+	if data, _ := os.ReadFile(store.Path()); string(data) == "profile\n" {
+		t.Error("Expected nothing to be restored from a refused backup")
+	}
+
+	// A snapshot without a mode creates a private file
+	zshrc := filepath.Join(home, ".zshrc")
+	write("no-mode.json", snapshot(zshrc, "# zsh\n"))
+	if _, _, err := RestoreFiles(store, "no-mode.json"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(zshrc); err != nil || runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Expected %s to be created with mode 0600, got %v %v", zshrc, info, err)
+	}
+}
+
+func TestSnapshotRedactsQuotedSecrets(t *testing.T) {
+	store, _ := filesTestSetup(t, Settings{Secrets: SecretsPassphrase, FileSnapshots: true})
+	t.Setenv(PassphraseEnv, "correct horse")
+	home := os.Getenv("HOME")
+	key := `sk-it's-"quoted"\key!`
+	if err := store.Set(config.EnvFoundryAPIKey, key); err != nil {
+		t.Fatal(err)
+	}
+	// A short secret is not replaced where its text appears bare, as in
+	// EDITOR=vim
+	if err := store.Set("ANTHROPIC_AUTH_TOKEN", "vim"); err != nil {
+		t.Fatal(err)
+	}
+	settings := config.NewSettingsStore(filepath.Join(home, ".claude", "settings.json"))
+	if err := settings.Set(config.EnvFoundryAPIKey, key); err != nil {
+		t.Fatal(err)
+	}
+	original, _ := os.ReadFile(store.Path())
+	originalSettings, _ := os.ReadFile(settings.Path())
+
+	filename, err := CreateManualBackup(store, "quoted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := LoadBackup(filename)
+	for _, f := range b.Files {
+		if strings.Contains(string(f.Content), "quoted") || strings.Contains(string(f.Content), "'vim'") {
+			t.Errorf("Expected the secrets to be redacted from %s, got:\n%s", f.Path, f.Content)
+		}
+		if f.Path == store.Path() && !strings.Contains(string(f.Content), "EDITOR=vim") {
+			t.Errorf("Expected text around a short secret to be kept, got:\n%s", f.Content)
+		}
+	}
+
+	for _, path := range []string{store.Path(), settings.Path()} {
+		if err := os.WriteFile(path, []byte("mangled"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, warnings, err := RestoreFiles(store, filename); err != nil || len(warnings) != 0 {
+		t.Fatalf("RestoreFiles failed: %v %v", warnings, err)
+	}
+	if data, _ := os.ReadFile(store.Path()); string(data) != string(original) {
+		t.Errorf("Expected the profile restored byte for byte, got:\n%s", data)
+	}
+	if data, _ := os.ReadFile(settings.Path()); string(data) != string(originalSettings) {
+		t.Errorf("Expected the settings restored byte for byte, got:\n%s", data)
+	}
+}
@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Backup files are named backup_<YYYYmmdd_HHMMSS>_<hash>.json, where hash
+// is the start of the content hash, plus _2, _3, ... should the same
+// content be backed up twice in a second. The name without backup_ and
+// .json is the backup's ID; commands accept any unique prefix of it.
+
+// contentHash returns a SHA-256 of what a backup restores, leaving out its
+// timestamp, description and other metadata. Secrets count by fingerprint,
+// so a sealed backup hashes like a plain one of the same configuration, and
+// file snapshots count by their SHA-256.
+func (b *Backup) contentHash() string {
+	copied := SecretSet{Variables: map[string]string{}}
+	for key, value := range b.Variables {
+		copied.Variables[key] = value
+	}
+	for path, vars := range b.Settings {
+		for key, value := range vars {
+			copied.set(path, key, value)
+		}
+	}
+	c := Backup{Variables: copied.Variables, Settings: copied.Settings, Refs: b.Refs}
+	prints := c.takeSecrets().mapValues(fingerprint)
+	if b.Sealed != nil {
+		b.Sealed.Fingerprints.each(prints.set)
+	}
+	for path, vars := range c.Settings {
+		if len(vars) == 0 {
+			delete(c.Settings, path)
+		}
+	}
+
+	files := []string{}
+	for _, f := range b.Files {
+		files = append(files, f.Path+" "+f.SHA256)
+	}
+
+	content := struct {
+		Variables    map[string]string            `json:"variables"`
+		Settings     map[string]map[string]string `json:"settings"`
+		Refs         []string                     `json:"refs"`
+		Fingerprints SecretSet                    `json:"fingerprints"`
+		Files        []string                     `json:"files,omitempty"`
+	}{c.Variables, c.Settings, c.Refs, prints, files}
+	// Maps marshal with sorted keys, so equal content hashes the same
+	data, _ := json.Marshal(content)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// BackupID returns the ID of a backup file
+func BackupID(filename string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(filename, "backup_"), ".json")
+}
+
+// writeBackupFile writes a new backup file named after timestamp and hash
+// and returns its path. An existing file is never overwritten.
+func writeBackupFile(timestamp time.Time, hash string, data []byte) (string, error) {
+	base := fmt.Sprintf("backup_%s_%s", timestamp.Format("20060102_150405"), hash[:8])
+	for seq := 1; ; seq++ {
+		name := base + ".json"
+		if seq > 1 {
+			name = fmt.Sprintf("%s_%d.json", base, seq)
+		}
+		path := filepath.Join(GetBackupDir(), name)
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			os.Remove(path)
+			return "", err
+		}
+		if err := f.Close(); err != nil {
+			os.Remove(path)
+			return "", err
+		}
+		return path, nil
+	}
+}
+
+// latestWithContent returns the newest backup when it has the content
+// hash, or an empty string
+func latestWithContent(hash string) string {
+	backups, err := ListBackups()
+	if err != nil || len(backups) == 0 {
+		return ""
+	}
+	latest, err := LoadBackup(backups[0].Filename)
+	if err != nil || latest.contentHash() != hash {
+		return ""
+	}
+	return backups[0].Filename
+}
+
+// ResolveBackup returns the file of the backup named by a filename, an ID
+// or a unique prefix of an ID
+func ResolveBackup(name string) (string, error) {
+	// Only plain file names in the backup directory, never a path out of it
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid backup name %q", name)
+	}
+	if _, err := os.Stat(filepath.Join(GetBackupDir(), name)); err == nil {
+		return name, nil
+	}
+
+	backups, err := ListBackups()
+	if err != nil {
+		return "", err
+	}
+	id := BackupID(name)
+	matches := []string{}
+	for _, b := range backups {
+		if b.ID == id {
+			return b.Filename, nil
+		}
+		if strings.HasPrefix(b.ID, id) {
+			matches = append(matches, b.Filename)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no backup matches %q", name)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("%q matches %d backups (%s); give more of the ID", name, len(matches), strings.Join(matches, ", "))
+}
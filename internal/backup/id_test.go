@@ -0,0 +1,115 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+func TestBackupsInTheSameSecondDoNotCollide(t *testing.T) {
+	store := sealTestSetup(t, Settings{Secrets: SecretsPlain})
+
+	first, err := createBackup(store, "first", KindManual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := createBackup(store, "second", KindManual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatalf("Expected two backup files, got %s twice", first)
+	}
+	if _, b := readBackup(t, first); b.Description != "first" {
+		t.Errorf("Expected the first backup to be kept, got %q", b.Description)
+	}
+	if !strings.HasPrefix(filepath.Base(first), "backup_") || !strings.HasSuffix(first, ".json") {
+		t.Errorf("Expected a backup_*.json name, got %s", filepath.Base(first))
+	}
+}
+
+func TestDuplicateAutoBackupIsSkipped(t *testing.T) {
+	store := sealTestSetup(t, Settings{Secrets: SecretsRedact})
+
+	first, err := createBackup(store, "Before a", KindAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := createBackup(store, "Before b", KindAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != first {
+		t.Errorf("Expected the identical backup to be skipped, got %s and %s", first, again)
+	}
+
+	if err := store.Set(config.EnvFoundryAPIKey, "sk-rotated"); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := createBackup(store, "Before c", KindAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed == first {
+		t.Error("Expected a changed secret to make a new backup")
+	}
+
+	entries, _ := os.ReadDir(GetBackupDir())
+	if len(entries) != 2 {
+		t.Errorf("Expected 2 backup files, got %d", len(entries))
+	}
+}
+
+func TestResolveBackup(t *testing.T) {
+	sealTestSetup(t, Settings{Secrets: SecretsPlain})
+	if err := ensureBackupDir(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"backup_20240115_143022.json", "backup_20240115_150000_0a1b2c3d.json", "backup_20240116_090000_ffee0011.json"} {
+		if err := os.WriteFile(filepath.Join(GetBackupDir(), name), []byte(`{"timestamp":"2024-01-15T14:30:22Z","variables":{}}`), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := map[string]string{
+		"backup_20240115_143022.json": "backup_20240115_143022.json",
+		"20240115_143022":             "backup_20240115_143022.json",
+		"20240115_15":                 "backup_20240115_150000_0a1b2c3d.json",
+		"backup_20240116":             "backup_20240116_090000_ffee0011.json",
+	}
+	for name, want := range cases {
+		if got, err := ResolveBackup(name); err != nil || got != want {
+			t.Errorf("ResolveBackup(%q) = %q, %v, expected %q", name, got, err, want)
+		}
+	}
+
+	for _, name := range []string{"20240115", "2023", "../backup.json", "..", ".", `..\backup.json`, ""} {
+		if got, err := ResolveBackup(name); err == nil {
+			t.Errorf("Expected ResolveBackup(%q) to fail, got %q", name, got)
+		}
+	}
+}
+
+func TestContentHashIgnoresSealing(t *testing.T) {
+	vars := map[string]string{config.EnvFoundryResource: "res", config.EnvFoundryAPIKey: "sk-key"}
+	plain := &Backup{Description: "a", Variables: map[string]string{}}
+	for key, value := range vars {
+		plain.Variables[key] = value
+	}
+	sealed := &Backup{Description: "b", Variables: map[string]string{}}
+	for key, value := range vars {
+		sealed.Variables[key] = value
+	}
+	sealed.Sealed = &SealedSecrets{Mode: SecretsRedact, Fingerprints: sealed.takeSecrets().mapValues(fingerprint)}
+
+	if plain.contentHash() != sealed.contentHash() {
+		t.Error("Expected a redacted backup to hash like the plain one")
+	}
+	plain.Variables[config.EnvFoundryAPIKey] = "sk-other"
+	if plain.contentHash() == sealed.contentHash() {
+		t.Error("Expected a different key to change the hash")
+	}
+}
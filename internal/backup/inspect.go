@@ -0,0 +1,242 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+// Kinds of change between two configurations
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// Entry is a variable of a backup as shown to the user. Secret values are
+// masked and carry their fingerprint.
+type Entry struct {
+	Path  string `json:"path,omitempty"` // settings file; empty for the store
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Note  string `json:"note,omitempty"` // "reference", "redacted" or "encrypted"
+}
+
+// Change is a variable that differs between two configurations. Old and
+// New are shown as in Entry.
+type Change struct {
+	Path   string `json:"path,omitempty"` // settings file; empty for the store
+	Key    string `json:"key"`
+	Change string `json:"change"` // ChangeAdded, ChangeRemoved or ChangeChanged
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+// item is a variable of a backup: the value compared with other backups,
+// and the value shown
+type item struct {
+	compare string
+	entry   Entry
+}
+
+// LoadBackup reads a backup file from the backup directory, upgrading it
+// to the current schema
+func LoadBackup(filename string) (*Backup, error) {
+	data, err := os.ReadFile(filepath.Join(GetBackupDir(), filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup file: %w", err)
+	}
+	backup, err := parseBackup(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse backup file: %w", err)
+	}
+	return backup, nil
+}
+
+// Snapshot returns the current configuration of the store as a backup
+// that is not written anywhere, for comparing backups with
+func Snapshot(store config.EnvStore) (*Backup, error) {
+	snapshot := &Backup{
+		Timestamp:   time.Now(),
+		Description: "Current configuration",
+		Variables:   config.GetAllVars(store),
+		Settings:    settingsVars(),
+	}
+	if err := snapshot.useRefs(); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Entries returns the variables of the backup, those of the store first
+// and then those of each settings file, in order
+func (b *Backup) Entries() []Entry {
+	items := b.items()
+	entries := []Entry{}
+	items.each(func(path, key string, it item) {
+		entries = append(entries, it.entry)
+	})
+	return entries
+}
+
+// Diff returns the variables that differ between from and to. Secrets are
+// compared by fingerprint, so sealed backups compare without decrypting.
+func Diff(from, to *Backup) []Change {
+	older, newer := from.items(), to.items()
+	changes := []Change{}
+	older.each(func(path, key string, o item) {
+		n, ok := newer.get(path, key)
+		switch {
+		case !ok:
+			changes = append(changes, Change{Path: path, Key: key, Change: ChangeRemoved, Old: o.entry.Value})
+		case n.compare != o.compare:
+			changes = append(changes, Change{Path: path, Key: key, Change: ChangeChanged, Old: o.entry.Value, New: n.entry.Value})
+		}
+	})
+	newer.each(func(path, key string, n item) {
+		if _, ok := older.get(path, key); !ok {
+			changes = append(changes, Change{Path: path, Key: key, Change: ChangeAdded, New: n.entry.Value})
+		}
+	})
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Path != changes[j].Path {
+			return changes[i].Path < changes[j].Path
+		}
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// PreviewRestore returns what restoring the variables match selects from
+// the backup (all with a nil match, see RestoreSelected) would change in
+// the current configuration. Settings files the backup does not hold, and
+// secrets redacted in it and variables the tool never writes (see
+// dropUnmanaged) are left alone by a restore and so are left out.
+func PreviewRestore(store config.EnvStore, filename string, match func(key string) bool) ([]Change, error) {
+	b, err := LoadBackup(filename)
+	if err != nil {
+		return nil, err
+	}
+	current, err := Snapshot(store)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+	for _, change := range Diff(current, b) {
+		if match != nil && !match(change.Key) {
+			continue
+		}
+		if b.redacted(change.Path, change.Key) || config.ValidateManagedKey(change.Key) != nil {
+			continue
+		}
+		if change.Path == "" || b.hasSettings(change.Path) {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// hasSettings reports whether the backup holds the settings file at path
+func (b *Backup) hasSettings(path string) bool {
+	if _, ok := b.Settings[path]; ok {
+		return true
+	}
+	if b.Sealed != nil {
+		_, ok := b.Sealed.Fingerprints.Settings[path]
+		return ok
+	}
+	return false
+}
+
+// redacted reports whether the backup holds only the fingerprint of a
+// secret, so that a restore keeps the current value
+func (b *Backup) redacted(path, key string) bool {
+	if b.Sealed == nil || b.Sealed.Mode != SecretsRedact {
+		return false
+	}
+	return b.Sealed.Fingerprints.get(path, key) != ""
+}
+
+// itemSet holds the items of a backup keyed by settings file, with "" for
+// the store
+type itemSet map[string]map[string]item
+
+// items returns every variable of the backup, including sealed secrets
+func (b *Backup) items() itemSet {
+	items := itemSet{}
+	add := func(path string, vars map[string]string) {
+		for key, value := range vars {
+			it := item{compare: value, entry: Entry{Path: path, Key: key, Value: value}}
+			switch {
+			case containsString(b.Refs, key):
+				it.entry.Note = "reference"
+			case config.IsSecret(key) && value != "":
+				it.compare = fingerprint(value)
+				it.entry.Value = maskSecret(value) + " (" + it.compare + ")"
+			}
+			items.set(path, key, it)
+		}
+	}
+
+	add("", b.Variables)
+	for path, vars := range b.Settings {
+		add(path, vars)
+	}
+	if b.Sealed != nil {
+		note := "encrypted"
+		if b.Sealed.Mode == SecretsRedact {
+			note = "redacted"
+		}
+		b.Sealed.Fingerprints.each(func(path, key, print string) {
+			items.set(path, key, item{compare: print, entry: Entry{Path: path, Key: key, Value: "(" + print + ")", Note: note}})
+		})
+	}
+	return items
+}
+
+// get returns an item of the set
+func (s itemSet) get(path, key string) (item, bool) {
+	it, ok := s[path][key]
+	return it, ok
+}
+
+// set stores an item in the set
+func (s itemSet) set(path, key string, it item) {
+	if s[path] == nil {
+		s[path] = map[string]item{}
+	}
+	s[path][key] = it
+}
+
+// each calls fn for every item in order, those of the store first
+func (s itemSet) each(fn func(path, key string, it item)) {
+	paths := make([]string, 0, len(s))
+	for path := range s {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		keys := make([]string, 0, len(s[path]))
+		for key := range s[path] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fn(path, key, s[path][key])
+		}
+	}
+}
+
+// maskSecret shows only the start of a secret
+func maskSecret(value string) string {
+	if len(value) <= 8 {
+		return "***"
+	}
+	return value[:8] + "***"
+}
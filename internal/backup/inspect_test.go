@@ -0,0 +1,102 @@
+package backup
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+func TestDiff(t *testing.T) {
+	from := &Backup{Variables: map[string]string{
+		config.EnvUseFoundry:      "true",
+		config.EnvFoundryResource: "old-resource",
+		config.EnvFoundryAPIKey:   "sk-first-key-value",
+		"ANTHROPIC_MODEL":         "old-model",
+	}}
+	to := &Backup{Variables: map[string]string{
+		config.EnvUseFoundry:         "true",
+		config.EnvFoundryResource:    "new-resource",
+		config.EnvFoundryAPIKey:      "sk-second-key-value",
+		"ANTHROPIC_SMALL_FAST_MODEL": "haiku",
+	}}
+
+	changes := Diff(from, to)
+	kinds := map[string]string{}
+	for _, c := range changes {
+		kinds[c.Key] = c.Change
+		if strings.Contains(c.Old, "first-key") || strings.Contains(c.New, "second-key") {
+			t.Errorf("Expected %s to be masked, got %q -> %q", c.Key, c.Old, c.New)
+		}
+	}
+	expected := map[string]string{
+		config.EnvFoundryResource:    ChangeChanged,
+		config.EnvFoundryAPIKey:      ChangeChanged,
+		"ANTHROPIC_MODEL":            ChangeRemoved,
+		"ANTHROPIC_SMALL_FAST_MODEL": ChangeAdded,
+	}
+	if len(kinds) != len(expected) {
+		t.Errorf("Expected %d changes, got %v", len(expected), changes)
+	}
+	for key, kind := range expected {
+		if kinds[key] != kind {
+			t.Errorf("Expected %s to be %s, got %q", key, kind, kinds[key])
+		}
+	}
+
+	if changes := Diff(from, from); len(changes) != 0 {
+		t.Errorf("Expected no changes against itself, got %v", changes)
+	}
+}
+
+func TestPreviewRestoreComparesSealedSecrets(t *testing.T) {
+	store := sealTestSetup(t, Settings{Secrets: SecretsRedact})
+	path, err := createBackup(store, "redacted", KindManual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Base(path)
+
+	changes, err := PreviewRestore(store, filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("Expected no changes right after the backup, got %v", changes)
+	}
+
+	store.Set(config.EnvFoundryAPIKey, "sk-rotated-key")
+	store.Set(config.EnvFoundryResource, "other")
+	changes, err = PreviewRestore(store, filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The restore keeps the rotated key, as the backup has none
+	if len(changes) != 1 {
+		t.Fatalf("Expected 1 change, got %v", changes)
+	}
+	if c := changes[0]; c.Key != config.EnvFoundryResource || c.Change != ChangeChanged || c.Old != "other" || c.New != "res" {
+		t.Errorf("Expected the resource to change from other to res, got %+v", c)
+	}
+
+	current, err := Snapshot(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := LoadBackup(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range Diff(current, b) {
+		if strings.Contains(c.Old+c.New, "rotated-key") {
+			t.Errorf("Expected the key to be masked, got %s -> %s", c.Old, c.New)
+		}
+	}
+
+	for _, e := range b.Entries() {
+		if e.Key == config.EnvFoundryAPIKey && e.Note != "redacted" {
+			t.Errorf("Expected the key to be noted as redacted, got %q", e.Note)
+		}
+	}
+}
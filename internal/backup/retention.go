@@ -0,0 +1,166 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+// Every configure, rollback and restore creates an automatic backup. The
+// retention policy prunes old automatic backups after each new one, and on
+// demand with "backup prune". Manual and pinned backups are never pruned.
+
+// Backup kinds
+const (
+	KindAuto   = "auto"
+	KindManual = "manual"
+)
+
+// Retention is the policy for automatic backups. A backup is pruned when it
+// is older than MaxAgeDays, or when it is neither among the KeepLast newest
+// nor the newest of a day within the last KeepDaily days. With KeepLast and
+// KeepDaily both 0, only the age limit applies; a zero policy keeps
+// everything.
+type Retention struct {
+	KeepLast   int `json:"keep_last"`
+	KeepDaily  int `json:"keep_daily"`
+	MaxAgeDays int `json:"max_age_days"`
+}
+
+// DefaultRetention applies until a policy is set with "backup settings"
+var DefaultRetention = Retention{KeepLast: 10, KeepDaily: 30}
+
+// RetentionPolicy returns the policy of the settings, or the default
+func (s Settings) RetentionPolicy() Retention {
+	if s.Retention == nil {
+		return DefaultRetention
+	}
+	return *s.Retention
+}
+
+// String describes the policy
+func (r Retention) String() string {
+	parts := []string{}
+	if r.KeepLast > 0 {
+		parts = append(parts, fmt.Sprintf("keep the last %d", r.KeepLast))
+	}
+	if r.KeepDaily > 0 {
+		parts = append(parts, fmt.Sprintf("keep one a day for %d days", r.KeepDaily))
+	}
+	if r.MaxAgeDays > 0 {
+		parts = append(parts, fmt.Sprintf("remove after %d days", r.MaxAgeDays))
+	}
+	if len(parts) == 0 {
+		return "keep all"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// validate checks the policy has no negative values
+func (r Retention) validate() error {
+	if r.KeepLast < 0 || r.KeepDaily < 0 || r.MaxAgeDays < 0 {
+		return fmt.Errorf("retention values cannot be negative")
+	}
+	return nil
+}
+
+// Prunable returns the backups the policy removes at now. backups may be
+// in any order; manual, pinned and unreadable backups are never returned.
+func (r Retention) Prunable(backups []BackupInfo, now time.Time) []BackupInfo {
+	auto := []BackupInfo{}
+	for _, b := range backups {
+		if !b.Manual && !b.Pinned && b.Problem == "" {
+			auto = append(auto, b)
+		}
+	}
+	sort.Slice(auto, func(i, j int) bool {
+		return auto[i].Timestamp.After(auto[j].Timestamp)
+	})
+
+	onlyAge := r.KeepLast == 0 && r.KeepDaily == 0
+	if onlyAge && r.MaxAgeDays == 0 {
+		return nil
+	}
+
+	dailyFrom := startOfDay(now).AddDate(0, 0, -(r.KeepDaily - 1))
+	seenDays := map[time.Time]bool{}
+	prunable := []BackupInfo{}
+	for i, b := range auto {
+		day := startOfDay(b.Timestamp)
+		newestOfDay := !seenDays[day]
+		seenDays[day] = true
+
+		switch {
+		case r.MaxAgeDays > 0 && now.Sub(b.Timestamp) > time.Duration(r.MaxAgeDays)*24*time.Hour:
+			prunable = append(prunable, b)
+		case onlyAge, i < r.KeepLast:
+		case r.KeepDaily > 0 && newestOfDay && !day.Before(dailyFrom):
+		default:
+			prunable = append(prunable, b)
+		}
+	}
+	return prunable
+}
+
+// startOfDay returns midnight of the day of t, in local time
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Local().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// Prune removes the automatic backups the retention policy no longer keeps
+// and returns them. With dryRun, nothing is removed.
+func Prune(dryRun bool) ([]BackupInfo, error) {
+	return prune(dryRun, "")
+}
+
+// prune is Prune sparing the backup file keep, if any
+func prune(dryRun bool, keep string) ([]BackupInfo, error) {
+	settings, err := LoadSettings()
+	if err != nil {
+		return nil, err
+	}
+	backups, err := ListBackups()
+	if err != nil {
+		return nil, err
+	}
+
+	prunable := []BackupInfo{}
+	for _, b := range settings.RetentionPolicy().Prunable(backups, time.Now()) {
+		if b.Filename != keep {
+			prunable = append(prunable, b)
+		}
+	}
+	if dryRun {
+		return prunable, nil
+	}
+	for i, b := range prunable {
+		if err := DeleteBackup(b.Filename); err != nil {
+			return prunable[:i], fmt.Errorf("failed to delete %s: %w", b.Filename, err)
+		}
+	}
+	return prunable, nil
+}
+
+// PinBackup pins or unpins a backup; pinned backups are never pruned
+func PinBackup(filename string, pinned bool) error {
+	backup, err := LoadBackup(filename)
+	if err != nil {
+		return err
+	}
+
+	backup.Pinned = pinned
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup: %w", err)
+	}
+	if err := config.WriteFileAtomic(filepath.Join(GetBackupDir(), filename), data, 0600); err != nil {
+		return fmt.Errorf("failed to write backup file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package backup
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+func TestRetentionPrunable(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	at := func(days, hours int) time.Time {
+		return now.AddDate(0, 0, -days).Add(-time.Duration(hours) * time.Hour)
+	}
+	backups := []BackupInfo{
+		{Filename: "today-1", Timestamp: at(0, 1)},
+		{Filename: "today-2", Timestamp: at(0, 2)},
+		{Filename: "yesterday-1", Timestamp: at(1, 1)},
+		{Filename: "yesterday-2", Timestamp: at(1, 2)},
+		{Filename: "week-ago", Timestamp: at(7, 0)},
+		{Filename: "old", Timestamp: at(60, 0)},
+		{Filename: "old-manual", Timestamp: at(90, 0), Manual: true},
+		{Filename: "old-pinned", Timestamp: at(90, 0), Pinned: true},
+	}
+	names := func(infos []BackupInfo) map[string]bool {
+		set := map[string]bool{}
+		for _, b := range infos {
+			set[b.Filename] = true
+		}
+		return set
+	}
+
+	cases := []struct {
+		policy Retention
+		pruned []string
+	}{
+		{Retention{KeepLast: 1, KeepDaily: 3}, []string{"today-2", "yesterday-2", "week-ago", "old"}},
+		{Retention{KeepLast: 3}, []string{"yesterday-2", "week-ago", "old"}},
+		{Retention{KeepDaily: 30, MaxAgeDays: 30}, []string{"today-2", "yesterday-2", "old"}},
+		{Retention{MaxAgeDays: 5}, []string{"week-ago", "old"}},
+		{Retention{}, nil},
+	}
+	for _, c := range cases {
+		got := names(c.policy.Prunable(backups, now))
+		if len(got) != len(c.pruned) {
+			t.Errorf("%s: expected %v pruned, got %v", c.policy, c.pruned, got)
+			continue
+		}
+		for _, name := range c.pruned {
+			if !got[name] {
+				t.Errorf("%s: expected %s pruned, got %v", c.policy, name, got)
+			}
+		}
+	}
+}
+
+func TestPruneKeepsManualAndPinned(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	if err := SaveSettings(Settings{Secrets: SecretsPlain, Retention: &Retention{KeepLast: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensureBackupDir(); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name, description, kind string, age time.Duration) {
+		data, err := json.Marshal(Backup{
+			Timestamp:   time.Now().Add(-age),
+			Description: description,
+			Kind:        kind,
+			Variables:   map[string]string{config.EnvUseFoundry: "true"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(GetBackupDir(), name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.json", "Before configuring", KindAuto, 0)
+	write("b.json", "Before rollback", KindAuto, time.Hour)
+	write("c.json", "Before restore", KindAuto, 2*time.Hour)
+	write("m.json", "mine", KindManual, 3*time.Hour)
+	// Backups from before kinds were recorded
+	write("legacy-auto.json", "Before rollback to default", "", 4*time.Hour)
+	write("legacy-manual.json", "Known good", "", 5*time.Hour)
+	if err := PinBackup("c.json", true); err != nil {
+		t.Fatal(err)
+	}
+
+	pruned, err := Prune(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 2 || pruned[0].Filename != "b.json" || pruned[1].Filename != "legacy-auto.json" {
+		t.Errorf("Expected b.json and legacy-auto.json to be prunable, got %+v", pruned)
+	}
+	if _, err := os.Stat(filepath.Join(GetBackupDir(), "b.json")); err != nil {
+		t.Error("Expected a dry run to remove nothing")
+	}
+
+	if _, err := Prune(false); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := ListBackups()
+	if len(list) != 4 {
+		t.Errorf("Expected 4 backups left, got %+v", list)
+	}
+	for _, b := range list {
+		if b.Filename == "c.json" && !b.Pinned || b.Filename == "m.json" && !b.Manual || b.Filename == "legacy-manual.json" && !b.Manual {
+			t.Errorf("Unexpected flags for %s: %+v", b.Filename, b)
+		}
+	}
+}
+
+func TestRestoreBackupIsNotPruned(t *testing.T) {
+	store := sealTestSetup(t, Settings{Secrets: SecretsPlain, Retention: &Retention{KeepLast: 1}})
+	path, err := createBackup(store, "Before configuring", KindAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Base(path)
+	store.Set(config.EnvFoundryResource, "newer")
+	if _, err := createBackup(store, "Before rollback", KindAuto); err != nil {
+		t.Fatal(err)
+	}
+	store.Set(config.EnvFoundryResource, "current")
+
+	// The retention policy keeps only the latest backup, the one made
+	// before restoring, yet the backup restored must survive it
+	if err := CreateRestoreBackup(store, filename); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RestoreBackup(store, filename); err != nil {
+		t.Fatalf("Expected the backup restored to be kept, got %v", err)
+	}
+	if got, _ := store.Get(config.EnvFoundryResource); got != "res" {
+		t.Errorf("Expected the resource to be restored, got %q", got)
+	}
+	list, _ := ListBackups()
+	if len(list) != 2 {
+		t.Errorf("Expected the other backup to be pruned, got %+v", list)
+	}
+}
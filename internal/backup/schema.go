@@ -0,0 +1,147 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+// SchemaVersion is the version of the backup format written. Files of an
+// older version are upgraded when read by the migrations below; files of a
+// newer one are refused.
+//
+//	1  timestamp, description and variables, with the settings, refs,
+//	   sealed, kind and pinned fields added along the way (no version field)
+//	2  schema_version, metadata and file snapshots; kind is always set
+const SchemaVersion = 2
+
+// migrations[i] upgrades a backup from version i+1 to version i+2
+var migrations = []func(b *Backup){
+	migrateV1,
+}
+
+// Metadata records where and how a backup was made
+type Metadata struct {
+	Hostname string `json:"hostname,omitempty"`
+	OS       string `json:"os,omitempty"` // GOOS/GOARCH
+	// Shell is the shell dialect of the profile backed up, and Location
+	// the profile, settings file or registry key; several are comma separated
+	Shell       string   `json:"shell,omitempty"`
+	Location    string   `json:"location,omitempty"`
+	ToolVersion string   `json:"tool_version,omitempty"`
+	Command     string   `json:"command,omitempty"` // the command that made the backup
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// Command names the command being run, for the metadata of new backups;
+// the cmd package sets it
+var Command string
+
+// parseBackup decodes a backup file and upgrades it to SchemaVersion
+func parseBackup(data []byte) (*Backup, error) {
+	var backup Backup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, err
+	}
+	if backup.Timestamp.IsZero() {
+		return nil, fmt.Errorf("not a backup: no timestamp")
+	}
+
+	version := backup.SchemaVersion
+	if version == 0 {
+		version = 1
+	}
+	if version > SchemaVersion {
+		return nil, fmt.Errorf("schema version %d is newer than this tool supports (%d); upgrade claude-foundry-manager", version, SchemaVersion)
+	}
+	for ; version < SchemaVersion; version++ {
+		migrations[version-1](&backup)
+	}
+	backup.SchemaVersion = SchemaVersion
+	return &backup, nil
+}
+
+// v1AutoDescriptions are the descriptions of the automatic backups made
+// before kinds were recorded
+var v1AutoDescriptions = map[string]bool{
+	"Before configuring Azure Foundry": true,
+	"Before rollback to default":       true,
+	"Before restore operation":         true,
+}
+
+// migrateV1 sets the kind of backups made before kinds were recorded:
+// those with a description the tool wrote itself were automatic
+func migrateV1(b *Backup) {
+	if b.Variables == nil {
+		b.Variables = map[string]string{}
+	}
+	if b.Kind == "" {
+		b.Kind = KindManual
+		if v1AutoDescriptions[b.Description] {
+			b.Kind = KindAuto
+		}
+	}
+}
+
+// newMetadata describes the machine, store and command of a new backup
+func newMetadata(store config.EnvStore, tags []string) Metadata {
+	hostname, _ := os.Hostname()
+	shell, location := describeStore(store)
+	return Metadata{
+		Hostname:    hostname,
+		OS:          runtime.GOOS + "/" + runtime.GOARCH,
+		Shell:       shell,
+		Location:    location,
+		ToolVersion: toolVersion(),
+		Command:     Command,
+		Tags:        tags,
+	}
+}
+
+// describeStore returns the shell and location of a store, joining those
+// of the stores of a MultiStore
+func describeStore(store config.EnvStore) (shell, location string) {
+	if multi, ok := store.(interface{ Stores() []config.EnvStore }); ok {
+		shells, locations := []string{}, []string{}
+		for _, s := range multi.Stores() {
+			shell, location := describeStore(s)
+			if shell != "" {
+				shells = append(shells, shell)
+			}
+			if location != "" {
+				locations = append(locations, location)
+			}
+		}
+		return strings.Join(shells, ", "), strings.Join(locations, ", ")
+	}
+	if s, ok := store.(interface{ Shell() string }); ok {
+		shell = s.Shell()
+	}
+	if s, ok := store.(interface{ Path() string }); ok {
+		location = s.Path()
+	}
+	return shell, location
+}
+
+// toolVersion returns the module version of the binary, or the VCS
+// revision it was built from
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+			return "devel+" + setting.Value[:12]
+		}
+	}
+	return "devel"
+}
@@ -0,0 +1,117 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+func TestParseBackupMigratesV1(t *testing.T) {
+	cases := map[string]string{
+		`{"timestamp":"2024-01-15T14:30:22Z","description":"Before configuring Azure Foundry","variables":{"CLAUDE_CODE_USE_FOUNDRY":"true"}}`: KindAuto,
+		`{"timestamp":"2024-01-15T14:30:22Z","description":"before upgrade","variables":null}`:                                                 KindManual,
+		`{"timestamp":"2024-01-15T14:30:22Z","description":"Before the upgrade","variables":{}}`:                                               KindManual,
+		`{"timestamp":"2024-01-15T14:30:22Z","description":"Before x","kind":"manual","variables":{}}`:                                         KindManual,
+	}
+	for data, kind := range cases {
+		b, err := parseBackup([]byte(data))
+		if err != nil {
+			t.Fatalf("parseBackup failed: %v", err)
+		}
+		if b.SchemaVersion != SchemaVersion {
+			t.Errorf("Expected schema version %d, got %d", SchemaVersion, b.SchemaVersion)
+		}
+		if b.Kind != kind {
+			t.Errorf("Expected %q to be %s, got %s", b.Description, kind, b.Kind)
+		}
+		if b.Variables == nil {
+			t.Error("Expected variables to be set")
+		}
+	}
+
+	if _, err := parseBackup([]byte(`{"schema_version":99,"timestamp":"2024-01-15T14:30:22Z"}`)); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("Expected a newer schema to be refused, got %v", err)
+	}
+	if _, err := parseBackup([]byte(`{"name":"something else"}`)); err == nil {
+		t.Error("Expected JSON without a timestamp to be refused")
+	}
+}
+
+func TestBackupRecordsMetadata(t *testing.T) {
+	sealTestSetup(t, Settings{Secrets: SecretsPlain})
+	saved := Command
+	Command = "claude-foundry-manager backup create"
+	t.Cleanup(func() { Command = saved })
+
+	profile, err := config.NewShellStore(os.Getenv("HOME"), "bash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.ApplyFoundryConfig(profile, &config.FoundryConfig{Resource: "res", APIKey: "sk-key"}); err != nil {
+		t.Fatal(err)
+	}
+	filename, err := CreateManualBackup(profile, "tagged", "release", "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := LoadBackup(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := b.Metadata
+	if m.OS != runtime.GOOS+"/"+runtime.GOARCH || m.Shell != "posix" || m.Location != profile.Path() {
+		t.Errorf("Expected the OS, shell and profile, got %+v", m)
+	}
+	if m.Command != Command || m.ToolVersion == "" || strings.Join(m.Tags, ",") != "release,laptop" {
+		t.Errorf("Expected the command, version and tags, got %+v", m)
+	}
+
+	list, err := ListBackups()
+	if err != nil || len(list) != 1 || strings.Join(list[0].Tags, ",") != "release,laptop" {
+		t.Errorf("Expected the tags in the listing, got %+v, %v", list, err)
+	}
+}
+
+func TestListBackupsReportsUnreadableFiles(t *testing.T) {
+	sealTestSetup(t, Settings{Secrets: SecretsPlain})
+	if err := ensureBackupDir(); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"backup_20240115_143022.json": `{"timestamp":"2024-01-15T14:30:22Z","description":"Before restore operation","variables":{}}`,
+		"backup_20240116_090000.json": `{"timestamp":`,
+		"backup_20240117_090000.json": `{"schema_version":99,"timestamp":"2024-01-17T09:00:00Z"}`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(GetBackupDir(), name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := ListBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("Expected 3 entries, got %+v", list)
+	}
+	if list[0].Filename != "backup_20240115_143022.json" || list[0].Problem != "" {
+		t.Errorf("Expected the readable backup first, got %+v", list[0])
+	}
+	for _, b := range list[1:] {
+		if b.Problem == "" {
+			t.Errorf("Expected %s to report a problem", b.Filename)
+		}
+	}
+
+	// Only the readable backup is ever pruned
+	prunable := (Retention{MaxAgeDays: 1}).Prunable(list, list[0].Timestamp.AddDate(1, 0, 0))
+	if len(prunable) != 1 || prunable[0].Filename != "backup_20240115_143022.json" {
+		t.Errorf("Expected only the readable backup to be prunable, got %+v", prunable)
+	}
+}
@@ -0,0 +1,501 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Backups can keep secret variables (API keys and tokens, see
+// config.IsSecret) out of the backup file. The other variables stay
+// readable, so backups can still be listed and compared.
+
+// Secret modes of backups
+const (
+	SecretsPlain      = "plain"      // secrets are stored as is
+	SecretsRedact     = "redact"     // only a fingerprint of each secret is stored
+	SecretsPassphrase = "passphrase" // secrets are encrypted with a passphrase
+	SecretsAge        = "age"        // secrets are encrypted to an age recipient
+)
+
+// PassphraseEnv holds the backup passphrase, so it is not asked for
+const PassphraseEnv = "CLAUDE_FOUNDRY_BACKUP_PASSPHRASE"
+
+// PassphraseFunc asks the user for the backup passphrase. It is nil when
+// nobody can be asked.
+var PassphraseFunc func(prompt string) (string, error)
+
+// sealAAD binds encrypted secrets to their purpose
+const sealAAD = "claude-foundry-manager backup secrets v1"
+
+// checkMessage is authenticated with the passphrase key to check a
+// passphrase without storing it
+const checkMessage = "claude-foundry-manager backup passphrase check"
+
+// kdfIterations is the PBKDF2-HMAC-SHA256 work factor for new backups
+var kdfIterations = 600000
+
+// KDF holds the PBKDF2 parameters of a passphrase key, and a value
+// authenticated with that key
+type KDF struct {
+	Salt       string `json:"salt"`
+	Iterations int    `json:"iterations"`
+	Check      string `json:"check,omitempty"`
+}
+
+// SecretSet holds secret variables laid out like the backup: those of the
+// store, and those of each settings file
+type SecretSet struct {
+	Variables map[string]string            `json:"variables,omitempty"`
+	Settings  map[string]map[string]string `json:"settings,omitempty"`
+}
+
+// SealedSecrets replaces the secret variables of a backup
+type SealedSecrets struct {
+	Mode string `json:"mode"`
+	// Fingerprints has a short SHA-256 of each secret, so a secret the
+	// store still holds is restored without decrypting anything
+	Fingerprints SecretSet `json:"fingerprints"`
+	KDF          *KDF      `json:"kdf,omitempty"`
+	Nonce        string    `json:"nonce,omitempty"`
+	// Ciphertext is base64 for passphrase and armored for age
+	Ciphertext string `json:"ciphertext,omitempty"`
+}
+
+// errNoPassphrase is returned when no passphrase is available
+var errNoPassphrase = errors.New("no backup passphrase given")
+
+// SetPassphrase records a check of passphrase in s, so later backups refuse
+// a different one
+func (s *Settings) SetPassphrase(passphrase string) error {
+	if passphrase == "" {
+		return fmt.Errorf("the passphrase cannot be empty")
+	}
+	kdf, key, err := newKDF(passphrase)
+	if err != nil {
+		return err
+	}
+	kdf.Check = base64.StdEncoding.EncodeToString(checkMAC(key))
+	s.PassphraseCheck = kdf
+	return nil
+}
+
+// seal moves the secret variables of the backup out of Variables and
+// Settings according to the backup settings. Values that are secret
+// references are not secret and stay. Secrets that could only be redacted
+// are reported by the returned warning.
+func (b *Backup) seal() (warning error, err error) {
+	settings, err := LoadSettings()
+	if err != nil {
+		return nil, err
+	}
+	if settings.Secrets == SecretsPlain {
+		return nil, nil
+	}
+
+	secrets := b.takeSecrets()
+	if len(secrets.Variables) == 0 && len(secrets.Settings) == 0 {
+		return nil, nil
+	}
+
+	sealed := &SealedSecrets{Mode: settings.Secrets, Fingerprints: secrets.mapValues(fingerprint)}
+	switch settings.Secrets {
+	case SecretsPassphrase:
+		passphrase, err := askPassphrase(settings.PassphraseCheck)
+		if errors.Is(err, errNoPassphrase) {
+			// Nobody to ask, e.g. a script; a redacted backup beats none
+			sealed.Mode = SecretsRedact
+			warning = fmt.Errorf("its secrets are redacted instead of encrypted: %w", err)
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := sealed.encryptPassphrase(passphrase, secrets); err != nil {
+			return nil, err
+		}
+	case SecretsAge:
+		if err := sealed.encryptAge(settings.AgeRecipient, secrets); err != nil {
+			return nil, err
+		}
+	}
+	b.Sealed = sealed
+	return warning, nil
+}
+
+// takeSecrets removes the secret variables from the backup and returns them
+func (b *Backup) takeSecrets() SecretSet {
+	take := func(vars map[string]string) map[string]string {
+		taken := map[string]string{}
+		for key, value := range vars {
+			if value != "" && config.IsSecret(key) && !containsString(b.Refs, key) {
+				taken[key] = value
+				delete(vars, key)
+			}
+		}
+		if len(taken) == 0 {
+			return nil
+		}
+		return taken
+	}
+
+	secrets := SecretSet{Variables: take(b.Variables)}
+	for path, vars := range b.Settings {
+		if taken := take(vars); taken != nil {
+			if secrets.Settings == nil {
+				secrets.Settings = map[string]map[string]string{}
+			}
+			secrets.Settings[path] = taken
+		}
+	}
+	return secrets
+}
+
+// unseal puts the secrets of the backup back into Variables and Settings.
+// Secrets the stores still hold are taken from there; the others are
+// decrypted, asking for the passphrase only then. Redacted secrets that
+// changed keep their current value, and a warning is returned for each.
+func (b *Backup) unseal(store config.EnvStore) ([]string, error) {
+	if b.Sealed == nil {
+		return nil, nil
+	}
+
+	current := func(path, key string) string {
+		var value string
+		if path == "" {
+			value, _ = store.Get(key)
+		} else {
+			value, _ = config.NewSettingsStore(path).Get(key)
+		}
+		return value
+	}
+
+	values := SecretSet{}
+	missing := false
+	b.Sealed.Fingerprints.each(func(path, key, print string) {
+		if value := current(path, key); value != "" && fingerprint(value) == print {
+			values.set(path, key, value)
+		} else {
+			missing = true
+		}
+	})
+
+	var warnings []string
+	if missing {
+		var decrypted SecretSet
+		var err error
+		switch b.Sealed.Mode {
+		case SecretsPassphrase:
+			decrypted, err = b.Sealed.decryptPassphrase()
+		case SecretsAge:
+			decrypted, err = b.Sealed.decryptAge()
+		case SecretsRedact:
+		default:
+			err = fmt.Errorf("unknown secret mode %q", b.Sealed.Mode)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		b.Sealed.Fingerprints.each(func(path, key, print string) {
+			if value := values.get(path, key); value != "" {
+				return
+			}
+			if value := decrypted.get(path, key); value != "" {
+				values.set(path, key, value)
+				return
+			}
+			where := key
+			if path != "" {
+				where = fmt.Sprintf("%s in %s", key, path)
+			}
+			if value := current(path, key); value != "" {
+				warnings = append(warnings, fmt.Sprintf("%s is redacted in the backup and differs now; the current value is kept", where))
+				values.set(path, key, value)
+			} else {
+				warnings = append(warnings, fmt.Sprintf("%s is redacted in the backup and is left unset; configure it again", where))
+			}
+		})
+	}
+
+	restored := SecretSet{Variables: b.Variables, Settings: b.Settings}
+	values.each(restored.set)
+	b.Variables, b.Settings = restored.Variables, restored.Settings
+	return warnings, nil
+}
+
+// encryptPassphrase encrypts secrets with AES-256-GCM under a key derived
+// from passphrase
+func (s *SealedSecrets) encryptPassphrase(passphrase string, secrets SecretSet) error {
+	kdf, key, err := newKDF(passphrase)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets: %w", err)
+	}
+
+	s.KDF = kdf
+	s.Nonce = base64.StdEncoding.EncodeToString(nonce)
+	s.Ciphertext = base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, plaintext, []byte(sealAAD)))
+	return nil
+}
+
+// decryptPassphrase asks for the passphrase and decrypts the secrets
+func (s *SealedSecrets) decryptPassphrase() (SecretSet, error) {
+	if s.KDF == nil {
+		return SecretSet{}, fmt.Errorf("the backup has no key derivation parameters")
+	}
+	passphrase, err := askPassphrase(nil)
+	if err != nil {
+		return SecretSet{}, fmt.Errorf("the backup's secrets are encrypted: %w", err)
+	}
+	key, err := s.KDF.derive(passphrase)
+	if err != nil {
+		return SecretSet{}, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return SecretSet{}, err
+	}
+	nonce, err := base64.StdEncoding.DecodeString(s.Nonce)
+	if err != nil || len(nonce) != gcm.NonceSize() {
+		return SecretSet{}, fmt.Errorf("invalid nonce in backup")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(s.Ciphertext)
+	if err != nil {
+		return SecretSet{}, fmt.Errorf("invalid ciphertext in backup: %w", err)
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(sealAAD))
+	if err != nil {
+		return SecretSet{}, fmt.Errorf("wrong backup passphrase")
+	}
+
+	var secrets SecretSet
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return SecretSet{}, fmt.Errorf("failed to parse decrypted secrets: %w", err)
+	}
+	return secrets, nil
+}
+
+// encryptAge encrypts secrets to recipient with the age CLI
+func (s *SealedSecrets) encryptAge(recipient string, secrets SecretSet) error {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets: %w", err)
+	}
+	out, err := runAge(plaintext, "--encrypt", "--armor", "--recipient", recipient)
+	if err != nil {
+		return err
+	}
+	s.Ciphertext = string(out)
+	return nil
+}
+
+// decryptAge decrypts the secrets with the identity of the backup settings
+func (s *SealedSecrets) decryptAge() (SecretSet, error) {
+	settings, err := LoadSettings()
+	if err != nil {
+		return SecretSet{}, err
+	}
+	if settings.AgeIdentity == "" {
+		return SecretSet{}, fmt.Errorf("the backup's secrets are encrypted with age; set an identity file with 'backup settings --age-identity'")
+	}
+	out, err := runAge([]byte(s.Ciphertext), "--decrypt", "--identity", settings.AgeIdentity)
+	if err != nil {
+		return SecretSet{}, err
+	}
+
+	var secrets SecretSet
+	if err := json.Unmarshal(out, &secrets); err != nil {
+		return SecretSet{}, fmt.Errorf("failed to parse decrypted secrets: %w", err)
+	}
+	return secrets, nil
+}
+
+// runAge runs the age CLI with input on stdin and returns its output
+func runAge(input []byte, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath("age"); err != nil {
+		return nil, fmt.Errorf("age is not installed: %w", err)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("age", args...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("age failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// askPassphrase returns the passphrase from PassphraseEnv, or asks for it.
+// When check is given, a passphrase that does not match it is refused.
+func askPassphrase(check *KDF) (string, error) {
+	passphrase := os.Getenv(PassphraseEnv)
+	if passphrase == "" && PassphraseFunc != nil {
+		var err error
+		if passphrase, err = PassphraseFunc("Backup passphrase: "); err != nil {
+			return "", fmt.Errorf("%w: %v", errNoPassphrase, err)
+		}
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("%w (set %s)", errNoPassphrase, PassphraseEnv)
+	}
+
+	if check != nil && check.Check != "" {
+		key, err := check.derive(passphrase)
+		if err != nil {
+			return "", err
+		}
+		want, _ := base64.StdEncoding.DecodeString(check.Check)
+		if !hmac.Equal(checkMAC(key), want) {
+			return "", fmt.Errorf("wrong backup passphrase")
+		}
+	}
+	return passphrase, nil
+}
+
+// newKDF derives a key from passphrase with a fresh salt
+func newKDF(passphrase string) (*KDF, []byte, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	kdf := &KDF{Salt: base64.StdEncoding.EncodeToString(salt), Iterations: kdfIterations}
+	key, err := kdf.derive(passphrase)
+	return kdf, key, err
+}
+
+// derive returns the 32-byte key for passphrase
+func (k *KDF) derive(passphrase string) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(k.Salt)
+	if err != nil || len(salt) == 0 {
+		return nil, fmt.Errorf("invalid salt in backup")
+	}
+	if k.Iterations < 1 {
+		return nil, fmt.Errorf("invalid iteration count %d", k.Iterations)
+	}
+	return pbkdf2.Key([]byte(passphrase), salt, k.Iterations, 32, sha256.New), nil
+}
+
+// checkMAC authenticates checkMessage with key
+func checkMAC(key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(checkMessage))
+	return mac.Sum(nil)
+}
+
+// newGCM returns AES-GCM for a 32-byte key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// fingerprint returns a short SHA-256 of a secret, enough to recognise it
+// without giving it away
+func fingerprint(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// each calls fn for every variable of the set in a stable order; path is
+// empty for the variables of the store
+func (s SecretSet) each(fn func(path, key, value string)) {
+	for _, key := range sortedMapKeys(s.Variables) {
+		fn("", key, s.Variables[key])
+	}
+	paths := make([]string, 0, len(s.Settings))
+	for path := range s.Settings {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		for _, key := range sortedMapKeys(s.Settings[path]) {
+			fn(path, key, s.Settings[path][key])
+		}
+	}
+}
+
+// get returns a variable of the set
+func (s SecretSet) get(path, key string) string {
+	if path == "" {
+		return s.Variables[key]
+	}
+	return s.Settings[path][key]
+}
+
+// set stores a variable in the set
+func (s *SecretSet) set(path, key, value string) {
+	if path == "" {
+		if s.Variables == nil {
+			s.Variables = map[string]string{}
+		}
+		s.Variables[key] = value
+		return
+	}
+	if s.Settings == nil {
+		s.Settings = map[string]map[string]string{}
+	}
+	if s.Settings[path] == nil {
+		s.Settings[path] = map[string]string{}
+	}
+	s.Settings[path][key] = value
+}
+
+// mapValues returns a copy of the set with fn applied to every value
+func (s SecretSet) mapValues(fn func(string) string) SecretSet {
+	out := SecretSet{}
+	s.each(func(path, key, value string) {
+		out.set(path, key, fn(value))
+	})
+	return out
+}
+
+// sortedMapKeys returns the keys of vars in order
+func sortedMapKeys(vars map[string]string) []string {
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,259 @@
+package backup
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+func TestPBKDF2(t *testing.T) {
+	// RFC 7914 section 11 and the common SHA-256 variants of RFC 6070
+	cases := []struct {
+		iterations int
+		want       string
+	}{
+		{1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+	for _, c := range cases {
+		kdf := KDF{Salt: base64.StdEncoding.EncodeToString([]byte("salt")), Iterations: c.iterations}
+		key, err := kdf.derive("password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(key); got != c.want {
+			t.Errorf("PBKDF2 with %d iterations = %s, expected %s", c.iterations, got, c.want)
+		}
+	}
+}
+
+// sealTestSetup points HOME at a temporary directory and returns a store
+// configured with an API key
+func sealTestSetup(t *testing.T, settings Settings) *config.MemoryStore {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv(PassphraseEnv, "")
+	os.Unsetenv(PassphraseEnv)
+
+	saved := kdfIterations
+	kdfIterations = 1000
+	t.Cleanup(func() { kdfIterations = saved })
+	savedFunc := PassphraseFunc
+	PassphraseFunc = nil
+	t.Cleanup(func() { PassphraseFunc = savedFunc })
+
+	if settings.Secrets == SecretsPassphrase {
+		if err := settings.SetPassphrase("correct horse"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SaveSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	store := config.NewMemoryStore()
+	if err := config.ApplyFoundryConfig(store, &config.FoundryConfig{Resource: "res", APIKey: "sk-backed-up"}); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func readBackup(t *testing.T, path string) (string, Backup) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b Backup
+	if err := json.Unmarshal(data, &b); err != nil {
+		t.Fatal(err)
+	}
+	return string(data), b
+}
+
+func TestPassphraseBackup(t *testing.T) {
+	store := sealTestSetup(t, Settings{Secrets: SecretsPassphrase})
+	t.Setenv(PassphraseEnv, "correct horse")
+
+	path, err := createBackup(store, "encrypted", KindAuto)
+	if err != nil {
+		t.Fatalf("createBackup failed: %v", err)
+	}
+	data, b := readBackup(t, path)
+	if strings.Contains(data, "sk-backed-up") {
+		t.Error("Expected the API key to be encrypted")
+	}
+	if b.Variables[config.EnvFoundryResource] != "res" || b.Sealed == nil || b.Sealed.Mode != SecretsPassphrase {
+		t.Errorf("Expected plain non-secret variables and sealed secrets, got %v %+v", b.Variables, b.Sealed)
+	}
+	if runtime.GOOS != "windows" {
+		if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+			t.Errorf("Expected the backup to have mode 0600, got %v", info.Mode().Perm())
+		}
+		if info, _ := os.Stat(GetBackupDir()); info.Mode().Perm() != 0700 {
+			t.Errorf("Expected the backup directory to have mode 0700, got %v", info.Mode().Perm())
+		}
+	}
+
+	// The key is unchanged, so no passphrase is needed
+	os.Unsetenv(PassphraseEnv)
+	PassphraseFunc = func(string) (string, error) {
+		t.Error("Expected no passphrase prompt for an unchanged secret")
+		return "", nil
+	}
+	if _, err := RestoreBackup(store, filepath.Base(path)); err != nil {
+		t.Fatalf("RestoreBackup failed: %v", err)
+	}
+
+	// A changed key is decrypted with the passphrase
+	if err := store.Set(config.EnvFoundryAPIKey, "sk-other"); err != nil {
+		t.Fatal(err)
+	}
+	PassphraseFunc = func(string) (string, error) { return "wrong", nil }
+	if _, err := RestoreBackup(store, filepath.Base(path)); err == nil || !strings.Contains(err.Error(), "wrong backup passphrase") {
+		t.Errorf("Expected a wrong passphrase error, got %v", err)
+	}
+	if value, _ := store.Get(config.EnvFoundryAPIKey); value != "sk-other" {
+		t.Errorf("Expected a failed restore to change nothing, got %q", value)
+	}
+	PassphraseFunc = func(string) (string, error) { return "correct horse", nil }
+	if _, err := RestoreBackup(store, filepath.Base(path)); err != nil {
+		t.Fatalf("RestoreBackup failed: %v", err)
+	}
+	if value, _ := store.Get(config.EnvFoundryAPIKey); value != "sk-backed-up" {
+		t.Errorf("Expected the decrypted key, got %q", value)
+	}
+
+	// New backups refuse a passphrase that does not match the settings
+	if err := store.Set(config.EnvFoundryResource, "res2"); err != nil {
+		t.Fatal(err)
+	}
+	PassphraseFunc = func(string) (string, error) { return "typo", nil }
+	if _, err := createBackup(store, "typo", KindAuto); err == nil {
+		t.Error("Expected a mistyped passphrase to be refused")
+	}
+}
+
+func TestRedactedBackup(t *testing.T) {
+	store := sealTestSetup(t, Settings{Secrets: SecretsRedact})
+
+	path, err := createBackup(store, "redacted", KindAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, b := readBackup(t, path)
+	if strings.Contains(data, "sk-backed-up") || !strings.HasPrefix(b.Sealed.Fingerprints.Variables[config.EnvFoundryAPIKey], "sha256:") {
+		t.Errorf("Expected only a fingerprint of the key, got:\n%s", data)
+	}
+
+	list, err := ListBackups()
+	if err != nil || len(list) != 1 || list[0].Secrets != SecretsRedact {
+		t.Errorf("Expected the backup to be listed as redacted, got %+v, %v", list, err)
+	}
+
+	if err := store.Set(config.EnvFoundryAPIKey, "sk-rotated"); err != nil {
+		t.Fatal(err)
+	}
+	warnings, err := RestoreBackup(store, filepath.Base(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], config.EnvFoundryAPIKey) {
+		t.Errorf("Expected a warning about the redacted key, got %v", warnings)
+	}
+	if value, _ := store.Get(config.EnvFoundryAPIKey); value != "sk-rotated" {
+		t.Errorf("Expected the current key to be kept, got %q", value)
+	}
+}
+
+func TestPassphraseBackupWithoutPassphraseIsRedacted(t *testing.T) {
+	store := sealTestSetup(t, Settings{Secrets: SecretsPassphrase})
+
+	path, err := createBackup(store, "script", KindAuto)
+	var warning *Warning
+	if !errors.As(err, &warning) || !strings.Contains(err.Error(), "redacted") {
+		t.Fatalf("Expected a warning that the secrets are redacted, got %v", err)
+	}
+	data, b := readBackup(t, path)
+	if strings.Contains(data, "sk-backed-up") || b.Sealed.Mode != SecretsRedact {
+		t.Errorf("Expected a redacted backup when no passphrase is available, got:\n%s", data)
+	}
+
+	if err := store.Set(config.EnvFoundryAPIKey, "sk-changed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateAutoBackup(store, "script again"); !errors.As(err, &warning) {
+		t.Errorf("Expected CreateAutoBackup to pass the warning on, got %v", err)
+	}
+}
+
+func TestAgeBackup(t *testing.T) {
+	if _, err := exec.LookPath("age-keygen"); err != nil {
+		t.Skip("age is not installed")
+	}
+	identity := filepath.Join(t.TempDir(), "key.txt")
+	out, err := exec.Command("age-keygen", "-o", identity).CombinedOutput()
+	if err != nil {
+		t.Fatalf("age-keygen failed: %v: %s", err, out)
+	}
+	recipient := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(out)), "Public key:"))
+
+	store := sealTestSetup(t, Settings{Secrets: SecretsAge, AgeRecipient: recipient, AgeIdentity: identity})
+	path, err := createBackup(store, "age", KindAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := readBackup(t, path); strings.Contains(data, "sk-backed-up") {
+		t.Error("Expected the API key to be encrypted")
+	}
+
+	if err := store.Set(config.EnvFoundryAPIKey, "sk-other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RestoreBackup(store, filepath.Base(path)); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := store.Get(config.EnvFoundryAPIKey); value != "sk-backed-up" {
+		t.Errorf("Expected the decrypted key, got %q", value)
+	}
+}
+
+func TestSealingProtectsExistingBackups(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+	sealTestSetup(t, Settings{Secrets: SecretsPlain})
+	if err := os.MkdirAll(GetBackupDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := filepath.Join(GetBackupDir(), "backup_20240115_143022.json")
+	if err := os.WriteFile(old, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(old, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SaveSettings(Settings{Secrets: SecretsRedact}); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]os.FileMode{old: 0600, GetBackupDir(): 0700} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("Expected %s to be made private (%v), got %v", path, want, info.Mode().Perm())
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package backup
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+// variableName matches the names accepted by ParseOnly besides the groups
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseOnly returns a match for RestoreSelected from a list of variable
+// groups (see config.KeyGroups) and variable names
+func ParseOnly(items []string) (func(key string) bool, error) {
+	groups := map[string]bool{}
+	keys := map[string]bool{}
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		switch {
+		case containsString(config.KeyGroups, item):
+			groups[item] = true
+		case item == strings.ToLower(item):
+			// Variables are upper case; this is a mistyped group
+			return nil, fmt.Errorf("unknown group %q (use %s, or variable names)", item, strings.Join(config.KeyGroups, ", "))
+		case variableName.MatchString(item):
+			keys[item] = true
+		default:
+			return nil, fmt.Errorf("invalid variable name %q", item)
+		}
+	}
+	if len(groups) == 0 && len(keys) == 0 {
+		return nil, fmt.Errorf("nothing selected")
+	}
+
+	return func(key string) bool {
+		return keys[key] || groups[config.KeyGroup(key)]
+	}, nil
+}
+
+// dropUnmanaged removes the variables the tool never writes, such as PATH,
+// from the backup and returns a warning for each
+func (b *Backup) dropUnmanaged() []string {
+	var warnings []string
+	filter := func(path string, vars map[string]string) {
+		for key := range vars {
+			err := config.ValidateManagedKey(key)
+			if err == nil {
+				continue
+			}
+			delete(vars, key)
+			where := key
+			if path != "" {
+				where = fmt.Sprintf("%s in %s", key, path)
+			}
+			warnings = append(warnings, fmt.Sprintf("%s is skipped: %v", where, err))
+		}
+	}
+	filter("", b.Variables)
+	for path, vars := range b.Settings {
+		filter(path, vars)
+	}
+	if b.Sealed != nil {
+		filter("", b.Sealed.Fingerprints.Variables)
+		for path, vars := range b.Sealed.Fingerprints.Settings {
+			filter(path, vars)
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+// keepOnly drops the variables match does not select from the backup
+func (b *Backup) keepOnly(match func(key string) bool) {
+	filter := func(vars map[string]string) {
+		for key := range vars {
+			if !match(key) {
+				delete(vars, key)
+			}
+		}
+	}
+	filter(b.Variables)
+	for _, vars := range b.Settings {
+		filter(vars)
+	}
+	if b.Sealed != nil {
+		filter(b.Sealed.Fingerprints.Variables)
+		for _, vars := range b.Sealed.Fingerprints.Settings {
+			filter(vars)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+func TestParseOnly(t *testing.T) {
+	match, err := ParseOnly([]string{"models", " ANTHROPIC_FOUNDRY_RESOURCE "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, expected := range map[string]bool{
+		"ANTHROPIC_DEFAULT_SONNET_MODEL": true,
+		config.EnvFoundryResource:        true,
+		config.EnvFoundryAPIKey:          false,
+		config.EnvUseFoundry:             false,
+	} {
+		if match(key) != expected {
+			t.Errorf("Expected match(%s) to be %v, got %v", key, expected, !expected)
+		}
+	}
+
+	for _, items := range [][]string{{"modles"}, {"BAD-NAME"}, {}, {" "}} {
+		if _, err := ParseOnly(items); err == nil {
+			t.Errorf("Expected an error for %q", items)
+		}
+	}
+}
+
+func TestRestoreSelected(t *testing.T) {
+	store := sealTestSetup(t, Settings{Secrets: SecretsPlain})
+	store.Set("ANTHROPIC_MODEL", "backed-up-model")
+	path, err := createBackup(store, "selective", KindManual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Base(path)
+
+	store.Set(config.EnvFoundryResource, "current-resource")
+	store.Set(config.EnvFoundryAPIKey, "sk-current")
+	store.Delete("ANTHROPIC_MODEL")
+
+	match, err := ParseOnly([]string{"models"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := PreviewRestore(store, filename, match)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Key != "ANTHROPIC_MODEL" || changes[0].Change != ChangeAdded {
+		t.Errorf("Expected only ANTHROPIC_MODEL to be added, got %v", changes)
+	}
+
+	if _, err := RestoreSelected(store, filename, match); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"ANTHROPIC_MODEL":         "backed-up-model",
+		config.EnvFoundryResource: "current-resource",
+		config.EnvFoundryAPIKey:   "sk-current",
+	}
+	for key, value := range expected {
+		if got, _ := store.Get(key); got != value {
+			t.Errorf("Expected %s to be %q, got %q", key, value, got)
+		}
+	}
+}
+
+func TestRestoreSkipsProtectedVariables(t *testing.T) {
+	store := sealTestSetup(t, Settings{Secrets: SecretsPlain})
+	store.Set("PATH", "/usr/bin")
+	if err := ensureBackupDir(); err != nil {
+		t.Fatal(err)
+	}
+	data := `{"timestamp":"2024-01-15T14:30:22Z","variables":{"ANTHROPIC_FOUNDRY_RESOURCE":"restored","DISABLE_TELEMETRY":"1","PATH":"/tmp/evil","LD_PRELOAD":"/tmp/evil.so"}}`
+	if err := os.WriteFile(filepath.Join(GetBackupDir(), "crafted.json"), []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := PreviewRestore(store, "crafted.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range changes {
+		if c.Key == "PATH" || c.Key == "LD_PRELOAD" {
+			t.Errorf("Expected %s to be left out of the preview", c.Key)
+		}
+	}
+
+	warnings, err := RestoreBackup(store, "crafted.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 2 {
+		t.Errorf("Expected a warning for PATH and LD_PRELOAD, got %v", warnings)
+	}
+	for key, value := range map[string]string{"PATH": "/usr/bin", "LD_PRELOAD": "", config.EnvFoundryResource: "restored", "DISABLE_TELEMETRY": "1"} {
+		if got, _ := store.Get(key); got != value {
+			t.Errorf("Expected %s to be %q, got %q", key, value, got)
+		}
+	}
+	if extra, _ := config.ExtraKeys(); len(extra) != 1 || extra[0] != "DISABLE_TELEMETRY" {
+		t.Errorf("Expected only DISABLE_TELEMETRY to be managed, got %v", extra)
+	}
+}
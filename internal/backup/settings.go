@@ -0,0 +1,134 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+// settingsName is the file in ConfigDir that holds the backup settings
+const settingsName = "backup.json"
+
+// Settings controls how backups are written and how long they are kept
+type Settings struct {
+	Secrets      string `json:"secrets,omitempty"`       // one of the Secrets* modes, plain by default
+	AgeRecipient string `json:"age_recipient,omitempty"` // recipient secrets are encrypted to
+	AgeIdentity  string `json:"age_identity,omitempty"`  // identity file used to decrypt them
+	// PassphraseCheck lets a mistyped passphrase be refused before it
+	// encrypts a backup nobody can open
+	PassphraseCheck *KDF `json:"passphrase_check,omitempty"`
+	// Retention prunes automatic backups; nil means DefaultRetention
+	Retention *Retention `json:"retention,omitempty"`
+	// FileSnapshots keeps a byte-exact copy of the profile and settings
+	// files in each backup, for backup restore --files
+	FileSnapshots bool `json:"file_snapshots,omitempty"`
+	// SnapshotMaxBytes leaves larger files out; 0 means DefaultSnapshotMaxBytes
+	SnapshotMaxBytes int64 `json:"snapshot_max_bytes,omitempty"`
+}
+
+// LoadSettings reads the backup settings
+func LoadSettings() (Settings, error) {
+	path, err := settingsPath()
+	if err != nil {
+		return Settings{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Settings{Secrets: SecretsPlain}, nil
+		}
+		return Settings{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var s Settings
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Settings{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if s.Secrets == "" {
+		s.Secrets = SecretsPlain
+	}
+	return s, nil
+}
+
+// SaveSettings validates and stores the backup settings
+func SaveSettings(s Settings) error {
+	if s.Retention != nil {
+		if err := s.Retention.validate(); err != nil {
+			return err
+		}
+	}
+	if s.SnapshotMaxBytes < 0 {
+		return fmt.Errorf("the snapshot size limit cannot be negative")
+	}
+	switch s.Secrets {
+	case SecretsPlain, SecretsRedact:
+	case SecretsPassphrase:
+		if s.PassphraseCheck == nil {
+			return fmt.Errorf("set the passphrase with SetPassphrase first")
+		}
+	case SecretsAge:
+		if s.AgeRecipient == "" {
+			return fmt.Errorf("the age mode needs a recipient")
+		}
+	default:
+		return fmt.Errorf("unknown secret mode %q (use plain, redact, passphrase or age)", s.Secrets)
+	}
+
+	path, err := settingsPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup settings: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if s.Secrets != SecretsPlain {
+		// Backups made before still hold their secrets in plain text
+		if err := protectBackups(); err != nil {
+			return fmt.Errorf("failed to protect existing backups: %w", err)
+		}
+	}
+	return nil
+}
+
+// protectBackups makes the backup directory and the existing backups
+// readable only by the user, as older versions created them world-readable
+func protectBackups() error {
+	entries, err := os.ReadDir(GetBackupDir())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := ensureBackupDir(); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if err := os.Chmod(filepath.Join(GetBackupDir(), entry.Name()), 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settingsPath returns the location of the backup settings
+func settingsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(config.ConfigDir(home), settingsName), nil
+}
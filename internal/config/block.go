@@ -0,0 +1,160 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrMalformedBlock is returned (wrapped) when the block markers in a file
+// are missing, duplicated or nested, so the block cannot be edited safely
+var ErrMalformedBlock = errors.New("malformed managed block")
+
+// utf8BOM is kept in front of the file when the original had one
+const utf8BOM = "\ufeff"
+
+// profileText is a file split into lines around its managed block. Lines
+// keep their own endings so everything outside the block is written back
+// byte for byte.
+type profileText struct {
+	bom   string
+	lines []string // with line endings; the last one may have none
+	eol   string   // ending used for lines the tool writes
+	// begin and end index the marker lines, both -1 without a block
+	begin, end int
+}
+
+// parseText splits file into lines and locates the managed block. It
+// refuses files where the block structure is ambiguous, since rewriting
+// them could drop user content.
+func (s *ProfileStore) parseText(file fileSnapshot) (*profileText, error) {
+	content := file.content
+	t := &profileText{eol: "\n", begin: -1, end: -1}
+	if strings.HasPrefix(content, utf8BOM) {
+		t.bom = utf8BOM
+		content = content[len(utf8BOM):]
+	}
+	if content != "" {
+		t.lines = strings.SplitAfter(content, "\n")
+		if t.lines[len(t.lines)-1] == "" {
+			t.lines = t.lines[:len(t.lines)-1]
+		}
+		if strings.HasSuffix(t.lines[0], "\r\n") {
+			t.eol = "\r\n"
+		}
+	}
+
+	begin, end := s.dialect.Markers()
+	open := -1
+	for i, line := range t.lines {
+		switch {
+		case isMarker(line, begin) && open >= 0:
+			return nil, blockError(file.path, i, fmt.Sprintf("begin marker inside the block opened at line %d", open+1),
+				fmt.Sprintf("delete one of the begin markers, or close the first block with %q", end))
+		case isMarker(line, begin) && t.begin >= 0:
+			return nil, blockError(file.path, i, fmt.Sprintf("second managed block (the first one starts at line %d)", t.begin+1),
+				"delete one of the blocks, the tool manages a single block per file")
+		case isMarker(line, begin):
+			open = i
+		case isMarker(line, end) && open < 0:
+			return nil, blockError(file.path, i, "end marker without a begin marker",
+				"delete the stray end marker")
+		case isMarker(line, end):
+			t.begin, t.end = open, i
+			open = -1
+		}
+	}
+	if open >= 0 {
+		return nil, blockError(file.path, open, "begin marker without an end marker",
+			fmt.Sprintf("add %q after the last line of the block, or delete the begin marker", end))
+	}
+
+	return t, nil
+}
+
+// blockError describes a malformed block at the zero-based line index
+func blockError(path string, index int, problem, hint string) error {
+	return fmt.Errorf("%w in %s at line %d: %s; to fix it, %s", ErrMalformedBlock, path, index+1, problem, hint)
+}
+
+// found reports whether the file contains a managed block
+func (t *profileText) found() bool {
+	return t.begin >= 0
+}
+
+// body returns the text between the markers, with "\n" line endings
+func (t *profileText) body() string {
+	if !t.found() {
+		return ""
+	}
+	lines := make([]string, 0, t.end-t.begin-1)
+	for _, line := range t.lines[t.begin+1 : t.end] {
+		lines = append(lines, trimEOL(line))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// withBlock returns the file with the managed block replaced by block (the
+// lines between and including the markers). An existing block keeps its
+// position; a new one is appended after a blank line.
+func (t *profileText) withBlock(block []string) string {
+	var b strings.Builder
+	b.WriteString(t.bom)
+
+	// Statements may span several lines. Only the lines between statements
+	// get the file's ending: a line break inside a statement is part of a
+	// quoted value, which a CR would change.
+	writeBlock := func(lastEOL string) {
+		for i, statement := range block {
+			b.WriteString(statement)
+			if i < len(block)-1 {
+				b.WriteString(t.eol)
+			} else {
+				b.WriteString(lastEOL)
+			}
+		}
+	}
+
+	if t.found() {
+		b.WriteString(strings.Join(t.lines[:t.begin], ""))
+		writeBlock(t.lines[t.end][len(trimEOL(t.lines[t.end])):])
+		b.WriteString(strings.Join(t.lines[t.end+1:], ""))
+		return b.String()
+	}
+
+	b.WriteString(strings.Join(t.lines, ""))
+	if len(t.lines) > 0 {
+		if last := t.lines[len(t.lines)-1]; trimEOL(last) == last {
+			b.WriteString(t.eol)
+		}
+		b.WriteString(t.eol)
+	}
+	writeBlock(t.eol)
+	return b.String()
+}
+
+// withoutBlock returns the file with the managed block removed. When the
+// block ends the file, the blank line withBlock put before it goes too.
+func (t *profileText) withoutBlock() string {
+	if !t.found() {
+		return t.bom + strings.Join(t.lines, "")
+	}
+
+	before := t.lines[:t.begin]
+	after := t.lines[t.end+1:]
+	if len(after) == 0 && len(before) > 0 && strings.TrimSpace(before[len(before)-1]) == "" {
+		before = before[:len(before)-1]
+	}
+	return t.bom + strings.Join(before, "") + strings.Join(after, "")
+}
+
+// trimEOL removes a trailing "\n" or "\r\n"
+func trimEOL(line string) string {
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r")
+}
+
+// isMarker reports whether line is exactly the given marker
+func isMarker(line, marker string) bool {
+	return strings.TrimSpace(line) == marker
+}
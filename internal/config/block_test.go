@@ -0,0 +1,169 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestMalformedBlocksAreRefused(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		line    string
+	}{
+		{"missing end", "a\n" + markerBegin + "\nexport A='1'\nalias x=y\n", "line 2"},
+		{"stray end", "a\n" + markerEnd + "\n", "line 2"},
+		{"nested", markerBegin + "\n" + markerBegin + "\n" + markerEnd + "\n", "line 2"},
+		{"duplicate", markerBegin + "\n" + markerEnd + "\nb\n" + markerBegin + "\n" + markerEnd + "\n", "line 4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".zshrc")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			store := NewProfileStore(path, posixDialect{})
+
+			err := store.Set(EnvUseFoundry, "true")
+			if !errors.Is(err, ErrMalformedBlock) {
+				t.Fatalf("Expected ErrMalformedBlock, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.line) || !strings.Contains(err.Error(), "to fix it") {
+				t.Errorf("Expected the error to point at %s with a hint, got %v", tt.line, err)
+			}
+			if _, err := store.List(); !errors.Is(err, ErrMalformedBlock) {
+				t.Errorf("Expected List to fail too, got %v", err)
+			}
+
+			data, _ := os.ReadFile(path)
+			if string(data) != tt.content {
+				t.Errorf("File was modified:\n%s", data)
+			}
+		})
+	}
+}
+
+func TestBlockKeepsPositionAndLineEndings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".bashrc")
+	before := utf8BOM + "# top\r\n" + markerBegin + "\r\nexport A='1'\r\n" + markerEnd + "\r\nalias x=y"
+	if err := os.WriteFile(path, []byte(before), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store := NewProfileStore(path, posixDialect{})
+
+	if err := store.Set("A", "line1\nline2"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	content := string(data)
+	if !strings.HasPrefix(content, utf8BOM+"# top\r\n"+markerBegin+"\r\n") {
+		t.Errorf("BOM, CRLF or block position lost:\n%q", content)
+	}
+	if !strings.HasSuffix(content, markerEnd+"\r\nalias x=y") {
+		t.Errorf("Content after the block changed:\n%q", content)
+	}
+	// The line break of the value stays LF, the lines around it get CRLF
+	if !strings.Contains(content, "\r\nexport A='line1'\"\n\"'line2'\r\n") {
+		t.Errorf("Expected CRLF between statements and LF inside the value:\n%q", content)
+	}
+
+	if value, err := store.Get("A"); err != nil || value != "line1\nline2" {
+		t.Errorf("Expected the value back, got %q (%v)", value, err)
+	}
+
+	if err := store.Delete("A"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(path)
+	if string(data) != utf8BOM+"# top\r\nalias x=y" {
+		t.Errorf("Unexpected content after removing the block:\n%q", data)
+	}
+}
+
+func TestCRLFBlockKeepsMultilineValues(t *testing.T) {
+	for _, name := range SupportedShells() {
+		t.Run(name, func(t *testing.T) {
+			dialect := shells[name].dialect
+			path := filepath.Join(t.TempDir(), "profile")
+			if err := os.WriteFile(path, []byte("# windows\r\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			store := NewProfileStore(path, dialect)
+			for _, value := range trickyValues {
+				if !utf8.ValidString(value) {
+					continue // not every dialect can write these
+				}
+				if err := store.Set("A", value); err != nil {
+					t.Fatalf("Set(%q) failed: %v", value, err)
+				}
+				if got, err := store.Get("A"); err != nil || got != value {
+					t.Errorf("Expected %q back, got %q (%v)", value, got, err)
+				}
+				if data, _ := os.ReadFile(path); !strings.Contains(string(data), dialect.FormatVar("A", value)+"\r\n") {
+					t.Errorf("Expected the statement for %q to be written as is:\n%q", value, data)
+				}
+			}
+		})
+	}
+}
+
+func TestBlockHeaderIsProviderNeutral(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".bashrc")
+	legacy := strings.Join([]string{
+		markerBegin,
+		"# Claude Code Azure Foundry Configuration",
+		"# Managed by claude-foundry-manager - DO NOT EDIT MANUALLY",
+		"export CLAUDE_CODE_USE_BEDROCK='1'",
+		markerEnd,
+	}, "\n") + "\n"
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store := NewProfileStore(path, posixDialect{})
+
+	if value, err := store.Get("CLAUDE_CODE_USE_BEDROCK"); err != nil || value != "1" {
+		t.Errorf("Expected the block with the old header to parse, got %q (%v)", value, err)
+	}
+	if err := store.Set("AWS_REGION", "us-east-1"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "Azure Foundry") || !strings.Contains(string(data), blockHeader[0]) {
+		t.Errorf("Expected the provider-neutral header:\n%s", data)
+	}
+}
+
+func TestApplyThenRollbackRestoresFile(t *testing.T) {
+	for _, original := range []string{
+		"",
+		"alias x=y\n",
+		"alias x=y\n\n\n",
+		"# windows\r\nalias x=y\r\n",
+	} {
+		path := filepath.Join(t.TempDir(), ".zshrc")
+		if original != "" {
+			if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		store := NewProfileStore(path, posixDialect{})
+
+		if err := ApplyFoundryConfig(store, &FoundryConfig{Resource: "res"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := RollbackToDefault(store); err != nil {
+			t.Fatal(err)
+		}
+
+		data, _ := os.ReadFile(path)
+		if string(data) != original {
+			t.Errorf("Expected %q after rollback, got %q", original, data)
+		}
+	}
+}
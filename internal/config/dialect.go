@@ -0,0 +1,285 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Dialect knows how one shell spells "set this environment variable", both
+// for writing the managed block and for reading it back. Values must
+// round-trip exactly: ParseVars(FormatVar(k, v)) yields v for any value
+// without NUL bytes, and nothing in a formatted value is ever expanded or
+// executed by the shell.
+type Dialect interface {
+	// Name returns the shell name (e.g. "posix")
+	Name() string
+	// Markers returns the comment lines that open and close the managed block
+	Markers() (begin, end string)
+	// FormatVar returns the statement that exports key=value
+	FormatVar(key, value string) string
+	// ParseVars extracts the variables from statements written by FormatVar
+	ParseVars(body string) (map[string]string, error)
+	// SourceLine returns the statement that loads the file at path, if it
+	// exists, into the running shell
+	SourceLine(path string) string
+}
+
+// utf8Dialect is implemented by dialects whose files are read as UTF-8
+// text, so values must be valid UTF-8 to survive the round trip
+type utf8Dialect interface {
+	requiresUTF8()
+}
+
+// dialectMarkers builds the block markers for a dialect other than posix
+// and fish, which keep the original markers for compatibility
+func dialectMarkers(name string) (string, string) {
+	return "# >>> Claude Foundry Manager (" + name + ") - BEGIN >>>",
+		"# <<< Claude Foundry Manager (" + name + ") - END <<<"
+}
+
+// validateVar checks that key is a portable variable name and value can be
+// stored in the environment (and written in dialect) at all
+func validateVar(dialect Dialect, key, value string) error {
+	if !isValidKey(key) {
+		return fmt.Errorf("invalid environment variable name %q", key)
+	}
+	if strings.ContainsRune(value, 0) {
+		return fmt.Errorf("value of %s contains a NUL byte", key)
+	}
+	if _, ok := dialect.(utf8Dialect); ok && !utf8.ValidString(value) {
+		return fmt.Errorf("value of %s is not valid UTF-8, which %s cannot represent", key, dialect.Name())
+	}
+	return nil
+}
+
+// isValidKey reports whether key matches [A-Za-z_][A-Za-z0-9_]*
+func isValidKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, c := range key {
+		switch {
+		case c == '_', c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// posixDialect writes `export KEY='VALUE'` for sh, bash and zsh
+type posixDialect struct{}
+
+func (posixDialect) Name() string { return "posix" }
+
+func (posixDialect) Markers() (string, string) { return markerBegin, markerEnd }
+
+// FormatVar single-quotes the value, so the shell performs no expansion.
+// A single quote and a newline are written as
+//
+//	'\''
+//	'"<newline>"'
+//
+// so continuation lines never start with a comment and cannot be mistaken
+// for a block marker.
+func (posixDialect) FormatVar(key, value string) string {
+	return "export " + key + "=" + posixQuote(value)
+}
+
+// SourceLine sources path with the POSIX `.` builtin when the file exists
+func (posixDialect) SourceLine(path string) string {
+	return "if [ -f " + posixQuote(path) + " ]; then . " + posixQuote(path) + "; fi"
+}
+
+// posixQuote returns value as a single-quoted shell word
+func posixQuote(value string) string {
+	var b strings.Builder
+	b.WriteString(`'`)
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '\'':
+			b.WriteString(`'\''`)
+		case '\n':
+			b.WriteString("'\"\n\"'")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteString("'")
+	return b.String()
+}
+
+// ParseVars understands the subset of POSIX shell used in the managed
+// block: comments, `export KEY=WORD` statements, and words made of
+// single-quoted, double-quoted, backslash-escaped and bare segments.
+// Double quotes are accepted for blocks written by older versions.
+func (posixDialect) ParseVars(body string) (map[string]string, error) {
+	vars := make(map[string]string)
+	p := &shellScanner{src: body}
+
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return vars, nil
+		}
+		if p.peek() == '#' {
+			p.skipLine()
+			continue
+		}
+
+		word, err := p.bareWord()
+		if err != nil {
+			return nil, err
+		}
+		if word != "export" {
+			return nil, p.errorf("expected 'export', found %q", word)
+		}
+		p.skipSpaces()
+
+		key, value, err := p.assignment()
+		if err != nil {
+			return nil, err
+		}
+		vars[key] = value
+	}
+}
+
+// shellScanner is a small cursor over shell source text
+type shellScanner struct {
+	src string
+	pos int
+}
+
+func (p *shellScanner) eof() bool  { return p.pos >= len(p.src) }
+func (p *shellScanner) peek() byte { return p.src[p.pos] }
+
+func (p *shellScanner) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.src[:p.pos], "\n") + 1
+	return fmt.Errorf("managed block line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skipBlank skips spaces, tabs, newlines, carriage returns and semicolons
+func (p *shellScanner) skipBlank() {
+	for !p.eof() && strings.IndexByte(" \t\r\n;", p.peek()) >= 0 {
+		p.pos++
+	}
+}
+
+// skipSpaces skips spaces and tabs only
+func (p *shellScanner) skipSpaces() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// consume advances past s if the input continues with it
+func (p *shellScanner) consume(s string) bool {
+	if strings.HasPrefix(p.src[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (p *shellScanner) skipLine() {
+	for !p.eof() && p.peek() != '\n' {
+		p.pos++
+	}
+}
+
+// atWordEnd reports whether the cursor is at whitespace, ';' or the end
+func (p *shellScanner) atWordEnd() bool {
+	return p.eof() || strings.IndexByte(" \t\r\n;", p.peek()) >= 0
+}
+
+// bareWord reads an unquoted word such as a command name
+func (p *shellScanner) bareWord() (string, error) {
+	start := p.pos
+	for !p.atWordEnd() && p.peek() != '=' {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("expected a word")
+	}
+	return p.src[start:p.pos], nil
+}
+
+// assignment reads KEY=WORD
+func (p *shellScanner) assignment() (string, string, error) {
+	key, err := p.bareWord()
+	if err != nil {
+		return "", "", err
+	}
+	if !isValidKey(key) {
+		return "", "", p.errorf("invalid variable name %q", key)
+	}
+	if p.eof() || p.peek() != '=' {
+		return "", "", p.errorf("expected '=' after %s", key)
+	}
+	p.pos++
+
+	value, err := p.word()
+	if err != nil {
+		return "", "", err
+	}
+	return key, value, nil
+}
+
+// word reads one shell word, concatenating quoted and unquoted segments
+func (p *shellScanner) word() (string, error) {
+	var b strings.Builder
+	for !p.atWordEnd() {
+		switch c := p.peek(); c {
+		case '\'':
+			end := strings.IndexByte(p.src[p.pos+1:], '\'')
+			if end < 0 {
+				return "", p.errorf("unterminated single quote")
+			}
+			b.WriteString(p.src[p.pos+1 : p.pos+1+end])
+			p.pos += end + 2
+		case '"':
+			if err := p.doubleQuoted(&b); err != nil {
+				return "", err
+			}
+		case '\\':
+			p.pos++
+			if p.eof() {
+				return "", p.errorf("trailing backslash")
+			}
+			if p.peek() != '\n' { // backslash-newline is a line continuation
+				b.WriteByte(p.peek())
+			}
+			p.pos++
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return b.String(), nil
+}
+
+// doubleQuoted reads a "..." segment; only \$ \` \" \\ and \<newline> are escapes
+func (p *shellScanner) doubleQuoted(b *strings.Builder) error {
+	p.pos++ // opening quote
+	for {
+		if p.eof() {
+			return p.errorf("unterminated double quote")
+		}
+		c := p.peek()
+		switch {
+		case c == '"':
+			p.pos++
+			return nil
+		case c == '\\' && p.pos+1 < len(p.src) && strings.IndexByte("$`\"\\\n", p.src[p.pos+1]) >= 0:
+			if p.src[p.pos+1] != '\n' {
+				b.WriteByte(p.src[p.pos+1])
+			}
+			p.pos += 2
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
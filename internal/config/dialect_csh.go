@@ -0,0 +1,129 @@
+package config
+
+import "strings"
+
+// cshDialect writes `setenv KEY 'VALUE'` for csh and tcsh
+type cshDialect struct {
+	name string // "csh" or "tcsh", used in the block markers
+}
+
+func (d cshDialect) Name() string { return d.name }
+
+func (d cshDialect) Markers() (string, string) { return dialectMarkers(d.name) }
+
+// FormatVar single-quotes the value. csh has no escape inside single quotes,
+// so a quote and ! (history substitution) are written as
+//
+//	'\''
+//	'\!'
+//
+// A newline must be backslash-escaped inside the quotes; the quote is then
+// closed and reopened so the continuation line starts with an empty quoted
+// string and can never look like a comment or a block marker.
+func (d cshDialect) FormatVar(key, value string) string {
+	return "setenv " + key + " " + cshQuote(value)
+}
+
+// SourceLine sources path when the file exists
+func (d cshDialect) SourceLine(path string) string {
+	return "if ( -f " + cshQuote(path) + " ) source " + cshQuote(path)
+}
+
+// cshQuote returns value as a csh single-quoted word
+func cshQuote(value string) string {
+	var b strings.Builder
+	b.WriteString(`'`)
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '\'':
+			b.WriteString(`'\''`)
+		case '!':
+			b.WriteString(`'\!'`)
+		case '\n':
+			b.WriteString("\\\n''")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteString("'")
+	return b.String()
+}
+
+// ParseVars understands `setenv KEY WORD` statements
+func (d cshDialect) ParseVars(body string) (map[string]string, error) {
+	vars := make(map[string]string)
+	p := &shellScanner{src: body}
+
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return vars, nil
+		}
+		if p.peek() == '#' {
+			p.skipLine()
+			continue
+		}
+
+		word, err := p.bareWord()
+		if err != nil {
+			return nil, err
+		}
+		if word != "setenv" {
+			return nil, p.errorf("expected 'setenv', found %q", word)
+		}
+		p.skipSpaces()
+
+		key, err := p.bareWord()
+		if err != nil {
+			return nil, err
+		}
+		if !isValidKey(key) {
+			return nil, p.errorf("invalid variable name %q", key)
+		}
+		p.skipSpaces()
+
+		value, err := p.cshWord()
+		if err != nil {
+			return nil, err
+		}
+		vars[key] = value
+	}
+}
+
+// cshWord reads one csh word. Inside single quotes only backslash-newline
+// is special; outside, a backslash quotes the next character.
+func (p *shellScanner) cshWord() (string, error) {
+	var b strings.Builder
+	for !p.atWordEnd() {
+		switch c := p.peek(); c {
+		case '\'', '"':
+			p.pos++
+			for {
+				if p.eof() {
+					return "", p.errorf("unterminated %c quote", c)
+				}
+				if p.peek() == c {
+					p.pos++
+					break
+				}
+				if p.consume("\\\n") {
+					b.WriteByte('\n')
+					continue
+				}
+				b.WriteByte(p.peek())
+				p.pos++
+			}
+		case '\\':
+			p.pos++
+			if p.eof() {
+				return "", p.errorf("trailing backslash")
+			}
+			b.WriteByte(p.peek())
+			p.pos++
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return b.String(), nil
+}
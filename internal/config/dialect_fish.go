@@ -0,0 +1,207 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+)
+
+// fishDialect writes `set -gx KEY 'VALUE'` for the fish shell
+type fishDialect struct{}
+
+func (fishDialect) Name() string { return "fish" }
+
+func (fishDialect) Markers() (string, string) { return markerBegin, markerEnd }
+
+// FormatVar single-quotes the value, where fish only interprets \' and \\.
+// Newlines are written as an unquoted \n escape so the statement stays on
+// one line.
+func (fishDialect) FormatVar(key, value string) string {
+	return "set -gx " + key + " " + fishQuote(value)
+}
+
+// SourceLine sources path when the file exists
+func (fishDialect) SourceLine(path string) string {
+	return "if test -f " + fishQuote(path) + "; source " + fishQuote(path) + "; end"
+}
+
+// fishQuote returns value as a fish single-quoted word
+func fishQuote(value string) string {
+	var b strings.Builder
+	b.WriteString(`'`)
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '\\', '\'':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`'\n'`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteString("'")
+	return b.String()
+}
+
+// ParseVars understands `set [flags] KEY WORD...` statements. The bash-style
+// `export KEY="VALUE"` lines written by older versions into config.fish are
+// accepted too, so existing blocks can be migrated.
+func (fishDialect) ParseVars(body string) (map[string]string, error) {
+	vars := make(map[string]string)
+	p := &shellScanner{src: body}
+
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return vars, nil
+		}
+		if p.peek() == '#' {
+			p.skipLine()
+			continue
+		}
+
+		word, err := p.bareWord()
+		if err != nil {
+			return nil, err
+		}
+
+		switch word {
+		case "export":
+			p.skipSpaces()
+			key, value, err := p.assignment()
+			if err != nil {
+				return nil, err
+			}
+			vars[key] = value
+		case "set":
+			key, value, err := p.fishSet()
+			if err != nil {
+				return nil, err
+			}
+			vars[key] = value
+		default:
+			return nil, p.errorf("expected 'set', found %q", word)
+		}
+	}
+}
+
+// fishSet reads the rest of a `set` statement: flags, the name and the
+// value words, which fish joins with spaces when exporting
+func (p *shellScanner) fishSet() (string, string, error) {
+	p.skipSpaces()
+	for !p.eof() && p.peek() == '-' {
+		if _, err := p.bareWord(); err != nil {
+			return "", "", err
+		}
+		p.skipSpaces()
+	}
+
+	key, err := p.bareWord()
+	if err != nil {
+		return "", "", err
+	}
+	if !isValidKey(key) {
+		return "", "", p.errorf("invalid variable name %q", key)
+	}
+
+	words := []string{}
+	for {
+		p.skipSpaces()
+		if p.atWordEnd() {
+			break
+		}
+		word, err := p.fishWord()
+		if err != nil {
+			return "", "", err
+		}
+		words = append(words, word)
+	}
+
+	return key, strings.Join(words, " "), nil
+}
+
+// fishWord reads one fish word made of quoted and unquoted segments
+func (p *shellScanner) fishWord() (string, error) {
+	var b strings.Builder
+	for !p.atWordEnd() {
+		switch c := p.peek(); c {
+		case '\'':
+			if err := p.fishQuoted(&b, '\'', `\'`); err != nil {
+				return "", err
+			}
+		case '"':
+			if err := p.fishQuoted(&b, '"', "\\\"$\n"); err != nil {
+				return "", err
+			}
+		case '\\':
+			if err := p.fishEscape(&b); err != nil {
+				return "", err
+			}
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return b.String(), nil
+}
+
+// fishQuoted reads a quoted segment in which a backslash only escapes the
+// characters in escapable
+func (p *shellScanner) fishQuoted(b *strings.Builder, quote byte, escapable string) error {
+	p.pos++ // opening quote
+	for {
+		if p.eof() {
+			return p.errorf("unterminated %c quote", quote)
+		}
+		c := p.peek()
+		switch {
+		case c == quote:
+			p.pos++
+			return nil
+		case c == '\\' && p.pos+1 < len(p.src) && strings.IndexByte(escapable, p.src[p.pos+1]) >= 0:
+			if p.src[p.pos+1] != '\n' {
+				b.WriteByte(p.src[p.pos+1])
+			}
+			p.pos += 2
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// fishEscape reads an unquoted backslash escape such as \n or \x1b
+func (p *shellScanner) fishEscape(b *strings.Builder) error {
+	p.pos++ // backslash
+	if p.eof() {
+		return p.errorf("trailing backslash")
+	}
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'n':
+		b.WriteByte('\n')
+	case 't':
+		b.WriteByte('\t')
+	case 'r':
+		b.WriteByte('\r')
+	case 'e':
+		b.WriteByte(0x1b)
+	case 'x', 'X':
+		end := p.pos
+		for end < len(p.src) && end-p.pos < 2 && strings.IndexByte("0123456789abcdefABCDEF", p.src[end]) >= 0 {
+			end++
+		}
+		n, err := strconv.ParseUint(p.src[p.pos:end], 16, 8)
+		if err != nil {
+			return p.errorf("invalid \\x escape")
+		}
+		b.WriteByte(byte(n))
+		p.pos = end
+	case '\n':
+		// line continuation
+	default:
+		b.WriteByte(c)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFishRoundTrip(t *testing.T) {
+	d := fishDialect{}
+	for _, value := range trickyValues {
+		formatted := d.FormatVar("KEY", value)
+		if strings.Contains(formatted, "\n") {
+			t.Errorf("FormatVar(%q) spans several lines: %q", value, formatted)
+		}
+		vars, err := d.ParseVars(formatted)
+		if err != nil {
+			t.Errorf("ParseVars(FormatVar(%q)) failed: %v", value, err)
+			continue
+		}
+		if vars["KEY"] != value {
+			t.Errorf("Round trip of %q produced %q", value, vars["KEY"])
+		}
+	}
+}
+
+func TestFishFormat(t *testing.T) {
+	got := fishDialect{}.FormatVar("KEY", `it's a \ test`)
+	want := `set -gx KEY 'it\'s a \\ test'`
+	if got != want {
+		t.Errorf("FormatVar = %s, expected %s", got, want)
+	}
+}
+
+func TestFishParsesLegacyExportLines(t *testing.T) {
+	vars, err := fishDialect{}.ParseVars("# comment\nexport CLAUDE_CODE_USE_FOUNDRY=\"true\"\nset -x -g B two words\n")
+	if err != nil {
+		t.Fatalf("ParseVars failed: %v", err)
+	}
+	if vars[EnvUseFoundry] != "true" || vars["B"] != "two words" {
+		t.Errorf("Unexpected vars %v", vars)
+	}
+}
+
+func TestFishStoreMigratesConfigFish(t *testing.T) {
+	home := t.TempDir()
+	configFish := filepath.Join(home, ".config", "fish", "config.fish")
+	if err := os.MkdirAll(filepath.Dir(configFish), 0755); err != nil {
+		t.Fatal(err)
+	}
+	legacy := strings.Join([]string{
+		"set -gx EDITOR vim",
+		"",
+		markerBegin,
+		`export CLAUDE_CODE_USE_FOUNDRY="true"`,
+		`export ANTHROPIC_FOUNDRY_RESOURCE="old-resource"`,
+		markerEnd,
+		"",
+	}, "\n")
+	if err := os.WriteFile(configFish, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := newShellStore(home, "/usr/bin/fish")
+	if !strings.HasSuffix(store.Path(), filepath.Join("conf.d", "claude-foundry.fish")) {
+		t.Fatalf("Unexpected fish store path %s", store.Path())
+	}
+
+	// Variables in the legacy block are visible before migration
+	if value, _ := store.Get(EnvFoundryResource); value != "old-resource" {
+		t.Errorf("Legacy value not read, got %q", value)
+	}
+
+	if err := SetAllVars(store, map[string]string{EnvFoundryResource: "new-resource"}); err != nil {
+		t.Fatalf("SetAllVars failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(configFish)
+	if strings.Contains(string(data), markerBegin) || !strings.Contains(string(data), "set -gx EDITOR vim") {
+		t.Errorf("config.fish not cleaned up correctly: %q", data)
+	}
+
+	vars, _ := store.List()
+	if vars[EnvUseFoundry] != "true" || vars[EnvFoundryResource] != "new-resource" {
+		t.Errorf("Unexpected vars after migration: %v", vars)
+	}
+
+	if err := RollbackToDefault(store); err != nil {
+		t.Fatalf("RollbackToDefault failed: %v", err)
+	}
+	if _, err := os.Stat(store.Path()); !os.IsNotExist(err) {
+		t.Error("conf.d file should be removed once empty")
+	}
+}
+
+func FuzzFishRoundTrip(f *testing.F) {
+	for _, value := range trickyValues {
+		f.Add(value)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		d := fishDialect{}
+		vars, err := d.ParseVars(d.FormatVar("KEY", value))
+		if err != nil {
+			t.Fatalf("ParseVars(FormatVar(%q)) failed: %v", value, err)
+		}
+		if vars["KEY"] != value {
+			t.Fatalf("Round trip of %q produced %q", value, vars["KEY"])
+		}
+	})
+}
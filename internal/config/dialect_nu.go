@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// nuDialect writes `$env.KEY = "VALUE"` for nushell's env.nu
+type nuDialect struct{}
+
+func (nuDialect) Name() string { return "nu" }
+
+func (nuDialect) Markers() (string, string) { return dialectMarkers("nu") }
+
+func (nuDialect) requiresUTF8() {}
+
+// FormatVar writes a double-quoted nushell string. Nushell does not
+// interpolate plain double-quoted strings; backslash escapes cover quotes,
+// backslashes and control characters so the statement stays on one line.
+func (nuDialect) FormatVar(key, value string) string {
+	return "$env." + key + " = " + nuQuote(value)
+}
+
+// SourceLine sources path. Nushell resolves `source` while parsing, so it
+// cannot be guarded by a runtime check; the tool keeps the file in place for
+// as long as a profile sources it.
+func (nuDialect) SourceLine(path string) string {
+	return "source " + nuQuote(path)
+}
+
+// nuQuote returns value as a nushell double-quoted string
+func nuQuote(value string) string {
+	var b strings.Builder
+	b.WriteString(`"`)
+	for _, r := range value {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u{%x}`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteString(`"`)
+	return b.String()
+}
+
+// ParseVars understands `$env.KEY = "..."` and `$env.KEY = '...'` statements
+func (nuDialect) ParseVars(body string) (map[string]string, error) {
+	vars := make(map[string]string)
+	p := &shellScanner{src: body}
+
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return vars, nil
+		}
+		if p.peek() == '#' {
+			p.skipLine()
+			continue
+		}
+
+		if !p.consume("$env.") {
+			return nil, p.errorf("expected '$env.KEY = ...'")
+		}
+		key, err := p.bareWord()
+		if err != nil {
+			return nil, err
+		}
+		if !isValidKey(key) {
+			return nil, p.errorf("invalid variable name %q", key)
+		}
+		p.skipSpaces()
+		if !p.consume("=") {
+			return nil, p.errorf("expected '=' after %s", key)
+		}
+		p.skipSpaces()
+
+		value, err := p.nuString()
+		if err != nil {
+			return nil, err
+		}
+		vars[key] = value
+	}
+}
+
+// nuString reads a single-quoted (raw) or double-quoted nushell string
+func (p *shellScanner) nuString() (string, error) {
+	if p.eof() {
+		return "", p.errorf("expected a string")
+	}
+
+	if p.peek() == '\'' {
+		end := strings.IndexByte(p.src[p.pos+1:], '\'')
+		if end < 0 {
+			return "", p.errorf("unterminated single quote")
+		}
+		value := p.src[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return value, nil
+	}
+
+	if !p.consume(`"`) {
+		return "", p.errorf("expected a quoted string")
+	}
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated double quote")
+		}
+		c := p.peek()
+		p.pos++
+		if c == '"' {
+			return b.String(), nil
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+
+		if p.eof() {
+			return "", p.errorf("unterminated escape")
+		}
+		e := p.peek()
+		p.pos++
+		switch e {
+		case '"', '\\', '/', '\'':
+			b.WriteByte(e)
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'u':
+			end := strings.IndexByte(p.src[p.pos:], '}')
+			if !p.consume("{") || end < 0 {
+				return "", p.errorf("invalid \\u escape")
+			}
+			n, err := strconv.ParseUint(p.src[p.pos:p.pos+end-1], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(n)) {
+				return "", p.errorf("invalid \\u escape")
+			}
+			b.WriteRune(rune(n))
+			p.pos += end
+		default:
+			return "", p.errorf("unknown escape \\%c", e)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// pwshDialect writes `$env:KEY = "VALUE"` for the PowerShell $PROFILE
+type pwshDialect struct{}
+
+func (pwshDialect) Name() string { return "pwsh" }
+
+func (pwshDialect) Markers() (string, string) { return dialectMarkers("pwsh") }
+
+func (pwshDialect) requiresUTF8() {}
+
+// FormatVar writes a double-quoted string with every character PowerShell
+// would interpret ($, backtick and the ASCII and typographic double quotes)
+// backtick-escaped, and control characters as escapes so the statement
+// stays on one line
+func (pwshDialect) FormatVar(key, value string) string {
+	return "$env:" + key + " = " + pwshQuote(value)
+}
+
+// SourceLine dot-sources path when the file exists
+func (pwshDialect) SourceLine(path string) string {
+	return "if (Test-Path -LiteralPath " + pwshQuote(path) + ") { . " + pwshQuote(path) + " }"
+}
+
+// pwshQuote returns value as an escaped PowerShell double-quoted string
+func pwshQuote(value string) string {
+	var b strings.Builder
+	b.WriteString(`"`)
+	for _, r := range value {
+		switch r {
+		case '$', '`', '"', '“', '”', '„':
+			b.WriteRune('`')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString("`n")
+		case '\r':
+			b.WriteString("`r")
+		case '\t':
+			b.WriteString("`t")
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, "`u{%x}", r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteString(`"`)
+	return b.String()
+}
+
+// ParseVars understands `$env:KEY = "..."` and `$env:KEY = '...'` statements
+func (pwshDialect) ParseVars(body string) (map[string]string, error) {
+	vars := make(map[string]string)
+	p := &shellScanner{src: body}
+
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return vars, nil
+		}
+		if p.peek() == '#' {
+			p.skipLine()
+			continue
+		}
+
+		if !p.consume("$env:") {
+			return nil, p.errorf("expected '$env:KEY = ...'")
+		}
+		key, err := p.bareWord()
+		if err != nil {
+			return nil, err
+		}
+		if !isValidKey(key) {
+			return nil, p.errorf("invalid variable name %q", key)
+		}
+		p.skipSpaces()
+		if !p.consume("=") {
+			return nil, p.errorf("expected '=' after %s", key)
+		}
+		p.skipSpaces()
+
+		value, err := p.pwshString()
+		if err != nil {
+			return nil, err
+		}
+		vars[key] = value
+	}
+}
+
+// isPwshQuote reports whether r closes a PowerShell string opened with quote
+func isPwshQuote(r rune, quote byte) bool {
+	if quote == '\'' {
+		return r == '\'' || r == '‘' || r == '’' || r == '‚' || r == '‛'
+	}
+	return r == '"' || r == '“' || r == '”' || r == '„'
+}
+
+// pwshString reads a single-quoted (verbatim, quotes doubled) or
+// double-quoted (backtick escapes) PowerShell string
+func (p *shellScanner) pwshString() (string, error) {
+	if p.eof() || (p.peek() != '"' && p.peek() != '\'') {
+		return "", p.errorf("expected a quoted string")
+	}
+	quote := p.peek()
+	p.pos++
+
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += size
+
+		if isPwshQuote(r, quote) {
+			// A doubled quote is a literal quote
+			if next, n := utf8.DecodeRuneInString(p.src[p.pos:]); p.pos < len(p.src) && isPwshQuote(next, quote) {
+				b.WriteRune(r)
+				p.pos += n
+				continue
+			}
+			return b.String(), nil
+		}
+		if quote == '\'' || r != '`' {
+			b.WriteRune(r)
+			continue
+		}
+
+		if p.eof() {
+			return "", p.errorf("unterminated escape")
+		}
+		e, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += size
+		switch e {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '0':
+			b.WriteByte(0)
+		case 'e':
+			b.WriteByte(0x1b)
+		case 'u':
+			end := strings.IndexByte(p.src[p.pos:], '}')
+			if !p.consume("{") || end < 0 {
+				return "", p.errorf("invalid `u escape")
+			}
+			n, err := strconv.ParseUint(p.src[p.pos:p.pos+end-1], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(n)) {
+				return "", p.errorf("invalid `u escape")
+			}
+			b.WriteRune(rune(n))
+			p.pos += end
+		default:
+			b.WriteRune(e)
+		}
+	}
+}
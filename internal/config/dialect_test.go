@@ -0,0 +1,209 @@
+package config
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// trickyValues are values that were corrupted or executed by the old
+// `export KEY="VALUE"` writer
+var trickyValues = []string{
+	"",
+	"plain",
+	"with spaces",
+	`double "quoted"`,
+	"single 'quoted'",
+	"'",
+	"''",
+	`$HOME`,
+	"${HOME}",
+	"`touch /tmp/pwned`",
+	"$(touch /tmp/pwned)",
+	`back\slash`,
+	`trailing\`,
+	"semi; colon && pipe | amp &",
+	"# not a comment",
+	"multi\nline",
+	"\n",
+	"crlf\r\nline",
+	"tab\there",
+	"unicode ✓ ünïcödé",
+	"\xff\xfe invalid utf-8",
+	markerEnd,
+	"x\n" + markerEnd + "\ny",
+	"!bang !!",
+	"*glob?[a]",
+	"~tilde",
+}
+
+func TestIsValidKey(t *testing.T) {
+	valid := []string{"A", "_", "ANTHROPIC_MODEL", "a1", "_9"}
+	invalid := []string{"", "1A", "A-B", "A B", "A=B", "$A", "É"}
+
+	for _, key := range valid {
+		if !isValidKey(key) {
+			t.Errorf("isValidKey(%q) = false, expected true", key)
+		}
+	}
+	for _, key := range invalid {
+		if isValidKey(key) {
+			t.Errorf("isValidKey(%q) = true, expected false", key)
+		}
+	}
+}
+
+func TestPosixRoundTrip(t *testing.T) {
+	d := posixDialect{}
+	for _, value := range trickyValues {
+		vars, err := d.ParseVars(d.FormatVar("KEY", value))
+		if err != nil {
+			t.Errorf("ParseVars(FormatVar(%q)) failed: %v", value, err)
+			continue
+		}
+		if vars["KEY"] != value {
+			t.Errorf("Round trip of %q produced %q", value, vars["KEY"])
+		}
+	}
+}
+
+func TestPosixParsesLegacyBlock(t *testing.T) {
+	body := strings.Join([]string{
+		"# Claude Code Azure Foundry Configuration",
+		"# Managed by claude-foundry-manager - DO NOT EDIT MANUALLY",
+		`export CLAUDE_CODE_USE_FOUNDRY="true"`,
+		`export ANTHROPIC_FOUNDRY_RESOURCE="my-resource"`,
+	}, "\n")
+
+	vars, err := posixDialect{}.ParseVars(body)
+	if err != nil {
+		t.Fatalf("ParseVars failed: %v", err)
+	}
+	if vars[EnvUseFoundry] != "true" || vars[EnvFoundryResource] != "my-resource" {
+		t.Errorf("Unexpected vars %v", vars)
+	}
+}
+
+func TestPosixRejectsUnexpectedStatements(t *testing.T) {
+	for _, body := range []string{
+		"rm -rf /",
+		"export KEY='unterminated",
+		"export 1KEY=x",
+		"export KEY",
+	} {
+		if _, err := (posixDialect{}).ParseVars(body); err == nil {
+			t.Errorf("ParseVars(%q) should fail", body)
+		}
+	}
+}
+
+func TestPosixValuesAreNotExpandedByShell(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+
+	dir := t.TempDir()
+	canary := filepath.Join(dir, "pwned")
+	values := append([]string{
+		"$(touch " + canary + ")",
+		"`touch " + canary + "`",
+	}, trickyValues...)
+
+	for _, value := range values {
+		if strings.ContainsAny(value, "\x00") {
+			continue
+		}
+		script := filepath.Join(dir, "env.sh")
+		content := posixDialect{}.FormatVar("KEY", value) + "\n"
+		if err := os.WriteFile(script, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := exec.Command(sh, "-c", `. "$1" && printf '%s' "$KEY"`, "sh", script).Output()
+		if err != nil {
+			t.Errorf("sourcing value %q failed: %v", value, err)
+			continue
+		}
+		if string(out) != value {
+			t.Errorf("shell read %q back as %q", value, out)
+		}
+	}
+
+	if _, err := os.Stat(canary); err == nil {
+		t.Error("a value was executed by the shell")
+	}
+}
+
+func TestProfileStoreRoundTripAndOrdering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".bashrc")
+	store := NewProfileStore(path, posixDialect{})
+
+	vars := map[string]string{}
+	for i, value := range trickyValues {
+		vars["VAR_"+string(rune('A'+i))] = value
+	}
+	if err := SetAllVars(store, vars); err != nil {
+		t.Fatalf("SetAllVars failed: %v", err)
+	}
+
+	read, err := store.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	for key, value := range vars {
+		if read[key] != value {
+			t.Errorf("%s: wrote %q, read %q", key, value, read[key])
+		}
+	}
+
+	// Writing the same variables again must produce identical bytes
+	first, _ := os.ReadFile(path)
+	if err := SetAllVars(NewProfileStore(path, posixDialect{}), map[string]string{"VAR_A": "changed"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetAllVars(NewProfileStore(path, posixDialect{}), map[string]string{"VAR_A": vars["VAR_A"]}); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := os.ReadFile(path)
+	if string(first) != string(second) {
+		t.Errorf("Output is not deterministic:\n%s\n---\n%s", first, second)
+	}
+
+	if strings.Index(string(first), "export VAR_A=") > strings.Index(string(first), "export VAR_B=") {
+		t.Error("Keys are not written in sorted order")
+	}
+}
+
+func TestProfileStoreRejectsInvalidInput(t *testing.T) {
+	store := NewProfileStore(filepath.Join(t.TempDir(), ".bashrc"), posixDialect{})
+
+	if err := store.Set("BAD-NAME", "x"); err == nil {
+		t.Error("Set with an invalid name should fail")
+	}
+	if err := store.Set("KEY", "nul\x00byte"); err == nil {
+		t.Error("Set with a NUL byte should fail")
+	}
+}
+
+func FuzzPosixRoundTrip(f *testing.F) {
+	for _, value := range trickyValues {
+		f.Add(value)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		if strings.ContainsRune(value, 0) {
+			t.Skip("NUL cannot be stored in the environment")
+		}
+		d := posixDialect{}
+		vars, err := d.ParseVars(d.FormatVar("KEY", value))
+		if err != nil {
+			t.Fatalf("ParseVars(FormatVar(%q)) failed: %v", value, err)
+		}
+		if vars["KEY"] != value {
+			t.Fatalf("Round trip of %q produced %q", value, vars["KEY"])
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// xonshDialect writes `$KEY = "VALUE"` (a Python string literal) for ~/.xonshrc
+type xonshDialect struct{}
+
+func (xonshDialect) Name() string { return "xonsh" }
+
+func (xonshDialect) Markers() (string, string) { return dialectMarkers("xonsh") }
+
+func (xonshDialect) requiresUTF8() {}
+
+// FormatVar writes a plain (non f-string) Python double-quoted literal, so
+// nothing in the value is evaluated
+func (xonshDialect) FormatVar(key, value string) string {
+	return "$" + key + " = " + pythonQuote(value)
+}
+
+// SourceLine sources path when the file exists
+func (xonshDialect) SourceLine(path string) string {
+	return "if __import__('os').path.isfile(" + pythonQuote(path) + "):\n    source " + pythonQuote(path)
+}
+
+// pythonQuote returns value as a Python string literal
+func pythonQuote(value string) string {
+	var b strings.Builder
+	b.WriteString(`"`)
+	for _, r := range value {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\x%02x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteString(`"`)
+	return b.String()
+}
+
+// ParseVars understands `$KEY = "..."` and `$KEY = '...'` statements
+func (xonshDialect) ParseVars(body string) (map[string]string, error) {
+	vars := make(map[string]string)
+	p := &shellScanner{src: body}
+
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return vars, nil
+		}
+		if p.peek() == '#' {
+			p.skipLine()
+			continue
+		}
+
+		if !p.consume("$") {
+			return nil, p.errorf("expected '$KEY = ...'")
+		}
+		key, err := p.bareWord()
+		if err != nil {
+			return nil, err
+		}
+		if !isValidKey(key) {
+			return nil, p.errorf("invalid variable name %q", key)
+		}
+		p.skipSpaces()
+		if !p.consume("=") {
+			return nil, p.errorf("expected '=' after %s", key)
+		}
+		p.skipSpaces()
+
+		value, err := p.pythonString()
+		if err != nil {
+			return nil, err
+		}
+		vars[key] = value
+	}
+}
+
+// pythonString reads a single- or double-quoted Python string literal with
+// the common escapes (\\ \' \" \n \r \t \xHH \uHHHH)
+func (p *shellScanner) pythonString() (string, error) {
+	if p.eof() || (p.peek() != '"' && p.peek() != '\'') {
+		return "", p.errorf("expected a quoted string")
+	}
+	quote := p.peek()
+	p.pos++
+
+	var b strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.peek()
+		p.pos++
+		if c == quote {
+			return b.String(), nil
+		}
+		if c == '\n' {
+			return "", p.errorf("newline in string literal")
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+
+		if p.eof() {
+			return "", p.errorf("unterminated escape")
+		}
+		e := p.peek()
+		p.pos++
+		switch e {
+		case '"', '\'', '\\':
+			b.WriteByte(e)
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'x', 'u':
+			size := 2
+			if e == 'u' {
+				size = 4
+			}
+			if p.pos+size > len(p.src) {
+				return "", p.errorf("invalid \\%c escape", e)
+			}
+			n, err := strconv.ParseUint(p.src[p.pos:p.pos+size], 16, 32)
+			if err != nil {
+				return "", p.errorf("invalid \\%c escape", e)
+			}
+			b.WriteRune(rune(n))
+			p.pos += size
+		default:
+			return "", p.errorf("unknown escape \\%c", e)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Storage selects where a ProfileStore keeps the variables
+type Storage string
+
+const (
+	// StorageInline writes the variables into the block in the profile
+	StorageInline Storage = "inline"
+	// StorageFile writes the variables into a managed env file and puts
+	// only a guarded source line into the profile block, so the profile is
+	// written once and later changes only touch the env file
+	StorageFile Storage = "file"
+)
+
+// ParseStorage parses a --storage value
+func ParseStorage(value string) (Storage, error) {
+	switch Storage(strings.ToLower(strings.TrimSpace(value))) {
+	case StorageInline:
+		return StorageInline, nil
+	case StorageFile:
+		return StorageFile, nil
+	}
+	return "", fmt.Errorf("unknown storage mode %q (use inline or file)", value)
+}
+
+// envFileMode keeps the env file, which may hold an API key, private
+const envFileMode = 0600
+
+// envFileNames maps dialect names to the name of their managed env file
+var envFileNames = map[string]string{
+	"posix": "env.sh",
+	"fish":  "env.fish",
+	"csh":   "env.csh",
+	"tcsh":  "env.csh",
+	"nu":    "env.nu",
+	"xonsh": "env.xsh",
+	"pwsh":  "env.ps1",
+}
+
+// ConfigDir returns the tool's configuration directory under home, which
+// holds the managed env files and named profiles
+func ConfigDir(home string) string {
+	return filepath.Join(home, ".config", "claude-foundry-manager")
+}
+
+// envFilePath returns the managed env file for dialect under home
+func envFilePath(home string, dialect Dialect) string {
+	return filepath.Join(ConfigDir(home), envFileNames[dialect.Name()])
+}
+
+// SetStorage makes the next write use the given storage mode, migrating the
+// existing block if it is stored the other way
+func (s *ProfileStore) SetStorage(mode Storage) {
+	s.storage = mode
+}
+
+// Storage reports how the variables are currently stored
+func (s *ProfileStore) Storage() (Storage, error) {
+	state, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	return state.storage, nil
+}
+
+// EnvFile returns the managed env file this profile sources in file mode
+func (s *ProfileStore) EnvFile() string {
+	return s.envFile
+}
+
+// sourcesEnvFile reports whether a block body loads the managed env file
+func (s *ProfileStore) sourcesEnvFile(body string) bool {
+	return s.envFile != "" && strings.Contains(body, s.dialect.SourceLine(s.envFile))
+}
+
+// envFileShared reports whether another profile still sources the env
+// file, in which case leaving file mode must not remove it
+func (s *ProfileStore) envFileShared() bool {
+	line := s.dialect.SourceLine(s.envFile)
+	for _, path := range s.envPeers {
+		if data, err := os.ReadFile(path); err == nil && strings.Contains(string(data), line) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderEnvFile returns the content of the managed env file holding vars
+func (s *ProfileStore) renderEnvFile(vars map[string]string) string {
+	lines := append([]string{}, blockHeader...)
+	lines = append(lines, s.formatVars(vars)...)
+	return strings.Join(lines, "\n") + "\n"
+}
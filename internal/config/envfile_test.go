@@ -0,0 +1,161 @@
+package config
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestFileStorageMigratesInlineBlock(t *testing.T) {
+	home := t.TempDir()
+	profile := filepath.Join(home, ".zshrc")
+	if err := os.WriteFile(profile, []byte("# my zshrc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, _ := NewShellStore(home, "zsh")
+	if err := store.Set(EnvFoundryResource, "inline"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Switching to file storage moves the variables out of the profile
+	store.SetStorage(StorageFile)
+	if err := store.Set(EnvUseFoundry, "true"); err != nil {
+		t.Fatalf("Set with file storage failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(profile)
+	if strings.Contains(string(data), EnvFoundryResource) {
+		t.Errorf("Profile still holds the variables:\n%s", data)
+	}
+	if !strings.Contains(string(data), posixDialect{}.SourceLine(store.EnvFile())) {
+		t.Errorf("Profile does not source the env file:\n%s", data)
+	}
+
+	info, err := os.Stat(store.EnvFile())
+	if err != nil {
+		t.Fatalf("Env file not created: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Expected env file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	// A fresh store detects file mode and leaves the profile alone
+	before, _ := os.ReadFile(profile)
+	fresh, _ := NewShellStore(home, "zsh")
+	if mode, _ := fresh.Storage(); mode != StorageFile {
+		t.Errorf("Expected file storage to be detected, got %q", mode)
+	}
+	if err := fresh.Set(EnvFoundryResource, "file"); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.ReadFile(profile)
+	if string(before) != string(after) {
+		t.Errorf("Profile changed in file mode:\n%s", after)
+	}
+
+	vars, err := fresh.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars[EnvFoundryResource] != "file" || vars[EnvUseFoundry] != "true" {
+		t.Errorf("Unexpected variables: %v", vars)
+	}
+
+	// And back again
+	fresh.SetStorage(StorageInline)
+	if err := fresh.Set(EnvFoundryResource, "inline"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(fresh.EnvFile()); !os.IsNotExist(err) {
+		t.Errorf("Env file should be removed after switching back to inline")
+	}
+	data, _ = os.ReadFile(profile)
+	if !strings.Contains(string(data), "export CLAUDE_CODE_USE_FOUNDRY='true'") {
+		t.Errorf("Variables not moved back into the profile:\n%s", data)
+	}
+}
+
+func TestFileStorageRollbackOnlyTouchesEnvFile(t *testing.T) {
+	home := t.TempDir()
+	store, _ := NewShellStore(home, "bash")
+	store.SetStorage(StorageFile)
+	if err := ApplyFoundryConfig(store, &FoundryConfig{Resource: "res"}); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(store.Path())
+
+	if err := RollbackToDefault(store); err != nil {
+		t.Fatalf("RollbackToDefault failed: %v", err)
+	}
+
+	after, _ := os.ReadFile(store.Path())
+	if string(before) != string(after) {
+		t.Errorf("Rollback rewrote the profile:\n%s", after)
+	}
+	vars, _ := store.List()
+	if len(vars) != 0 {
+		t.Errorf("Expected no variables after rollback, got %v", vars)
+	}
+}
+
+func TestFileStorageKeepsSharedEnvFile(t *testing.T) {
+	home := t.TempDir()
+	zsh, _ := NewShellStore(home, "zsh")
+	bash, _ := NewShellStore(home, "bash")
+	both := NewMultiStore(zsh, bash)
+	both.SetStorage(StorageFile)
+	if err := both.Set(EnvUseFoundry, "true"); err != nil {
+		t.Fatal(err)
+	}
+
+	// zsh goes back to inline while bash still sources env.sh
+	zsh.SetStorage(StorageInline)
+	if err := zsh.Set(EnvFoundryResource, "res"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(zsh.EnvFile()); err != nil {
+		t.Errorf("Env file still sourced by bash was removed: %v", err)
+	}
+}
+
+func TestFileStorageSourcedByRealShell(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+
+	home := t.TempDir()
+	store, _ := NewShellStore(home, "sh")
+	store.SetStorage(StorageFile)
+	value := `it's $HOME`
+	if err := store.Set("KEY", value); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := exec.Command(sh, "-c", `. "$1" && printf '%s' "$KEY"`, "sh", store.Path()).Output()
+	if err != nil {
+		t.Fatalf("sh failed: %v", err)
+	}
+	if string(out) != value {
+		t.Errorf("Expected %q, got %q", value, out)
+	}
+
+	// The guard keeps the profile working when the env file is gone
+	os.Remove(store.EnvFile())
+	if err := exec.Command(sh, "-c", `. "$1"`, "sh", store.Path()).Run(); err != nil {
+		t.Errorf("Profile fails without the env file: %v", err)
+	}
+}
+
+func TestParseStorage(t *testing.T) {
+	if mode, err := ParseStorage(" File "); err != nil || mode != StorageFile {
+		t.Errorf("Expected file, got %q (%v)", mode, err)
+	}
+	if _, err := ParseStorage("registry"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
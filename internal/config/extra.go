@@ -0,0 +1,281 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Extra variables are set with configure --env KEY=VALUE next to the
+// provider variables (ANTHROPIC_MODEL, DISABLE_TELEMETRY, ...). The
+// manifest remembers which ones this tool set, so that backup, rollback
+// and show cover them on every store, including the registry.
+
+// manifestName is the file in ConfigDir that lists the extra variables
+const manifestName = "managed-keys.json"
+
+// extraKeyPattern matches a portable environment variable name
+var extraKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// allowedExactKeys and allowedPrefixes are the variables --env may set:
+// Claude Code settings and the proxy and certificate variables it reads
+var (
+	allowedExactKeys = []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "NODE_EXTRA_CA_CERTS", "USE_BUILTIN_RIPGREP"}
+	allowedPrefixes  = []string{"ANTHROPIC_", "CLAUDE_", "DISABLE_", "MCP_", "BASH_", "MAX_", "OTEL_", "AWS_", "CLOUD_ML_", "VERTEX_REGION_"}
+)
+
+// deniedExactKeys and deniedPrefixes are never set, even when allowed
+// above: clobbering them breaks the shell or changes what programs run
+var (
+	deniedExactKeys = []string{"PATH", "HOME", "USER", "SHELL", "PWD", "IFS", "PS1", "TERM", "LANG", "TMPDIR", "BASH_ENV", "ENV", "NODE_OPTIONS"}
+	deniedPrefixes  = []string{"LD_", "DYLD_"}
+)
+
+// manifest is the content of the manifest file
+type manifest struct {
+	Keys []string `json:"keys"`
+}
+
+// ValidateExtraKey checks that key may be set with --env
+func ValidateExtraKey(key string) error {
+	if !extraKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid variable name %q", key)
+	}
+
+	upper := strings.ToUpper(key)
+	if upper != key {
+		return fmt.Errorf("invalid variable name %q: use upper case", key)
+	}
+	if containsKey(deniedExactKeys, upper) || hasAnyPrefix(upper, deniedPrefixes) || strings.HasSuffix(upper, "PATH") {
+		return fmt.Errorf("%s is protected and cannot be managed by this tool", key)
+	}
+	if isProviderKey(key) {
+		return fmt.Errorf("%s belongs to a provider, use the configure flags (e.g. --provider, --region) instead", key)
+	}
+	if !containsKey(allowedExactKeys, upper) && !hasAnyPrefix(upper, allowedPrefixes) {
+		return fmt.Errorf("%s is not a Claude Code variable (allowed: %s*, %s)",
+			key, strings.Join(allowedPrefixes, "*, "), strings.Join(allowedExactKeys, ", "))
+	}
+	return nil
+}
+
+// ValidateManagedKey checks that key is a provider variable or an extra
+// variable --env may set; the tool never writes any other
+func ValidateManagedKey(key string) error {
+	if isProviderKey(key) {
+		return nil
+	}
+	return ValidateExtraKey(key)
+}
+
+// ParseEnvAssignment splits a KEY=VALUE argument and validates it
+func ParseEnvAssignment(arg string) (string, string, error) {
+	key, value, ok := strings.Cut(arg, "=")
+	if !ok {
+		return "", "", fmt.Errorf("invalid --env %q: expected KEY=VALUE", arg)
+	}
+	if err := ValidateExtraKey(key); err != nil {
+		return "", "", err
+	}
+	if value == "" {
+		return "", "", fmt.Errorf("invalid --env %q: use --unset %s to remove a variable", arg, key)
+	}
+	if strings.ContainsAny(value, "\x00\r\n") {
+		return "", "", fmt.Errorf("invalid --env %s: the value must be a single line", key)
+	}
+	return key, value, nil
+}
+
+// ApplyEnv sets and removes extra variables in one transaction and updates
+// the manifest. New keys are recorded before the store is written and
+// removed keys forgotten after, so the manifest never misses a variable
+// the store holds.
+func ApplyEnv(store EnvStore, sets map[string]string, unsets []string) error {
+	newKeys := make([]string, 0, len(sets))
+	for key, value := range sets {
+		if _, _, err := ParseEnvAssignment(key + "=" + value); err != nil {
+			return err
+		}
+		newKeys = append(newKeys, key)
+	}
+	for _, key := range unsets {
+		if err := ValidateExtraKey(key); err != nil {
+			return err
+		}
+		if _, ok := sets[key]; ok {
+			return fmt.Errorf("%s is both set and unset", key)
+		}
+	}
+
+	if err := RecordExtraKeys(newKeys); err != nil {
+		return err
+	}
+
+	tx := Begin(store)
+	for _, key := range sortedKeys(sets) {
+		tx.Set(key, sets[key])
+	}
+	for _, key := range unsets {
+		tx.Delete(key)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return ForgetExtraKeys(unsets)
+}
+
+// ExtraKeys returns the extra variables recorded in the manifest
+func ExtraKeys() ([]string, error) {
+	path, err := manifestPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	// A manifest written by hand or by an older version may list protected
+	// variables such as PATH; those are never managed
+	keys := []string{}
+	for _, key := range m.Keys {
+		if ValidateExtraKey(key) == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// RecordExtraKeys adds keys to the manifest. Provider variables are left
+// out, and keys ValidateExtraKey rejects are refused.
+func RecordExtraKeys(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	for _, key := range keys {
+		if err := ValidateManagedKey(key); err != nil {
+			return err
+		}
+	}
+	current, err := ExtraKeys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if !containsKey(current, key) && !isProviderKey(key) {
+			current = append(current, key)
+		}
+	}
+	return saveExtraKeys(current)
+}
+
+// ForgetExtraKeys removes keys from the manifest
+func ForgetExtraKeys(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	current, err := ExtraKeys()
+	if err != nil {
+		return err
+	}
+	kept := []string{}
+	for _, key := range current {
+		if !containsKey(keys, key) {
+			kept = append(kept, key)
+		}
+	}
+	return saveExtraKeys(kept)
+}
+
+// ExtraVars returns the variables of vars that no provider owns
+func ExtraVars(vars map[string]string) map[string]string {
+	extra := map[string]string{}
+	for key, value := range vars {
+		if !isProviderKey(key) {
+			extra[key] = value
+		}
+	}
+	return extra
+}
+
+// ProviderVars returns the variables of vars that a provider owns
+func ProviderVars(vars map[string]string) map[string]string {
+	owned := map[string]string{}
+	for key, value := range vars {
+		if isProviderKey(key) {
+			owned[key] = value
+		}
+	}
+	return owned
+}
+
+// saveExtraKeys writes the manifest, sorted, removing it when empty
+func saveExtraKeys(keys []string) error {
+	path, err := manifestPath()
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		return nil
+	}
+
+	sort.Strings(keys)
+	data, err := json.MarshalIndent(manifest{Keys: keys}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0600)
+}
+
+// manifestPath returns the location of the manifest
+func manifestPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(ConfigDir(home), manifestName), nil
+}
+
+// isProviderKey reports whether a provider owns key
+func isProviderKey(key string) bool {
+	return containsKey(allKeys, key)
+}
+
+// containsKey reports whether keys contains key
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAnyPrefix reports whether s starts with one of prefixes
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
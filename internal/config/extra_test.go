@@ -0,0 +1,125 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateExtraKey(t *testing.T) {
+	for _, key := range []string{"ANTHROPIC_MODEL", "DISABLE_TELEMETRY", "CLAUDE_CODE_MAX_OUTPUT_TOKENS", "HTTPS_PROXY"} {
+		if err := ValidateExtraKey(key); err != nil {
+			t.Errorf("Expected %s to be allowed: %v", key, err)
+		}
+	}
+
+	rejected := map[string]string{
+		"PATH":                 "protected",
+		"PYTHONPATH":           "protected",
+		"LD_PRELOAD":           "protected",
+		"BASH_ENV":             "protected",
+		"EDITOR":               "not a Claude Code variable",
+		"disable_telemetry":    "upper case",
+		"1BAD":                 "invalid variable name",
+		EnvFoundryResource:     "belongs to a provider",
+		"ANTHROPIC_MODEL=oops": "invalid variable name",
+	}
+	for key, reason := range rejected {
+		err := ValidateExtraKey(key)
+		if err == nil || !strings.Contains(err.Error(), reason) {
+			t.Errorf("Expected %s to be rejected as %q, got %v", key, reason, err)
+		}
+	}
+}
+
+func TestApplyEnvTracksManagedKeys(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("USERPROFILE", t.TempDir())
+
+	store := NewMemoryStore()
+	if err := ApplyFoundryConfig(store, &FoundryConfig{Resource: "res"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyEnv(store, map[string]string{"DISABLE_TELEMETRY": "1", "ANTHROPIC_MODEL": "m"}, nil); err != nil {
+		t.Fatalf("ApplyEnv failed: %v", err)
+	}
+
+	keys := ManagedKeys()
+	if !containsKey(keys, "DISABLE_TELEMETRY") || !containsKey(keys, "ANTHROPIC_MODEL") {
+		t.Errorf("Expected the extra variables to be managed, got %v", keys)
+	}
+	if vars := GetAllVars(store); vars["DISABLE_TELEMETRY"] != "1" || vars[EnvFoundryResource] != "res" {
+		t.Errorf("Expected GetAllVars to cover extra variables, got %v", vars)
+	}
+
+	// Switching provider keeps the extra variables
+	if err := ApplyProvider(store, Gateway, map[string]string{"base_url": "https://llm.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := store.Get("ANTHROPIC_MODEL"); value != "m" {
+		t.Errorf("Expected ANTHROPIC_MODEL to survive a provider switch, got %q", value)
+	}
+
+	if err := ApplyEnv(store, nil, []string{"ANTHROPIC_MODEL"}); err != nil {
+		t.Fatal(err)
+	}
+	if extra, _ := ExtraKeys(); len(extra) != 1 || extra[0] != "DISABLE_TELEMETRY" {
+		t.Errorf("Expected only DISABLE_TELEMETRY in the manifest, got %v", extra)
+	}
+
+	if err := RollbackToDefault(store); err != nil {
+		t.Fatal(err)
+	}
+	vars, _ := store.List()
+	if len(vars) != 0 {
+		t.Errorf("Expected rollback to remove the extra variables, got %v", vars)
+	}
+	if extra, _ := ExtraKeys(); len(extra) != 0 {
+		t.Errorf("Expected an empty manifest after rollback, got %v", extra)
+	}
+}
+
+func TestParseEnvAssignment(t *testing.T) {
+	key, value, err := ParseEnvAssignment("ANTHROPIC_CUSTOM_HEADERS=X-Team: a=b")
+	if err != nil || key != "ANTHROPIC_CUSTOM_HEADERS" || value != "X-Team: a=b" {
+		t.Errorf("Unexpected result: %q %q %v", key, value, err)
+	}
+	for _, arg := range []string{"DISABLE_TELEMETRY", "DISABLE_TELEMETRY=", "DISABLE_TELEMETRY=a\nb"} {
+		if _, _, err := ParseEnvAssignment(arg); err == nil {
+			t.Errorf("Expected an error for %q", arg)
+		}
+	}
+}
+
+func TestProtectedKeysAreNeverManaged(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	if err := RecordExtraKeys([]string{"DISABLE_TELEMETRY", "PATH"}); err == nil {
+		t.Error("Expected RecordExtraKeys to refuse PATH")
+	}
+	if err := RecordExtraKeys([]string{EnvFoundryResource, "DISABLE_TELEMETRY"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A manifest listing PATH, e.g. from an older version, does not make
+	// rollback delete it
+	if err := saveExtraKeys([]string{"DISABLE_TELEMETRY", "PATH", "LD_PRELOAD"}); err != nil {
+		t.Fatal(err)
+	}
+	if extra, _ := ExtraKeys(); len(extra) != 1 || extra[0] != "DISABLE_TELEMETRY" {
+		t.Errorf("Expected only DISABLE_TELEMETRY to be managed, got %v", extra)
+	}
+	store := NewMemoryStore()
+	store.Set("PATH", "/usr/bin")
+	store.Set("DISABLE_TELEMETRY", "1")
+	if err := RollbackToDefault(store); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := store.Get("PATH"); value != "/usr/bin" {
+		t.Errorf("Expected rollback to keep PATH, got %q", value)
+	}
+	if value, _ := store.Get("DISABLE_TELEMETRY"); value != "" {
+		t.Errorf("Expected rollback to remove DISABLE_TELEMETRY, got %q", value)
+	}
+}
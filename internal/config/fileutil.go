@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// maxSymlinkDepth bounds symlink resolution to avoid loops
+const maxSymlinkDepth = 40
+
+// resolvePath follows symlinks so writes go to the real file instead of
+// replacing the link. Dangling links resolve to the (missing) target.
+func resolvePath(path string) (string, error) {
+	for i := 0; i < maxSymlinkDepth; i++ {
+		info, err := os.Lstat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return path, nil
+			}
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return path, nil
+		}
+
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		path = target
+	}
+	return "", fmt.Errorf("too many levels of symbolic links: %s", path)
+}
+
+// WriteFileAtomic replaces path with data like writeFileAtomic, for other
+// packages
+func WriteFileAtomic(path string, data []byte, defaultMode os.FileMode) error {
+	return writeFileAtomic(path, data, defaultMode)
+}
+
+// writeFileAtomic replaces path with data. The data is written to a temp
+// file in the same directory, synced and renamed over the original, so
+// readers never see a truncated file. The mode and owner of an existing
+// file are preserved; new files get defaultMode.
+func writeFileAtomic(path string, data []byte, defaultMode os.FileMode) error {
+	path, err := resolvePath(path)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	mode := defaultMode
+	existing, err := os.Stat(path)
+	if err == nil {
+		mode = existing.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmpName, mode); err != nil {
+		return err
+	}
+	if existing != nil {
+		if err := copyOwner(tmpName, existing); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+
+	syncDir(dir)
+	return nil
+}
+
+// withFileLock runs fn while holding an advisory lock that serializes
+// read-modify-write cycles on path across processes
+func withFileLock(path string, fn func() error) error {
+	path, err := resolvePath(path)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockPath(path)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	defer unlock()
+
+	return fn()
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestWriteFileAtomicPreservesMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not meaningful on Windows")
+	}
+
+	path := filepath.Join(t.TempDir(), ".zshrc")
+	if err := os.WriteFile(path, []byte("old\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(path, []byte("new\n"), 0644); err != nil {
+		t.Fatalf("writeFileAtomic failed: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Mode changed to %v, expected 0600", info.Mode().Perm())
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "new\n" {
+		t.Errorf("Unexpected content %q", data)
+	}
+}
+
+func TestWriteFileAtomicFollowsSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on Windows")
+	}
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dotfiles", "zshrc")
+	link := filepath.Join(dir, ".zshrc")
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("dotfiles", "zshrc"), link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(link, []byte("new\n"), 0644); err != nil {
+		t.Fatalf("writeFileAtomic failed: %v", err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Error("Symlink was replaced by a regular file")
+	}
+
+	data, _ := os.ReadFile(target)
+	if string(data) != "new\n" {
+		t.Errorf("Target not updated, got %q", data)
+	}
+}
+
+func TestProfileStoreConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".bashrc")
+
+	const writers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Separate store instances behave like separate processes
+			store := NewProfileStore(path, posixDialect{})
+			errs <- store.Set(fmt.Sprintf("VAR_%d", i), "value")
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	vars, err := NewProfileStore(path, posixDialect{}).List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vars) != writers {
+		t.Errorf("Expected %d variables, got %d: %v", writers, len(vars), vars)
+	}
+}
@@ -0,0 +1,47 @@
+//go:build windows
+
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockPath takes an exclusive lock on a lock file in the temp directory
+// derived from path. Windows cannot lock directories, and a lock file next
+// to the profile would be left behind in the user's home.
+func lockPath(path string) (func(), error) {
+	sum := sha256.Sum256([]byte(strings.ToLower(filepath.Clean(path))))
+	lockName := filepath.Join(os.TempDir(), "claude-foundry-"+hex.EncodeToString(sum[:8])+".lock")
+
+	f, err := os.OpenFile(lockName, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	handle := windows.Handle(f.Fd())
+	overlapped := new(windows.Overlapped)
+	if err := windows.LockFileEx(handle, windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, overlapped); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return func() {
+		windows.UnlockFileEx(handle, 0, 1, 0, overlapped)
+		f.Close()
+	}, nil
+}
+
+// copyOwner is a no-op on Windows; the replacement file inherits the
+// directory ACL like the original did
+func copyOwner(path string, original os.FileInfo) error {
+	return nil
+}
+
+// syncDir is a no-op on Windows, where directories cannot be fsynced
+func syncDir(dir string) {}
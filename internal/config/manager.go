@@ -1,29 +1,26 @@
 package config
 
-import (
-	"fmt"
-	"strings"
-)
+import "strings"
 
 // Environment variable names used by Claude Code
 const (
-	EnvUseFoundry       = "CLAUDE_CODE_USE_FOUNDRY"
-	EnvFoundryResource  = "ANTHROPIC_FOUNDRY_RESOURCE"
-	EnvFoundryBaseURL   = "ANTHROPIC_FOUNDRY_BASE_URL"
-	EnvFoundryAPIKey    = "ANTHROPIC_FOUNDRY_API_KEY"
-	EnvDefaultSonnet    = "ANTHROPIC_DEFAULT_SONNET_MODEL"
-	EnvDefaultHaiku     = "ANTHROPIC_DEFAULT_HAIKU_MODEL"
-	EnvDefaultOpus      = "ANTHROPIC_DEFAULT_OPUS_MODEL"
+	EnvUseFoundry      = "CLAUDE_CODE_USE_FOUNDRY"
+	EnvFoundryResource = "ANTHROPIC_FOUNDRY_RESOURCE"
+	EnvFoundryBaseURL  = "ANTHROPIC_FOUNDRY_BASE_URL"
+	EnvFoundryAPIKey   = "ANTHROPIC_FOUNDRY_API_KEY"
+	EnvDefaultSonnet   = "ANTHROPIC_DEFAULT_SONNET_MODEL"
+	EnvDefaultHaiku    = "ANTHROPIC_DEFAULT_HAIKU_MODEL"
+	EnvDefaultOpus     = "ANTHROPIC_DEFAULT_OPUS_MODEL"
 )
 
 // FoundryConfig represents the Azure Foundry configuration
 type FoundryConfig struct {
-	Resource    string // Optional - provide either Resource OR BaseURL
-	BaseURL     string // Optional - provide either Resource OR BaseURL
-	APIKey      string // Optional - if empty, use Entra ID
-	SonnetModel string
-	HaikuModel  string
-	OpusModel   string
+	Resource    string `json:"resource,omitempty"` // Optional - provide either Resource OR BaseURL
+	BaseURL     string `json:"base_url,omitempty"` // Optional - provide either Resource OR BaseURL
+	APIKey      string `json:"api_key,omitempty"`  // Optional - if empty, use Entra ID
+	SonnetModel string `json:"sonnet_model,omitempty"`
+	HaikuModel  string `json:"haiku_model,omitempty"`
+	OpusModel   string `json:"opus_model,omitempty"`
 }
 
 // CurrentConfig represents the current system configuration
@@ -35,10 +32,28 @@ type CurrentConfig struct {
 	SonnetModel string
 	HaikuModel  string
 	OpusModel   string
+	// Provider is the provider the persisted variables select, and
+	// Conflicts lists further providers they also enable
+	Provider  Provider
+	Conflicts []Provider
+	// Settings holds the persisted variables of Provider
+	Settings map[string]string
+	// Extra holds the persisted variables set with --env
+	Extra map[string]string
+	// Vars compares the persisted and live value of every managed variable
+	Vars []VarStatus
 }
 
-// ApplyFoundryConfig applies Azure Foundry configuration to the system
-func ApplyFoundryConfig(cfg *FoundryConfig) error {
+// ApplyFoundryConfig applies Azure Foundry configuration to the store.
+// Managed variables the configuration leaves empty are removed, so nothing
+// from a previous setup (such as its API key) is left behind.
+func ApplyFoundryConfig(store EnvStore, cfg *FoundryConfig) error {
+	return applyVars(store, FoundryVars(cfg))
+}
+
+// FoundryVars returns the environment variables ApplyFoundryConfig sets
+// for cfg; empty values are left out
+func FoundryVars(cfg *FoundryConfig) map[string]string {
 	vars := map[string]string{
 		EnvUseFoundry:    "true",
 		EnvDefaultSonnet: cfg.SonnetModel,
@@ -62,62 +77,73 @@ func ApplyFoundryConfig(cfg *FoundryConfig) error {
 		vars[EnvFoundryAPIKey] = cfg.APIKey
 	}
 
-	// Set all environment variables
 	for key, value := range vars {
-		if err := setEnvVar(key, value); err != nil {
-			return fmt.Errorf("failed to set %s: %w", key, err)
+		if value == "" {
+			delete(vars, key)
 		}
 	}
-
-	// Notify system of environment changes
-	if err := notifyEnvironmentChange(); err != nil {
-		return fmt.Errorf("failed to notify system of changes: %w", err)
-	}
-
-	return nil
+	return vars
 }
 
-// RollbackToDefault removes all Azure Foundry configuration
-func RollbackToDefault() error {
-	vars := []string{
-		EnvUseFoundry,
-		EnvFoundryResource,
-		EnvFoundryBaseURL,
-		EnvFoundryAPIKey,
-		EnvDefaultSonnet,
-		EnvDefaultHaiku,
-		EnvDefaultOpus,
-	}
-
-	for _, key := range vars {
-		if err := deleteEnvVar(key); err != nil {
-			// Continue even if some deletions fail
-			fmt.Printf("Warning: failed to delete %s: %v\n", key, err)
+// RollbackToDefault removes the configuration of every provider and every
+// extra variable from the store, returning to the direct Anthropic API.
+// Either every variable is removed or none is.
+func RollbackToDefault(store EnvStore) error {
+	keys := ManagedKeys()
+	if vars, err := store.List(); err == nil {
+		for key := range ExtraVars(vars) {
+			if !containsKey(keys, key) && ValidateExtraKey(key) == nil {
+				keys = append(keys, key)
+			}
 		}
 	}
 
-	// Notify system of environment changes
-	if err := notifyEnvironmentChange(); err != nil {
-		return fmt.Errorf("failed to notify system of changes: %w", err)
+	tx := Begin(store)
+	for _, key := range keys {
+		tx.Delete(key)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
 	}
 
-	return nil
+	return ForgetExtraKeys(keys)
 }
 
-// GetCurrentConfig reads the current configuration from the system
-func GetCurrentConfig() (*CurrentConfig, error) {
+// GetCurrentConfig reads the persisted configuration from the store, along
+// with the live value and source of each variable
+func GetCurrentConfig(store EnvStore) (*CurrentConfig, error) {
 	cfg := &CurrentConfig{}
 
-	useFoundry, _ := getEnvVar(EnvUseFoundry)
-	cfg.UseFoundry = isTruthy(useFoundry)
+	vars, err := store.List()
+	if err != nil {
+		return nil, err
+	}
 
-	cfg.Resource, _ = getEnvVar(EnvFoundryResource)
-	cfg.BaseURL, _ = getEnvVar(EnvFoundryBaseURL)
-	cfg.APIKey, _ = getEnvVar(EnvFoundryAPIKey)
-	cfg.SonnetModel, _ = getEnvVar(EnvDefaultSonnet)
-	cfg.HaikuModel, _ = getEnvVar(EnvDefaultHaiku)
-	cfg.OpusModel, _ = getEnvVar(EnvDefaultOpus)
+	cfg.UseFoundry = isTruthy(vars[EnvUseFoundry])
+	cfg.Resource = vars[EnvFoundryResource]
+	cfg.BaseURL = vars[EnvFoundryBaseURL]
+	cfg.APIKey = vars[EnvFoundryAPIKey]
+	cfg.SonnetModel = vars[EnvDefaultSonnet]
+	cfg.HaikuModel = vars[EnvDefaultHaiku]
+	cfg.OpusModel = vars[EnvDefaultOpus]
+
+	cfg.Provider = DetectProvider(vars)
+	if active := DetectProviders(vars); len(active) > 1 {
+		cfg.Conflicts = active[1:]
+	}
+	cfg.Settings = map[string]string{}
+	for _, key := range cfg.Provider.Keys() {
+		if value := vars[key]; value != "" {
+			cfg.Settings[key] = value
+		}
+	}
 
+	cfg.Extra = ExtraVars(vars)
+
+	cfg.Vars, err = varStatuses(store, vars, cfg.Provider)
+	if err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
 
@@ -128,52 +154,54 @@ func isTruthy(value string) bool {
 	return value == "true" || value == "1" || value == "yes" || value == "on" || value == "enabled"
 }
 
-// GetAllVars returns all environment variable values as a map
-func GetAllVars() map[string]string {
+// GetAllVars returns the value of every managed variable in the store as
+// a map, including extra variables the store holds but the manifest lacks
+func GetAllVars(store EnvStore) map[string]string {
 	vars := make(map[string]string)
 
-	keys := []string{
-		EnvUseFoundry,
-		EnvFoundryResource,
-		EnvFoundryBaseURL,
-		EnvFoundryAPIKey,
-		EnvDefaultSonnet,
-		EnvDefaultHaiku,
-		EnvDefaultOpus,
-	}
-
-	for _, key := range keys {
-		value, _ := getEnvVar(key)
+	for _, key := range ManagedKeys() {
+		value, _ := store.Get(key)
 		if value != "" {
 			vars[key] = value
 		}
 	}
+	if listed, err := store.List(); err == nil {
+		for key, value := range ExtraVars(listed) {
+			vars[key] = value
+		}
+	}
 
 	return vars
 }
 
-// SetAllVars sets multiple environment variables from a map
-func SetAllVars(vars map[string]string) error {
+// SetAllVars sets multiple environment variables in the store from a map.
+// Either every variable is set or none is.
+func SetAllVars(store EnvStore, vars map[string]string) error {
+	tx := Begin(store)
 	for key, value := range vars {
-		if err := setEnvVar(key, value); err != nil {
-			return fmt.Errorf("failed to set %s: %w", key, err)
-		}
+		tx.Set(key, value)
 	}
 
-	// Notify system of environment changes
-	if err := notifyEnvironmentChange(); err != nil {
-		return fmt.Errorf("failed to notify system of changes: %w", err)
-	}
+	return tx.Commit()
+}
 
-	return nil
+// ManagedKeys returns the names of all environment variables managed by
+// this tool: those of every provider followed by the extra variables in
+// the manifest. An unreadable manifest contributes no keys.
+func ManagedKeys() []string {
+	keys := make([]string, len(allKeys))
+	copy(keys, allKeys)
+
+	extra, _ := ExtraKeys()
+	for _, key := range extra {
+		if !containsKey(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
 }
 
-// Platform-specific implementations are in separate files:
+// Storage backends implement EnvStore (store.go):
+// - profile.go: shell profile managed block (any platform, default on Linux/macOS)
 // - manager_windows.go: Windows registry implementation (build tag: windows)
-// - manager_unix.go: Linux/macOS shell profile implementation (build tag: !windows)
-//
-// Each file implements these functions for their respective platforms:
-// - getEnvVar(key string) (string, error)
-// - setEnvVar(key, value string) error
-// - deleteEnvVar(key string) error
-// - notifyEnvironmentChange() error
+// - manager_unix.go: DefaultStore for Linux/macOS (build tag: !windows)
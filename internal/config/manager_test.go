@@ -1,9 +1,25 @@
 package config
 
 import (
+	"os"
 	"testing"
 )
 
+// TestMain points HOME at a temporary directory, so tests never touch the
+// manifest of extra variables (or anything else) in the real home
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "config-test-home")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", home)
+	os.Setenv("USERPROFILE", home)
+
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
 func TestFoundryConfigStruct(t *testing.T) {
 	cfg := &FoundryConfig{
 		Resource:    "test-resource",
@@ -83,7 +99,7 @@ func TestEnvironmentVariableConstants(t *testing.T) {
 func TestGetAllVars(t *testing.T) {
 	// GetAllVars should return a map of environment variables
 	// This test just verifies it returns a map without errors
-	vars := GetAllVars()
+	vars := GetAllVars(NewMemoryStore())
 
 	if vars == nil {
 		t.Error("GetAllVars returned nil")
@@ -99,7 +115,7 @@ func TestGetAllVars(t *testing.T) {
 func TestGetCurrentConfig(t *testing.T) {
 	// GetCurrentConfig should return a CurrentConfig struct
 	// This test just verifies it returns without errors
-	cfg, err := GetCurrentConfig()
+	cfg, err := GetCurrentConfig(NewMemoryStore())
 
 	if err != nil {
 		t.Fatalf("GetCurrentConfig failed: %v", err)
@@ -178,7 +194,7 @@ func TestSetAllVarsWithEmptyMap(t *testing.T) {
 	emptyVars := make(map[string]string)
 
 	// This should not panic or error with empty map
-	err := SetAllVars(emptyVars)
+	err := SetAllVars(NewMemoryStore(), emptyVars)
 
 	// On some systems this might succeed (doing nothing)
 	// On others it might fail (can't set vars without permissions)
@@ -227,3 +243,24 @@ func TestIsTruthy(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyFoundryConfigClearsPreviousSetup(t *testing.T) {
+	store := NewMemoryStore()
+	if err := ApplyFoundryConfig(store, &FoundryConfig{Resource: "dev", APIKey: "secret", SonnetModel: "s"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyFoundryConfig(store, &FoundryConfig{BaseURL: "https://prod.example.com", SonnetModel: "s"}); err != nil {
+		t.Fatal(err)
+	}
+
+	vars, _ := store.List()
+	if _, ok := vars[EnvFoundryResource]; ok {
+		t.Error("Resource from the previous setup should be removed")
+	}
+	if _, ok := vars[EnvFoundryAPIKey]; ok {
+		t.Error("API key from the previous setup should be removed")
+	}
+	if vars[EnvFoundryBaseURL] != "https://prod.example.com" {
+		t.Errorf("Expected the new base URL, got %q", vars[EnvFoundryBaseURL])
+	}
+}
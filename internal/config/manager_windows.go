@@ -21,13 +21,37 @@ const (
 )
 
 var (
-	user32           = syscall.NewLazyDLL("user32.dll")
-	procSendMessage  = user32.NewProc("SendMessageTimeoutW")
+	user32          = syscall.NewLazyDLL("user32.dll")
+	procSendMessage = user32.NewProc("SendMessageTimeoutW")
 )
 
-// getEnvVar reads an environment variable from the Windows registry
-func getEnvVar(key string) (string, error) {
-	k, err := registry.OpenKey(registry.LOCAL_MACHINE, envRegPath, registry.QUERY_VALUE)
+// RegistryStore keeps variables in the system environment registry key
+type RegistryStore struct {
+	root registry.Key
+	path string
+}
+
+// NewRegistryStore creates a store over HKLM\SYSTEM\...\Session Manager\Environment
+func NewRegistryStore() *RegistryStore {
+	return &RegistryStore{root: registry.LOCAL_MACHINE, path: envRegPath}
+}
+
+// DefaultStore returns the system registry store
+func DefaultStore() (EnvStore, error) {
+	return NewRegistryStore(), nil
+}
+
+// Path returns the registry key of the store
+func (s *RegistryStore) Path() string {
+	if s.root == registry.CURRENT_USER {
+		return `HKCU\` + s.path
+	}
+	return `HKLM\` + s.path
+}
+
+// Get reads an environment variable from the Windows registry
+func (s *RegistryStore) Get(key string) (string, error) {
+	k, err := registry.OpenKey(s.root, s.path, registry.QUERY_VALUE)
 	if err != nil {
 		return "", err
 	}
@@ -44,9 +68,9 @@ func getEnvVar(key string) (string, error) {
 	return value, nil
 }
 
-// setEnvVar writes an environment variable to the Windows registry
-func setEnvVar(key, value string) error {
-	k, err := registry.OpenKey(registry.LOCAL_MACHINE, envRegPath, registry.SET_VALUE)
+// Set writes an environment variable to the Windows registry
+func (s *RegistryStore) Set(key, value string) error {
+	k, err := registry.OpenKey(s.root, s.path, registry.SET_VALUE)
 	if err != nil {
 		return fmt.Errorf("failed to open registry key (requires admin privileges): %w", err)
 	}
@@ -60,9 +84,9 @@ func setEnvVar(key, value string) error {
 	return nil
 }
 
-// deleteEnvVar removes an environment variable from the Windows registry
-func deleteEnvVar(key string) error {
-	k, err := registry.OpenKey(registry.LOCAL_MACHINE, envRegPath, registry.SET_VALUE)
+// Delete removes an environment variable from the Windows registry
+func (s *RegistryStore) Delete(key string) error {
+	k, err := registry.OpenKey(s.root, s.path, registry.SET_VALUE)
 	if err != nil {
 		return fmt.Errorf("failed to open registry key (requires admin privileges): %w", err)
 	}
@@ -79,7 +103,42 @@ func deleteEnvVar(key string) error {
 	return nil
 }
 
-// notifyEnvironmentChange broadcasts a message to all windows that environment has changed
+// List returns the Claude Code variables present in the registry.
+// The key also holds unrelated system variables (PATH etc.), so only
+// the variables this tool manages are returned.
+func (s *RegistryStore) List() (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, key := range ManagedKeys() {
+		value, err := s.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			vars[key] = value
+		}
+	}
+	return vars, nil
+}
+
+// Sources reports the registry key as the source of every variable
+func (s *RegistryStore) Sources() (map[string]Source, error) {
+	vars, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	sources := make(map[string]Source, len(vars))
+	for key := range vars {
+		sources[key] = Source{Path: s.Path()}
+	}
+	return sources, nil
+}
+
+// Commit broadcasts a message to all windows that environment has changed
+func (s *RegistryStore) Commit() error {
+	return notifyEnvironmentChange()
+}
+
+// notifyEnvironmentChange broadcasts WM_SETTINGCHANGE for "Environment"
 func notifyEnvironmentChange() error {
 	env, err := syscall.UTF16PtrFromString("Environment")
 	if err != nil {
@@ -0,0 +1,238 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+)
+
+// MultiStore writes the same variables to several stores at once, e.g. the
+// profiles of every shell a developer uses. Reads come from the first store.
+type MultiStore struct {
+	stores []EnvStore
+}
+
+// NewMultiStore creates a store that fans out to stores (at least one)
+func NewMultiStore(stores ...EnvStore) *MultiStore {
+	return &MultiStore{stores: stores}
+}
+
+// Stores returns the underlying stores
+func (m *MultiStore) Stores() []EnvStore {
+	return m.stores
+}
+
+// Get reads key from the first store
+func (m *MultiStore) Get(key string) (string, error) {
+	return m.stores[0].Get(key)
+}
+
+// Set writes key=value to every store
+func (m *MultiStore) Set(key, value string) error {
+	_, err := m.ApplyBatch(map[string]string{key: value}, nil)
+	return err
+}
+
+// Delete removes key from every store
+func (m *MultiStore) Delete(key string) error {
+	_, err := m.ApplyBatch(nil, []string{key})
+	return err
+}
+
+// List returns the variables of the first store
+func (m *MultiStore) List() (map[string]string, error) {
+	return m.stores[0].List()
+}
+
+// Commit commits every store
+func (m *MultiStore) Commit() error {
+	for _, store := range m.stores {
+		if err := store.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetStorage sets the storage mode of every profile store
+func (m *MultiStore) SetStorage(mode Storage) {
+	for _, store := range m.stores {
+		if profile, ok := store.(*ProfileStore); ok {
+			profile.SetStorage(mode)
+		}
+	}
+}
+
+// ApplyBatch applies the changes to every store. If any store fails, the
+// stores already changed are restored.
+func (m *MultiStore) ApplyBatch(sets map[string]string, deletes []string) (func() error, error) {
+	order := make([]string, 0, len(sets)+len(deletes))
+	changes := make(map[string]*string, len(sets)+len(deletes))
+	for _, key := range deletes {
+		order = append(order, key)
+		changes[key] = nil
+	}
+	for _, key := range sortedKeys(sets) {
+		value := sets[key]
+		if _, ok := changes[key]; !ok {
+			order = append(order, key)
+		}
+		changes[key] = &value
+	}
+
+	undos := []func() error{}
+	undoAll := func() error {
+		var errs []error
+		for i := len(undos) - 1; i >= 0; i-- {
+			errs = append(errs, undos[i]())
+		}
+		return errors.Join(errs...)
+	}
+
+	for _, store := range m.stores {
+		var undo func() error
+		var err error
+		if batch, ok := store.(BatchStore); ok {
+			undo, err = batch.ApplyBatch(sets, deletes)
+		} else {
+			undo, err = applyEach(store, order, changes)
+		}
+		if err != nil {
+			return nil, withUndo(err, undoAll)
+		}
+		undos = append(undos, undo)
+	}
+
+	return undoAll, nil
+}
+
+// ShellsStore creates a MultiStore over the shell profiles selected by spec:
+// "all" (every supported shell), "detected" (shells installed or already
+// configured on this machine) or a comma separated list such as "zsh,bash".
+// Shells sharing a profile file are only written once.
+func ShellsStore(home, spec string) (*MultiStore, error) {
+	names, err := resolveShells(home, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	stores := []EnvStore{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		store, err := NewShellStore(home, name)
+		if err != nil {
+			return nil, err
+		}
+		if seen[store.Path()] {
+			continue
+		}
+		seen[store.Path()] = true
+		stores = append(stores, store)
+	}
+
+	if len(stores) == 0 {
+		return nil, fmt.Errorf("no shells selected by %q", spec)
+	}
+	return NewMultiStore(stores...), nil
+}
+
+// resolveShells expands a --shells value into shell names
+func resolveShells(home, spec string) ([]string, error) {
+	switch strings.TrimSpace(spec) {
+	case "all":
+		return SupportedShells(), nil
+	case "detected":
+		return DetectShells(home), nil
+	}
+
+	names := []string{}
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := shells[normalizeShell(name)]; !ok {
+			return nil, fmt.Errorf("unsupported shell %q (supported: %s)", name, strings.Join(SupportedShells(), ", "))
+		}
+		names = append(names, normalizeShell(name))
+	}
+	return names, nil
+}
+
+// DetectShells returns the shells that are installed (on PATH) or whose
+// profile file already exists under home. The current login shell is
+// always included. Plain sh only counts when ~/.profile exists, since every
+// system has an sh binary.
+func DetectShells(home string) []string {
+	current := normalizeShell(os.Getenv("SHELL"))
+
+	names := []string{}
+	for _, name := range SupportedShells() {
+		store, _ := NewShellStore(home, name)
+		_, statErr := os.Stat(store.Path())
+		_, pathErr := exec.LookPath(name)
+
+		if name == current || statErr == nil || (pathErr == nil && name != "sh") {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ShellBlock describes a profile file that contains a managed block
+type ShellBlock struct {
+	Shell string
+	Path  string
+	Vars  map[string]string
+	// EnvFile is the managed env file the block sources, empty when the
+	// variables are stored inline
+	EnvFile string
+	Err     error // set when the block could not be parsed
+}
+
+// FindShellBlocks returns every supported shell profile under home that
+// currently contains a managed block
+func FindShellBlocks(home string) []ShellBlock {
+	blocks := []ShellBlock{}
+	seen := make(map[string]bool)
+
+	for _, name := range SupportedShells() {
+		// csh and tcsh may share .cshrc but use different markers
+		store, _ := NewShellStore(home, name)
+		key := store.Path() + "|" + store.dialect.Name()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		found, err := store.HasBlock()
+		if !found && err == nil {
+			continue
+		}
+
+		block := ShellBlock{Shell: name, Path: store.Path(), Err: err}
+		if err == nil {
+			var state profileState
+			state, block.Err = store.load()
+			block.Vars = state.vars
+			if state.storage == StorageFile {
+				block.EnvFile = store.envFile
+			}
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// BlocksAgree reports whether all blocks hold identical variables
+func BlocksAgree(blocks []ShellBlock) bool {
+	for _, block := range blocks {
+		if block.Err != nil || !reflect.DeepEqual(block.Vars, blocks[0].Vars) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// brokenStore refuses every write
+type brokenStore struct {
+	*MemoryStore
+}
+
+func (brokenStore) Set(key, value string) error { return errors.New("read-only") }
+
+func TestShellsStoreWritesEveryProfile(t *testing.T) {
+	home := t.TempDir()
+
+	store, err := ShellsStore(home, "zsh, bash,fish")
+	if err != nil {
+		t.Fatalf("ShellsStore failed: %v", err)
+	}
+	if len(store.Stores()) != 3 {
+		t.Fatalf("Expected 3 stores, got %d", len(store.Stores()))
+	}
+
+	if err := ApplyFoundryConfig(store, &FoundryConfig{Resource: "res", SonnetModel: "s", HaikuModel: "h", OpusModel: "o"}); err != nil {
+		t.Fatalf("ApplyFoundryConfig failed: %v", err)
+	}
+
+	blocks := FindShellBlocks(home)
+	if len(blocks) != 3 {
+		t.Fatalf("Expected 3 profiles with a block, got %+v", blocks)
+	}
+	if !BlocksAgree(blocks) {
+		t.Errorf("Profiles should agree: %+v", blocks)
+	}
+
+	// Drift one profile and check it is reported
+	zsh, _ := NewShellStore(home, "zsh")
+	if err := zsh.Set(EnvFoundryResource, "other"); err != nil {
+		t.Fatal(err)
+	}
+	if BlocksAgree(FindShellBlocks(home)) {
+		t.Error("Profiles should no longer agree")
+	}
+
+	if err := RollbackToDefault(store); err != nil {
+		t.Fatalf("RollbackToDefault failed: %v", err)
+	}
+	if blocks := FindShellBlocks(home); len(blocks) != 0 {
+		t.Errorf("Blocks left after rollback: %+v", blocks)
+	}
+}
+
+func TestShellsStoreRejectsUnknownShells(t *testing.T) {
+	if _, err := ShellsStore(t.TempDir(), "zsh,cmd"); err == nil {
+		t.Error("Expected an error for an unsupported shell")
+	}
+	if _, err := ShellsStore(t.TempDir(), " , "); err == nil {
+		t.Error("Expected an error when no shell is selected")
+	}
+}
+
+func TestShellsStoreAllDeduplicatesPaths(t *testing.T) {
+	home := t.TempDir()
+	if err := os.WriteFile(filepath.Join(home, ".cshrc"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := ShellsStore(home, "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+	for _, s := range store.Stores() {
+		path := s.(*ProfileStore).Path()
+		if seen[path] {
+			t.Errorf("%s is written twice", path)
+		}
+		seen[path] = true
+	}
+}
+
+func TestMultiStoreRestoresOnFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".zshrc")
+	original := "# my zshrc\n"
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewMultiStore(NewProfileStore(path, posixDialect{}), brokenStore{NewMemoryStore()})
+	if err := SetAllVars(store, map[string]string{EnvUseFoundry: "true"}); err == nil {
+		t.Fatal("Expected SetAllVars to fail")
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != original {
+		t.Errorf("First profile not restored: %q", data)
+	}
+}
+
+func TestDetectShellsIncludesCurrentShell(t *testing.T) {
+	t.Setenv("SHELL", "/usr/bin/xonsh")
+	home := t.TempDir()
+	if err := os.WriteFile(filepath.Join(home, ".zshrc"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	detected := map[string]bool{}
+	for _, name := range DetectShells(home) {
+		detected[name] = true
+	}
+	if !detected["xonsh"] || !detected["zsh"] {
+		t.Errorf("Expected xonsh and zsh to be detected, got %v", detected)
+	}
+}
@@ -0,0 +1,405 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	markerBegin = "# >>> Claude Foundry Manager - BEGIN >>>"
+	markerEnd   = "# <<< Claude Foundry Manager - END <<<"
+)
+
+// ProfileStore keeps variables in a managed block inside a shell profile file
+type ProfileStore struct {
+	path    string
+	dialect Dialect
+	// owned means the whole file belongs to the tool (e.g. a fish conf.d
+	// snippet) and is deleted once the block is removed
+	owned bool
+	// legacy lists files where older versions wrote the block; it is moved
+	// into path on the next write
+	legacy []string
+	// envFile is the managed env file sourced in file storage mode, and
+	// envPeers the other profiles that may source the same file
+	envFile  string
+	envPeers []string
+	// storage forces a storage mode on the next write; empty keeps the
+	// mode the profile is in
+	storage Storage
+}
+
+// NewProfileStore creates a store that manages the block in the given
+// profile file, writing statements in the given shell dialect
+func NewProfileStore(path string, dialect Dialect) *ProfileStore {
+	return &ProfileStore{path: path, dialect: dialect}
+}
+
+// NewDirStore creates a profile store rooted at home, picking the profile
+// file the same way the tool does for the real home directory ($SHELL based)
+func NewDirStore(home string) *ProfileStore {
+	return newShellStore(home, os.Getenv("SHELL"))
+}
+
+// Path returns the profile file managed by this store
+func (s *ProfileStore) Path() string {
+	return s.path
+}
+
+// Shell returns the name of the shell dialect the profile is written in
+func (s *ProfileStore) Shell() string {
+	return s.dialect.Name()
+}
+
+// Get reads a variable from the managed block of the profile
+func (s *ProfileStore) Get(key string) (string, error) {
+	vars, err := s.List()
+	if err != nil {
+		return "", err
+	}
+	return vars[key], nil
+}
+
+// Set writes a variable into the managed block of the profile
+func (s *ProfileStore) Set(key, value string) error {
+	_, err := s.ApplyBatch(map[string]string{key: value}, nil)
+	return err
+}
+
+// Delete removes a variable from the managed block of the profile
+func (s *ProfileStore) Delete(key string) error {
+	_, err := s.ApplyBatch(nil, []string{key})
+	return err
+}
+
+// ApplyBatch applies all sets and deletes with a single profile rewrite,
+// holding the profile lock for the whole read-modify-write cycle.
+// The returned undo function puts back the original file contents.
+func (s *ProfileStore) ApplyBatch(sets map[string]string, deletes []string) (func() error, error) {
+	for key, value := range sets {
+		if err := validateVar(s.dialect, key, value); err != nil {
+			return nil, err
+		}
+	}
+	if s.storage == StorageFile && s.envFile == "" {
+		return nil, fmt.Errorf("file storage is not available for %s", s.path)
+	}
+
+	var undo func() error
+	err := s.withLock(func() error {
+		state, err := s.load()
+		if err != nil {
+			return err
+		}
+		vars := state.vars
+
+		// Blocks left in legacy files are always migrated
+		changed := len(state.legacy) > 0
+		for _, key := range deletes {
+			if _, ok := vars[key]; ok {
+				delete(vars, key)
+				changed = true
+			}
+		}
+		for key, value := range sets {
+			if current, ok := vars[key]; !ok || current != value {
+				vars[key] = value
+				changed = true
+			}
+		}
+
+		storage := state.storage
+		if s.storage != "" {
+			storage = s.storage
+		}
+		if !changed && storage == state.storage {
+			undo = func() error { return nil }
+			return nil
+		}
+
+		originals, targets := s.plan(state, storage, vars)
+		for i, target := range targets {
+			if target.content == originals[i].content && target.existed == originals[i].existed {
+				continue
+			}
+			if err := target.restore(); err != nil {
+				// Each write is atomic, so only the files before i changed
+				return withUndo(fmt.Errorf("failed to write %s: %w", target.path, err), func() error {
+					return restoreAll(originals[:i])
+				})
+			}
+		}
+
+		undo = func() error {
+			return s.withLock(func() error {
+				return restoreAll(originals)
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return undo, nil
+}
+
+// plan returns the files to write for storing vars in the given mode, as
+// parallel lists of original and updated snapshots in write order
+func (s *ProfileStore) plan(state profileState, storage Storage, vars map[string]string) ([]fileSnapshot, []fileSnapshot) {
+	originals := []fileSnapshot{}
+	targets := []fileSnapshot{}
+	add := func(original, target fileSnapshot) {
+		originals = append(originals, original)
+		targets = append(targets, target)
+	}
+
+	profile := fileSnapshot{path: s.path, content: state.primary.content, existed: true}
+	if storage == StorageFile {
+		// The env file goes first so the profile never sources a missing file
+		add(state.env, fileSnapshot{path: s.envFile, content: s.renderEnvFile(vars), existed: true, mode: envFileMode})
+		if state.storage != StorageFile {
+			profile.content = state.text.withBlock(s.blockLines([]string{s.dialect.SourceLine(s.envFile)}))
+		}
+		add(state.primary, profile)
+	} else {
+		if len(vars) == 0 {
+			// If no variables left, remove the entire block
+			profile.content = state.text.withoutBlock()
+			if s.owned && strings.TrimSpace(profile.content) == "" {
+				profile.existed = false
+			}
+		} else {
+			profile.content = state.text.withBlock(s.blockLines(s.formatVars(vars)))
+		}
+		add(state.primary, profile)
+		if state.storage == StorageFile && !s.envFileShared() {
+			add(state.env, fileSnapshot{path: s.envFile})
+		}
+	}
+
+	for i, snap := range state.legacy {
+		add(snap, fileSnapshot{path: snap.path, content: state.legacyText[i].withoutBlock(), existed: true})
+	}
+	return originals, targets
+}
+
+// withLock runs fn holding the lock on the profile and, when it may be
+// involved, on the env file directory (always taken second)
+func (s *ProfileStore) withLock(fn func() error) error {
+	return withFileLock(s.path, func() error {
+		if s.envFile == "" {
+			return fn()
+		}
+		if _, err := os.Stat(filepath.Dir(s.envFile)); os.IsNotExist(err) && s.storage != StorageFile {
+			return fn()
+		}
+		if err := os.MkdirAll(filepath.Dir(s.envFile), 0700); err != nil {
+			return err
+		}
+		return withFileLock(s.envFile, fn)
+	})
+}
+
+// List returns all variables in the managed block
+func (s *ProfileStore) List() (map[string]string, error) {
+	state, err := s.load()
+	return state.vars, err
+}
+
+// HasBlock reports whether the profile (or a legacy file) contains a
+// managed block
+func (s *ProfileStore) HasBlock() (bool, error) {
+	state, err := s.load()
+	if err != nil {
+		return true, err
+	}
+	return state.text.found() || len(state.legacy) > 0, nil
+}
+
+// Commit does nothing for profiles - changes take effect in new shell sessions
+func (s *ProfileStore) Commit() error {
+	return nil
+}
+
+// profileState is everything load reads from disk
+type profileState struct {
+	primary fileSnapshot
+	text    *profileText
+	// legacy holds the legacy files that still contain a block
+	legacy     []fileSnapshot
+	legacyText []*profileText
+	// env is the managed env file, read even when not sourced so it can
+	// be restored
+	env     fileSnapshot
+	storage Storage
+	vars    map[string]string
+}
+
+// load reads the profile, any legacy files that still hold a block and
+// the env file, returning the merged variables (the profile wins over
+// legacy files)
+func (s *ProfileStore) load() (profileState, error) {
+	state := profileState{storage: StorageInline, vars: make(map[string]string)}
+
+	var err error
+	state.primary, err = readSnapshot(s.path)
+	if err != nil {
+		return profileState{}, err
+	}
+	if s.envFile != "" {
+		state.env, err = readSnapshot(s.envFile)
+		if err != nil {
+			return profileState{}, err
+		}
+		state.env.mode = envFileMode
+	}
+
+	for _, path := range s.legacy {
+		snap, err := readSnapshot(path)
+		if err != nil {
+			return profileState{}, err
+		}
+		text, old, err := s.parseBlock(snap)
+		if err != nil {
+			return profileState{}, err
+		}
+		if !text.found() {
+			continue
+		}
+		for key, value := range old {
+			state.vars[key] = value
+		}
+		state.legacy = append(state.legacy, snap)
+		state.legacyText = append(state.legacyText, text)
+	}
+
+	state.text, err = s.parseText(state.primary)
+	if err != nil {
+		return profileState{}, err
+	}
+
+	var current map[string]string
+	if s.sourcesEnvFile(state.text.body()) {
+		state.storage = StorageFile
+		current, err = s.dialect.ParseVars(state.env.content)
+		if err != nil {
+			return profileState{}, fmt.Errorf("failed to parse %s: %w", s.envFile, err)
+		}
+	} else {
+		current, err = s.blockVars(s.path, state.text)
+		if err != nil {
+			return profileState{}, err
+		}
+	}
+	for key, value := range current {
+		state.vars[key] = value
+	}
+
+	return state, nil
+}
+
+// fileSnapshot is the content of a file at one point in time
+type fileSnapshot struct {
+	path    string
+	content string
+	existed bool
+	mode    os.FileMode // for newly created files, 0644 if zero
+}
+
+// readSnapshot captures the current content of path
+func readSnapshot(path string) (fileSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fileSnapshot{path: path}, nil
+		}
+		return fileSnapshot{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return fileSnapshot{path: path, content: string(data), existed: true}, nil
+}
+
+// restore makes the file on disk match the snapshot
+func (f fileSnapshot) restore() error {
+	if !f.existed {
+		path, err := resolvePath(f.path)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	mode := f.mode
+	if mode == 0 {
+		mode = 0644
+	}
+	return writeFileAtomic(f.path, []byte(f.content), mode)
+}
+
+// restoreAll restores every snapshot, reporting all failures
+func restoreAll(snaps []fileSnapshot) error {
+	var errs []error
+	for _, snap := range snaps {
+		if err := snap.restore(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// parseBlock locates the managed block in file and reads its variables
+func (s *ProfileStore) parseBlock(file fileSnapshot) (*profileText, map[string]string, error) {
+	text, err := s.parseText(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	vars, err := s.blockVars(file.path, text)
+	if err != nil {
+		return nil, nil, err
+	}
+	return text, vars, nil
+}
+
+// blockVars reads the variables from the managed block of text
+func (s *ProfileStore) blockVars(path string, text *profileText) (map[string]string, error) {
+	if !text.found() {
+		return make(map[string]string), nil
+	}
+
+	vars, err := s.dialect.ParseVars(text.body())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse managed block in %s: %w", path, err)
+	}
+	return vars, nil
+}
+
+// formatVars returns the statements for vars, in sorted key order so output
+// is deterministic
+func (s *ProfileStore) formatVars(vars map[string]string) []string {
+	lines := make([]string, 0, len(vars))
+	for _, key := range sortedKeys(vars) {
+		lines = append(lines, s.dialect.FormatVar(key, vars[key]))
+	}
+	return lines
+}
+
+// blockHeader opens the managed block and the env file. Older versions
+// wrote "# Claude Code Azure Foundry Configuration" whatever the provider;
+// the header is a comment, so blocks with either one parse alike.
+var blockHeader = []string{
+	"# Claude Code Provider Configuration",
+	"# Managed by claude-foundry-manager - DO NOT EDIT MANUALLY",
+}
+
+// blockLines returns the managed block holding the given statements,
+// markers included
+func (s *ProfileStore) blockLines(body []string) []string {
+	begin, end := s.dialect.Markers()
+	lines := append([]string{begin}, blockHeader...)
+	lines = append(lines, body...)
+	return append(lines, end)
+}
@@ -0,0 +1,361 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Environment variables of the providers other than Azure Foundry
+const (
+	EnvUseBedrock     = "CLAUDE_CODE_USE_BEDROCK"
+	EnvAWSRegion      = "AWS_REGION"
+	EnvAWSProfile     = "AWS_PROFILE"
+	EnvBedrockToken   = "AWS_BEARER_TOKEN_BEDROCK"
+	EnvBedrockBaseURL = "ANTHROPIC_BEDROCK_BASE_URL"
+
+	EnvUseVertex        = "CLAUDE_CODE_USE_VERTEX"
+	EnvVertexRegion     = "CLOUD_ML_REGION"
+	EnvVertexProjectID  = "ANTHROPIC_VERTEX_PROJECT_ID"
+	EnvVertexBaseURL    = "ANTHROPIC_VERTEX_BASE_URL"
+	EnvGatewayBaseURL   = "ANTHROPIC_BASE_URL"
+	EnvGatewayAuthToken = "ANTHROPIC_AUTH_TOKEN"
+)
+
+// Provider names, as accepted by --provider
+const (
+	ProviderFoundry   = "foundry"
+	ProviderBedrock   = "bedrock"
+	ProviderVertex    = "vertex"
+	ProviderGateway   = "gateway"
+	ProviderAnthropic = "anthropic"
+)
+
+// Field is one setting of a provider and the variable it is stored in
+type Field struct {
+	Name     string // setting name, e.g. "region"; flags use dashes
+	Env      string
+	Required bool
+	Secret   bool // masked when displayed
+}
+
+// Provider is a backend Claude Code can talk to. Each provider owns a set
+// of variables; applying one removes the variables of all the others.
+type Provider interface {
+	// Name is the short name used on the command line
+	Name() string
+	// Title is the name shown to the user
+	Title() string
+	// Keys lists every variable the provider owns
+	Keys() []string
+	// Fields lists the settings the provider accepts
+	Fields() []Field
+	// Validate checks settings (keyed by field name) before they are applied
+	Validate(settings map[string]string) error
+	// Vars returns the variables to set for settings; empty ones are left out
+	Vars(settings map[string]string) map[string]string
+	// Active reports whether vars select this provider
+	Active(vars map[string]string) bool
+}
+
+// modelFields are the model overrides every provider accepts
+var modelFields = []Field{
+	{Name: "sonnet_model", Env: EnvDefaultSonnet},
+	{Name: "haiku_model", Env: EnvDefaultHaiku},
+	{Name: "opus_model", Env: EnvDefaultOpus},
+}
+
+// envProvider is a provider described by its switch variable and fields
+type envProvider struct {
+	name   string
+	title  string
+	toggle string // variable that enables the provider, "" if none
+	on     string // value written to toggle
+	fields []Field
+	check  func(settings map[string]string) error
+}
+
+// Name returns the short name of the provider
+func (p *envProvider) Name() string { return p.name }
+
+// Title returns the display name of the provider
+func (p *envProvider) Title() string { return p.title }
+
+// Fields returns the settings of the provider
+func (p *envProvider) Fields() []Field { return p.fields }
+
+// Keys returns the switch variable followed by the field variables
+func (p *envProvider) Keys() []string {
+	keys := []string{}
+	if p.toggle != "" {
+		keys = append(keys, p.toggle)
+	}
+	for _, f := range p.fields {
+		keys = append(keys, f.Env)
+	}
+	return keys
+}
+
+// Validate checks required fields, unknown settings and base URLs
+func (p *envProvider) Validate(settings map[string]string) error {
+	for name := range settings {
+		if p.field(name) == nil {
+			return fmt.Errorf("%s does not accept --%s", p.title, flagName(name))
+		}
+	}
+	for _, f := range p.fields {
+		value := settings[f.Name]
+		if f.Required && value == "" {
+			return fmt.Errorf("--%s is required for %s", flagName(f.Name), p.title)
+		}
+		if f.Name == "base_url" && value != "" {
+			if u, err := url.Parse(value); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return fmt.Errorf("invalid --base-url %q: expected an http(s) URL", value)
+			}
+		}
+	}
+	if p.check != nil {
+		return p.check(settings)
+	}
+	return nil
+}
+
+// Vars maps settings onto the provider variables
+func (p *envProvider) Vars(settings map[string]string) map[string]string {
+	vars := map[string]string{}
+	if p.toggle != "" {
+		vars[p.toggle] = p.on
+	}
+	for _, f := range p.fields {
+		if value := settings[f.Name]; value != "" {
+			vars[f.Env] = value
+		}
+	}
+	return vars
+}
+
+// Active reports whether the switch variable is on, or for a provider
+// without one, whether its required variables are set
+func (p *envProvider) Active(vars map[string]string) bool {
+	if p.toggle != "" {
+		return isTruthy(vars[p.toggle])
+	}
+	required := false
+	for _, f := range p.fields {
+		if f.Required {
+			required = true
+			if vars[f.Env] == "" {
+				return false
+			}
+		}
+	}
+	return required
+}
+
+// field returns the field with the given name, or nil
+func (p *envProvider) field(name string) *Field {
+	for i := range p.fields {
+		if p.fields[i].Name == name {
+			return &p.fields[i]
+		}
+	}
+	return nil
+}
+
+// Foundry is Azure AI Foundry. Either a resource name or a base URL is
+// required; without an API key Entra ID is used.
+var Foundry Provider = &envProvider{
+	name:   ProviderFoundry,
+	title:  "Azure Foundry",
+	toggle: EnvUseFoundry,
+	on:     "true",
+	fields: append([]Field{
+		{Name: "resource", Env: EnvFoundryResource},
+		{Name: "base_url", Env: EnvFoundryBaseURL},
+		{Name: "api_key", Env: EnvFoundryAPIKey, Secret: true},
+	}, modelFields...),
+	check: func(settings map[string]string) error {
+		if settings["resource"] == "" && settings["base_url"] == "" {
+			return fmt.Errorf("either --resource or --base-url is required")
+		}
+		if settings["resource"] != "" && settings["base_url"] != "" {
+			return fmt.Errorf("cannot specify both --resource and --base-url, choose one")
+		}
+		return nil
+	},
+}
+
+// Bedrock is Amazon Bedrock. Credentials come from the AWS profile or a
+// Bedrock API key.
+var Bedrock Provider = &envProvider{
+	name:   ProviderBedrock,
+	title:  "Amazon Bedrock",
+	toggle: EnvUseBedrock,
+	on:     "1",
+	fields: append([]Field{
+		{Name: "region", Env: EnvAWSRegion, Required: true},
+		{Name: "aws_profile", Env: EnvAWSProfile},
+		{Name: "api_key", Env: EnvBedrockToken, Secret: true},
+		{Name: "base_url", Env: EnvBedrockBaseURL},
+	}, modelFields...),
+}
+
+// Vertex is Google Vertex AI
+var Vertex Provider = &envProvider{
+	name:   ProviderVertex,
+	title:  "Google Vertex AI",
+	toggle: EnvUseVertex,
+	on:     "1",
+	fields: append([]Field{
+		{Name: "region", Env: EnvVertexRegion, Required: true},
+		{Name: "project_id", Env: EnvVertexProjectID, Required: true},
+		{Name: "base_url", Env: EnvVertexBaseURL},
+	}, modelFields...),
+}
+
+// Gateway is an LLM gateway or proxy speaking the Anthropic API
+var Gateway Provider = &envProvider{
+	name:  ProviderGateway,
+	title: "LLM gateway",
+	fields: append([]Field{
+		{Name: "base_url", Env: EnvGatewayBaseURL, Required: true},
+		{Name: "api_key", Env: EnvGatewayAuthToken, Secret: true},
+	}, modelFields...),
+}
+
+// Anthropic is the direct Anthropic API, Claude Code's default. It owns no
+// variables besides the model overrides.
+var Anthropic Provider = &envProvider{
+	name:   ProviderAnthropic,
+	title:  "Anthropic API (direct)",
+	fields: modelFields,
+}
+
+// Providers lists every provider. Anthropic comes last since it is what
+// remains when no other provider is active.
+var Providers = []Provider{Foundry, Bedrock, Vertex, Gateway, Anthropic}
+
+// allKeys lists every environment variable managed by this tool
+var allKeys = providerKeys(Providers)
+
+// Groups of variables, e.g. for restoring part of a backup
+const (
+	GroupModels   = "models"   // model overrides
+	GroupEndpoint = "endpoint" // provider switches, resources, URLs and regions
+	GroupAuth     = "auth"     // keys, tokens and credential profiles
+)
+
+// KeyGroups lists the groups of variables
+var KeyGroups = []string{GroupModels, GroupEndpoint, GroupAuth}
+
+// KeyGroup returns the group of a variable, or "" for extra variables
+// that belong to none
+func KeyGroup(key string) string {
+	switch {
+	case IsSecret(key) || key == EnvAWSProfile:
+		return GroupAuth
+	case strings.HasSuffix(key, "_MODEL"):
+		return GroupModels
+	case isProviderKey(key):
+		return GroupEndpoint
+	}
+	return ""
+}
+
+// providerSwitches are the variables that select a provider in Claude Code
+var providerSwitches = []string{EnvUseFoundry, EnvUseBedrock, EnvUseVertex, EnvGatewayBaseURL}
+
+// providerKeys returns the variables owned by providers, without duplicates
+func providerKeys(providers []Provider) []string {
+	seen := map[string]bool{}
+	keys := []string{}
+	for _, p := range providers {
+		for _, key := range p.Keys() {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// LookupProvider returns the provider with the given name
+func LookupProvider(name string) (Provider, error) {
+	for _, p := range Providers {
+		if p.Name() == strings.ToLower(strings.TrimSpace(name)) {
+			return p, nil
+		}
+	}
+	names := make([]string, len(Providers))
+	for i, p := range Providers {
+		names[i] = p.Name()
+	}
+	return nil, fmt.Errorf("unknown provider %q (use %s)", name, strings.Join(names, ", "))
+}
+
+// DetectProviders returns the providers vars enable. More than one means
+// the configuration is conflicting; none means the direct Anthropic API.
+func DetectProviders(vars map[string]string) []Provider {
+	active := []Provider{}
+	for _, p := range Providers {
+		if p != Anthropic && p.Active(vars) {
+			active = append(active, p)
+		}
+	}
+	return active
+}
+
+// DetectProvider returns the provider vars select, Anthropic if none
+func DetectProvider(vars map[string]string) Provider {
+	if active := DetectProviders(vars); len(active) > 0 {
+		return active[0]
+	}
+	return Anthropic
+}
+
+// ApplyProvider validates settings and writes the provider's variables to
+// the store, removing the variables of every other provider in the same
+// transaction
+func ApplyProvider(store EnvStore, p Provider, settings map[string]string) error {
+	if err := p.Validate(settings); err != nil {
+		return err
+	}
+	return applyVars(store, p.Vars(settings))
+}
+
+// applyVars sets vars and deletes every other managed variable
+func applyVars(store EnvStore, vars map[string]string) error {
+	tx := Begin(store)
+	for _, key := range allKeys {
+		if value, ok := vars[key]; ok {
+			tx.Set(key, value)
+		} else {
+			tx.Delete(key)
+		}
+	}
+	return tx.Commit()
+}
+
+// IsSecret reports whether key holds a credential that should be masked:
+// a secret provider field, or an extra variable named like one
+func IsSecret(key string) bool {
+	for _, p := range Providers {
+		for _, f := range p.Fields() {
+			if f.Env == key {
+				return f.Secret
+			}
+		}
+	}
+	for _, suffix := range []string{"_KEY", "_TOKEN", "_SECRET", "_PASSWORD"} {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// flagName turns a field name into its flag name
+func flagName(name string) string {
+	return strings.ReplaceAll(name, "_", "-")
+}
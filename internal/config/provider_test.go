@@ -0,0 +1,123 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSwitchingProvidersClearsPreviousVars(t *testing.T) {
+	store := NewMemoryStore()
+	if err := ApplyFoundryConfig(store, &FoundryConfig{Resource: "res", APIKey: "key", SonnetModel: "s"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ApplyProvider(store, Bedrock, map[string]string{"region": "us-east-1", "aws_profile": "dev"}); err != nil {
+		t.Fatalf("ApplyProvider failed: %v", err)
+	}
+	vars, _ := store.List()
+	expected := map[string]string{EnvUseBedrock: "1", EnvAWSRegion: "us-east-1", EnvAWSProfile: "dev"}
+	if len(vars) != len(expected) {
+		t.Errorf("Expected %v, got %v", expected, vars)
+	}
+	for key, value := range expected {
+		if vars[key] != value {
+			t.Errorf("Expected %s=%q, got %q", key, value, vars[key])
+		}
+	}
+	if DetectProvider(vars) != Bedrock {
+		t.Errorf("Expected Bedrock to be detected, got %s", DetectProvider(vars).Name())
+	}
+
+	if err := ApplyProvider(store, Gateway, map[string]string{"base_url": "https://llm.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	vars, _ = store.List()
+	if len(vars) != 1 || DetectProvider(vars) != Gateway {
+		t.Errorf("Expected only the gateway variable, got %v", vars)
+	}
+
+	if err := RollbackToDefault(store); err != nil {
+		t.Fatal(err)
+	}
+	vars, _ = store.List()
+	if len(vars) != 0 || DetectProvider(vars) != Anthropic {
+		t.Errorf("Expected rollback to remove every provider, got %v", vars)
+	}
+}
+
+func TestProviderValidate(t *testing.T) {
+	tests := []struct {
+		provider Provider
+		settings map[string]string
+		err      string
+	}{
+		{Foundry, map[string]string{"resource": "r"}, ""},
+		{Foundry, map[string]string{}, "either --resource or --base-url"},
+		{Foundry, map[string]string{"resource": "r", "region": "x"}, "does not accept --region"},
+		{Bedrock, map[string]string{"aws_profile": "dev"}, "--region is required"},
+		{Vertex, map[string]string{"region": "us-east5"}, "--project-id is required"},
+		{Vertex, map[string]string{"region": "us-east5", "project_id": "p"}, ""},
+		{Gateway, map[string]string{"base_url": "llm.example.com"}, "invalid --base-url"},
+		{Anthropic, map[string]string{"opus_model": "o"}, ""},
+	}
+
+	for _, tt := range tests {
+		err := tt.provider.Validate(tt.settings)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s %v: expected no error, got %v", tt.provider.Name(), tt.settings, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s %v: expected an error containing %q, got %v", tt.provider.Name(), tt.settings, tt.err, err)
+		}
+	}
+}
+
+func TestDetectConflictingProviders(t *testing.T) {
+	vars := map[string]string{EnvUseFoundry: "true", EnvUseVertex: "1", EnvGatewayBaseURL: "https://x"}
+	active := DetectProviders(vars)
+	if len(active) != 3 || active[0] != Foundry || active[1] != Vertex || active[2] != Gateway {
+		t.Errorf("Expected Foundry, Vertex and the gateway, got %d providers", len(active))
+	}
+
+	store := NewMemoryStore()
+	if err := SetAllVars(store, vars); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := GetCurrentConfig(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Provider != Foundry || len(cfg.Conflicts) != 2 {
+		t.Errorf("Expected Foundry with two conflicts, got %s and %d", cfg.Provider.Name(), len(cfg.Conflicts))
+	}
+}
+
+func TestIsSecret(t *testing.T) {
+	for _, key := range []string{EnvFoundryAPIKey, EnvBedrockToken, EnvGatewayAuthToken} {
+		if !IsSecret(key) {
+			t.Errorf("Expected %s to be secret", key)
+		}
+	}
+	if IsSecret(EnvAWSRegion) {
+		t.Errorf("Expected %s not to be secret", EnvAWSRegion)
+	}
+}
+
+func TestKeyGroup(t *testing.T) {
+	cases := map[string]string{
+		EnvFoundryAPIKey:             GroupAuth,
+		EnvGatewayAuthToken:          GroupAuth,
+		EnvAWSProfile:                GroupAuth,
+		EnvDefaultSonnet:             GroupModels,
+		"ANTHROPIC_SMALL_FAST_MODEL": GroupModels,
+		EnvUseFoundry:                GroupEndpoint,
+		EnvFoundryResource:           GroupEndpoint,
+		EnvVertexRegion:              GroupEndpoint,
+		"HTTPS_PROXY":                "",
+	}
+	for key, group := range cases {
+		if got := KeyGroup(key); got != group {
+			t.Errorf("Expected %s in group %q, got %q", key, group, got)
+		}
+	}
+}
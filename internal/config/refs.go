@@ -0,0 +1,112 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// When a variable is set from a secret reference (--api-key=env:KEY,
+// file:..., cmd:...), the reference is remembered with a digest of the
+// value it resolved to. Backups then keep the reference instead of the
+// value, as long as the store still holds that value.
+
+// refsName is the file in ConfigDir that holds the secret references
+const refsName = "secret-refs.json"
+
+// SecretRef is the reference a variable was resolved from
+type SecretRef struct {
+	Ref    string `json:"ref"`
+	Digest string `json:"sha256"` // of the resolved value
+}
+
+// SecretRefs returns the recorded references, keyed by variable
+func SecretRefs() (map[string]SecretRef, error) {
+	path, err := refsPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]SecretRef{}, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	refs := map[string]SecretRef{}
+	if err := json.Unmarshal(data, &refs); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return refs, nil
+}
+
+// RecordSecretRef remembers that key was set to value from ref. An empty
+// ref forgets key, for when it was set to a plain value.
+func RecordSecretRef(key, ref, value string) error {
+	refs, err := SecretRefs()
+	if err != nil {
+		return err
+	}
+	if ref == "" {
+		if _, ok := refs[key]; !ok {
+			return nil
+		}
+		delete(refs, key)
+	} else {
+		refs[key] = SecretRef{Ref: ref, Digest: digest(value)}
+	}
+	return saveSecretRefs(refs)
+}
+
+// SecretRefFor returns the reference key was resolved from, or "" when it
+// was not or the store no longer holds the value it resolved to
+func SecretRefFor(refs map[string]SecretRef, key, value string) string {
+	ref, ok := refs[key]
+	if !ok || value == "" || ref.Digest != digest(value) {
+		return ""
+	}
+	return ref.Ref
+}
+
+// saveSecretRefs writes the references, removing the file when there are
+// none
+func saveSecretRefs(refs map[string]SecretRef) error {
+	path, err := refsPath()
+	if err != nil {
+		return err
+	}
+	if len(refs) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(refs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal secret references: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0600)
+}
+
+// refsPath returns the location of the references file
+func refsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(ConfigDir(home), refsName), nil
+}
+
+// digest returns the hex SHA-256 of value
+func digest(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,29 @@
+package config
+
+import "testing"
+
+func TestSecretRefFollowsValue(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("USERPROFILE", t.TempDir())
+
+	if err := RecordSecretRef(EnvFoundryAPIKey, "keyvault:vault/key", "sk-1"); err != nil {
+		t.Fatalf("RecordSecretRef failed: %v", err)
+	}
+	refs, err := SecretRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref := SecretRefFor(refs, EnvFoundryAPIKey, "sk-1"); ref != "keyvault:vault/key" {
+		t.Errorf("Expected the reference for the value it resolved to, got %q", ref)
+	}
+	if ref := SecretRefFor(refs, EnvFoundryAPIKey, "sk-2"); ref != "" {
+		t.Errorf("Expected no reference once the value changed, got %q", ref)
+	}
+
+	if err := RecordSecretRef(EnvFoundryAPIKey, "", "sk-2"); err != nil {
+		t.Fatal(err)
+	}
+	if refs, _ := SecretRefs(); len(refs) != 0 {
+		t.Errorf("Expected the reference to be forgotten, got %v", refs)
+	}
+}
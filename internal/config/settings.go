@@ -0,0 +1,464 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Claude Code also reads variables from the "env" object of its
+// settings.json files, which works for IDEs launched outside a terminal and
+// needs no new shell. SettingsStore edits that object and leaves every
+// other setting (permissions, hooks, ...) and the key order alone.
+
+// SettingsScope selects one of the Claude Code settings files
+type SettingsScope string
+
+const (
+	SettingsUser    SettingsScope = "user"    // ~/.claude/settings.json
+	SettingsProject SettingsScope = "project" // .claude/settings.json, shared with the team
+	SettingsLocal   SettingsScope = "local"   // .claude/settings.local.json, not committed
+)
+
+// SettingsScopes lists every scope, from lowest to highest precedence
+var SettingsScopes = []SettingsScope{SettingsUser, SettingsProject, SettingsLocal}
+
+// ParseSettingsScope parses a --settings value
+func ParseSettingsScope(value string) (SettingsScope, error) {
+	for _, scope := range SettingsScopes {
+		if string(scope) == strings.ToLower(strings.TrimSpace(value)) {
+			return scope, nil
+		}
+	}
+	return "", fmt.Errorf("unknown settings scope %q (use user, project or local)", value)
+}
+
+// SettingsPath returns the settings file of scope. projectDir is only used
+// for the project and local scopes.
+func SettingsPath(scope SettingsScope, home, projectDir string) string {
+	switch scope {
+	case SettingsProject:
+		return filepath.Join(projectDir, ".claude", "settings.json")
+	case SettingsLocal:
+		return filepath.Join(projectDir, ".claude", "settings.local.json")
+	}
+	return filepath.Join(home, ".claude", "settings.json")
+}
+
+// ProjectRoot returns the top of the git repository containing dir, or dir
+// itself outside a repository
+func ProjectRoot(dir string) string {
+	for current := dir; ; {
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir
+		}
+		current = parent
+	}
+}
+
+// SettingsFiles returns the settings file of every scope
+func SettingsFiles(home, projectDir string) []string {
+	files := make([]string, len(SettingsScopes))
+	for i, scope := range SettingsScopes {
+		files[i] = SettingsPath(scope, home, projectDir)
+	}
+	return files
+}
+
+// SettingsStore implements EnvStore on the "env" object of a Claude Code
+// settings file. Only managed variables are listed; entries the user added
+// to "env" themselves are kept as they are.
+type SettingsStore struct {
+	path string
+}
+
+// NewSettingsStore returns a store for the settings file at path
+func NewSettingsStore(path string) *SettingsStore {
+	return &SettingsStore{path: path}
+}
+
+// Path returns the settings file of the store
+func (s *SettingsStore) Path() string {
+	return s.path
+}
+
+// Get returns a variable from the "env" object
+func (s *SettingsStore) Get(key string) (string, error) {
+	vars, err := s.List()
+	if err != nil {
+		return "", err
+	}
+	return vars[key], nil
+}
+
+// Set writes a variable into the "env" object
+func (s *SettingsStore) Set(key, value string) error {
+	_, err := s.ApplyBatch(map[string]string{key: value}, nil)
+	return err
+}
+
+// Delete removes a variable from the "env" object
+func (s *SettingsStore) Delete(key string) error {
+	_, err := s.ApplyBatch(nil, []string{key})
+	return err
+}
+
+// List returns the managed variables of the "env" object
+func (s *SettingsStore) List() (map[string]string, error) {
+	doc, _, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	managed := ManagedKeys()
+	vars := map[string]string{}
+	for key, value := range doc.env() {
+		if containsKey(managed, key) {
+			vars[key] = value
+		}
+	}
+	return vars, nil
+}
+
+// Commit does nothing - Claude Code reads the file when it starts
+func (s *SettingsStore) Commit() error {
+	return nil
+}
+
+// ApplyBatch applies all sets and deletes with a single rewrite of the
+// settings file, holding its lock for the whole read-modify-write cycle.
+// The returned undo function puts back the original content.
+func (s *SettingsStore) ApplyBatch(sets map[string]string, deletes []string) (func() error, error) {
+	return s.update(func(doc *jsonObject) (bool, error) {
+		env, err := doc.envObject()
+		if err != nil {
+			return false, err
+		}
+		changed := false
+		for _, key := range deletes {
+			changed = env.remove(key) || changed
+		}
+		for _, key := range sortedKeys(sets) {
+			changed = env.set(key, jsonString(sets[key])) || changed
+		}
+
+		if len(env.keys) == 0 {
+			doc.remove("env")
+		} else {
+			doc.set("env", env.encode())
+		}
+		return changed, nil
+	})
+}
+
+// Setting returns a top-level string setting such as apiKeyHelper, or ""
+func (s *SettingsStore) Setting(name string) (string, error) {
+	doc, _, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	var value string
+	if raw, ok := doc.values[name]; ok {
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return "", fmt.Errorf("%s in %s is not a string", name, s.path)
+		}
+	}
+	return value, nil
+}
+
+// SetSetting sets a top-level string setting, or removes it when value is
+// empty
+func (s *SettingsStore) SetSetting(name, value string) error {
+	_, err := s.update(func(doc *jsonObject) (bool, error) {
+		if value == "" {
+			return doc.remove(name), nil
+		}
+		return doc.set(name, jsonString(value)), nil
+	})
+	return err
+}
+
+// update runs change on the parsed settings file under its lock and
+// writes the result if change reports a modification
+func (s *SettingsStore) update(change func(doc *jsonObject) (bool, error)) (func() error, error) {
+	undo := func() error { return nil }
+	err := withFileLock(s.path, func() error {
+		doc, snap, err := s.load()
+		if err != nil {
+			return err
+		}
+
+		changed, err := change(doc)
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", s.path, err)
+		}
+		if !changed || (!snap.existed && len(doc.keys) == 0) {
+			return nil
+		}
+
+		// The env may hold an API key, so new files are private
+		if err := writeFileAtomic(s.path, doc.render(snap.content), 0600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", s.path, err)
+		}
+		undo = snap.restore
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return undo, nil
+}
+
+// Sources returns the line of each managed variable in the settings file
+func (s *SettingsStore) Sources() (map[string]Source, error) {
+	vars, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	snap, err := readSnapshot(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := map[string]Source{}
+	inEnv := false
+	for i, line := range strings.Split(snap.content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, `"env"`) {
+			inEnv = true
+			continue
+		}
+		if !inEnv {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "}") {
+			break // the values are strings, so the first brace closes "env"
+		}
+		for key := range vars {
+			if strings.HasPrefix(trimmed, `"`+key+`"`) {
+				sources[key] = Source{Path: s.path, Line: i + 1}
+			}
+		}
+	}
+	return sources, nil
+}
+
+// readsShell reports that Claude Code reads these variables itself, so the
+// shell never has them
+func (s *SettingsStore) readsShell() bool {
+	return false
+}
+
+// jsonString encodes value as a JSON string without escaping <, > and &
+func jsonString(value string) json.RawMessage {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(value) // strings always encode
+	return bytes.TrimRight(b.Bytes(), "\n")
+}
+
+// load reads and parses the settings file
+func (s *SettingsStore) load() (*jsonObject, fileSnapshot, error) {
+	snap, err := readSnapshot(s.path)
+	if err != nil {
+		return nil, fileSnapshot{}, err
+	}
+	if strings.TrimSpace(strings.TrimPrefix(snap.content, utf8BOM)) == "" {
+		return &jsonObject{values: map[string]json.RawMessage{}}, snap, nil
+	}
+
+	doc, err := parseJSONObject([]byte(strings.TrimPrefix(snap.content, utf8BOM)))
+	if err != nil {
+		return nil, fileSnapshot{}, fmt.Errorf("failed to parse %s: %w (fix the file or move it aside)", s.path, err)
+	}
+	return doc, snap, nil
+}
+
+// jsonObject is a JSON object that remembers the order of its keys
+type jsonObject struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+// parseJSONObject parses data, which must hold a single JSON object
+func parseJSONObject(data []byte) (*jsonObject, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+
+	obj := &jsonObject{values: map[string]json.RawMessage{}}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := tok.(string) // object keys are always strings
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		obj.set(key, value)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err == nil {
+		return nil, fmt.Errorf("unexpected data after the JSON object")
+	}
+	return obj, nil
+}
+
+// set stores value under key, keeping the position of an existing key.
+// It reports whether anything changed.
+func (o *jsonObject) set(key string, value json.RawMessage) bool {
+	old, ok := o.values[key]
+	if !ok {
+		o.keys = append(o.keys, key)
+	} else if bytes.Equal(old, value) {
+		return false
+	}
+	o.values[key] = value
+	return true
+}
+
+// remove deletes key and reports whether it was present
+func (o *jsonObject) remove(key string) bool {
+	if _, ok := o.values[key]; !ok {
+		return false
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// envObject returns the "env" object, empty if missing
+func (o *jsonObject) envObject() (*jsonObject, error) {
+	raw, ok := o.values["env"]
+	if !ok {
+		return &jsonObject{values: map[string]json.RawMessage{}}, nil
+	}
+	env, err := parseJSONObject(raw)
+	if err != nil {
+		return nil, fmt.Errorf(`"env" is not an object`)
+	}
+	return env, nil
+}
+
+// env returns the string entries of the "env" object
+func (o *jsonObject) env() map[string]string {
+	vars := map[string]string{}
+	env, err := o.envObject()
+	if err != nil {
+		return vars
+	}
+	for _, key := range env.keys {
+		var value string
+		if json.Unmarshal(env.values[key], &value) == nil {
+			vars[key] = value
+		}
+	}
+	return vars
+}
+
+// encode returns the object as compact JSON
+func (o *jsonObject) encode() json.RawMessage {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(o.values[key])
+	}
+	b.WriteByte('}')
+	return b.Bytes()
+}
+
+// render formats the object like original: same indentation, line endings
+// and BOM, two spaces and "\n" for a new file
+func (o *jsonObject) render(original string) []byte {
+	indent := "  "
+	for _, line := range strings.Split(original, "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed != "" && len(trimmed) < len(line) {
+			indent = line[:len(line)-len(trimmed)]
+			break
+		}
+	}
+
+	var compact, out bytes.Buffer
+	if err := json.Compact(&compact, o.encode()); err != nil {
+		compact.Reset()
+		compact.Write(o.encode())
+	}
+	if err := json.Indent(&out, compact.Bytes(), "", indent); err != nil {
+		out.Reset()
+		out.Write(compact.Bytes())
+	}
+
+	text := out.String() + "\n"
+	if strings.Contains(original, "\r\n") {
+		text = strings.ReplaceAll(text, "\n", "\r\n")
+	}
+	if strings.HasPrefix(original, utf8BOM) {
+		text = utf8BOM + text
+	}
+	return []byte(text)
+}
+
+// GitignoreCovers reports whether the .gitignore at the top of projectDir
+// has a line ignoring entry (a path relative to projectDir)
+func GitignoreCovers(projectDir, entry string) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(projectDir, ".gitignore"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	entry = filepath.ToSlash(entry)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == entry || line == "/"+entry || line == filepath.Base(entry) || line == "**/"+filepath.Base(entry) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// AddToGitignore appends entry to the .gitignore at the top of projectDir
+func AddToGitignore(projectDir, entry string) error {
+	path := filepath.Join(projectDir, ".gitignore")
+	snap, err := readSnapshot(path)
+	if err != nil {
+		return err
+	}
+
+	content := snap.content
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += filepath.ToSlash(entry) + "\n"
+	return writeFileAtomic(path, []byte(content), 0644)
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSettingsStoreKeepsOtherSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".claude", "settings.json")
+	original := "{\n\t\"permissions\": {\"allow\": [\"Bash(ls:*)\"]},\n\t\"env\": {\"MY_OWN\": \"x\"},\n\t\"hooks\": {}\n}\n"
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewSettingsStore(path)
+	if err := ApplyFoundryConfig(store, &FoundryConfig{Resource: "res", SonnetModel: "a<b"}); err != nil {
+		t.Fatalf("ApplyFoundryConfig failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	got := string(data)
+	permissions := strings.Index(got, `"permissions"`)
+	env := strings.Index(got, `"env"`)
+	hooks := strings.Index(got, `"hooks"`)
+	if permissions < 0 || env < permissions || hooks < env {
+		t.Errorf("Expected the key order to be kept, got:\n%s", got)
+	}
+	if !strings.Contains(got, "\t\"permissions\"") || !strings.Contains(got, `"MY_OWN": "x"`) || !strings.Contains(got, `"a<b"`) {
+		t.Errorf("Expected tab indentation, the user's variable and an unescaped value, got:\n%s", got)
+	}
+
+	vars, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars[EnvFoundryResource] != "res" || vars[EnvUseFoundry] != "true" {
+		t.Errorf("Unexpected variables: %v", vars)
+	}
+	if _, ok := vars["MY_OWN"]; ok {
+		t.Error("Expected unmanaged env entries to be left out of List")
+	}
+
+	sources, err := store.Sources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sources[EnvFoundryResource].Line == 0 {
+		t.Errorf("Expected a line for %s, got %v", EnvFoundryResource, sources)
+	}
+
+	if err := RollbackToDefault(store); err != nil {
+		t.Fatalf("RollbackToDefault failed: %v", err)
+	}
+	data, _ = os.ReadFile(path)
+	if got := string(data); !strings.Contains(got, `"MY_OWN": "x"`) || strings.Contains(got, EnvUseFoundry) {
+		t.Errorf("Expected only the managed variables to be removed, got:\n%s", got)
+	}
+}
+
+func TestSettingsStoreNewFileAndErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".claude", "settings.local.json")
+	store := NewSettingsStore(path)
+
+	if err := RollbackToDefault(store); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected no file to be created when there is nothing to write")
+	}
+
+	if err := store.Set(EnvDefaultOpus, "opus"); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if got := string(data); got != "{\n  \"env\": {\n    \"ANTHROPIC_DEFAULT_OPUS_MODEL\": \"opus\"\n  }\n}\n" {
+		t.Errorf("Unexpected new file:\n%s", got)
+	}
+	if info, err := os.Stat(path); err == nil && runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Expected a new settings file to have mode 0600, got %o", info.Mode().Perm())
+	}
+
+	if err := os.WriteFile(path, []byte(`{"env": "oops"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set(EnvDefaultOpus, "x"); err == nil {
+		t.Error("Expected an error when env is not an object")
+	}
+	if err := os.WriteFile(path, []byte(`{"env": {`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set(EnvDefaultOpus, "x"); err == nil {
+		t.Error("Expected an error for invalid JSON")
+	}
+}
+
+func TestSettingsStatusHasNoShellDrift(t *testing.T) {
+	t.Setenv(EnvFoundryResource, "")
+	os.Unsetenv(EnvFoundryResource)
+
+	store := NewSettingsStore(filepath.Join(t.TempDir(), "settings.json"))
+	if err := ApplyFoundryConfig(store, &FoundryConfig{Resource: "res"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := GetCurrentConfig(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range cfg.Vars {
+		if v.Key == EnvFoundryResource && v.Drift() != "" {
+			t.Errorf("Expected no drift for a settings file, got %q", v.Drift())
+		}
+	}
+}
+
+func TestGitignore(t *testing.T) {
+	dir := t.TempDir()
+	entry := filepath.Join(".claude", "settings.local.json")
+
+	if covered, _ := GitignoreCovers(dir, entry); covered {
+		t.Error("Expected a missing .gitignore not to cover the file")
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("node_modules"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddToGitignore(dir, entry); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if string(data) != "node_modules\n.claude/settings.local.json\n" {
+		t.Errorf("Unexpected .gitignore: %q", data)
+	}
+	if covered, _ := GitignoreCovers(dir, entry); !covered {
+		t.Error("Expected the file to be covered after adding it")
+	}
+}
+
+func TestSettingsStoreTopLevelSetting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	if err := os.WriteFile(path, []byte("{\n  \"env\": {\"MY_OWN\": \"x\"},\n  \"model\": 3\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store := NewSettingsStore(path)
+
+	if err := store.SetSetting("apiKeyHelper", "helper get"); err != nil {
+		t.Fatalf("SetSetting failed: %v", err)
+	}
+	if value, err := store.Setting("apiKeyHelper"); err != nil || value != "helper get" {
+		t.Errorf("Expected the setting back, got %q, %v", value, err)
+	}
+	if _, err := store.Setting("model"); err == nil {
+		t.Error("Expected an error for a setting that is not a string")
+	}
+
+	if err := store.SetSetting("apiKeyHelper", ""); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if got := string(data); strings.Contains(got, "apiKeyHelper") || !strings.Contains(got, `"MY_OWN": "x"`) {
+		t.Errorf("Expected only apiKeyHelper to be removed, got:\n%s", got)
+	}
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// shellSpec describes where a shell reads its startup configuration from
+type shellSpec struct {
+	dialect Dialect
+	// profile returns the file holding the managed block under home
+	profile func(home string) string
+	// owned and legacy are copied to the ProfileStore (see there)
+	owned  bool
+	legacy func(home string) []string
+}
+
+// shells maps shell names (as accepted by --shell) to their specs
+var shells = map[string]shellSpec{
+	"sh": {
+		dialect: posixDialect{},
+		profile: func(home string) string { return filepath.Join(home, ".profile") },
+	},
+	"bash": {
+		dialect: posixDialect{},
+		profile: func(home string) string {
+			// Check if .bash_profile exists (macOS prefers this)
+			return firstExisting(filepath.Join(home, ".bash_profile"), filepath.Join(home, ".bashrc"))
+		},
+	},
+	"zsh": {
+		dialect: posixDialect{},
+		profile: func(home string) string { return filepath.Join(home, ".zshrc") },
+	},
+	"fish": {
+		// fish sources every file in conf.d, so the tool gets a file of its
+		// own and never touches config.fish (older versions wrote there)
+		dialect: fishDialect{},
+		profile: func(home string) string {
+			return filepath.Join(home, ".config", "fish", "conf.d", "claude-foundry.fish")
+		},
+		owned: true,
+		legacy: func(home string) []string {
+			return []string{filepath.Join(home, ".config", "fish", "config.fish")}
+		},
+	},
+	"csh": {
+		dialect: cshDialect{name: "csh"},
+		profile: func(home string) string { return filepath.Join(home, ".cshrc") },
+	},
+	"tcsh": {
+		// tcsh reads ~/.tcshrc, falling back to ~/.cshrc when it is missing
+		dialect: cshDialect{name: "tcsh"},
+		profile: func(home string) string {
+			tcshrc := filepath.Join(home, ".tcshrc")
+			if _, err := os.Stat(filepath.Join(home, ".cshrc")); err == nil {
+				return firstExisting(tcshrc, filepath.Join(home, ".cshrc"))
+			}
+			return tcshrc
+		},
+	},
+	"nu": {
+		dialect: nuDialect{},
+		profile: func(home string) string { return filepath.Join(nuConfigDir(home), "env.nu") },
+	},
+	"xonsh": {
+		dialect: xonshDialect{},
+		profile: func(home string) string { return filepath.Join(home, ".xonshrc") },
+	},
+	"pwsh": {
+		dialect: pwshDialect{},
+		profile: func(home string) string {
+			if runtime.GOOS == "windows" {
+				return filepath.Join(home, "Documents", "PowerShell", "Microsoft.PowerShell_profile.ps1")
+			}
+			return filepath.Join(home, ".config", "powershell", "Microsoft.PowerShell_profile.ps1")
+		},
+	},
+}
+
+// shellAliases maps other spellings to the names in shells
+var shellAliases = map[string]string{
+	"dash":       "sh",
+	"ksh":        "sh",
+	"mksh":       "sh",
+	"ash":        "sh",
+	"nushell":    "nu",
+	"powershell": "pwsh",
+}
+
+// SupportedShells returns the shell names accepted by NewShellStore
+func SupportedShells() []string {
+	names := make([]string, 0, len(shells))
+	for name := range shells {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewShellStore creates the profile store for the named shell under home.
+// The name may also be a path such as /usr/bin/zsh.
+func NewShellStore(home, shell string) (*ProfileStore, error) {
+	name := normalizeShell(shell)
+	spec, ok := shells[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported shell %q (supported: %s)", shell, strings.Join(SupportedShells(), ", "))
+	}
+
+	store := NewProfileStore(spec.profile(home), spec.dialect)
+	store.owned = spec.owned
+	if spec.legacy != nil {
+		store.legacy = spec.legacy(home)
+	}
+
+	store.envFile = envFilePath(home, spec.dialect)
+	for other, otherSpec := range shells {
+		if other != name && envFilePath(home, otherSpec.dialect) == store.envFile {
+			store.envPeers = append(store.envPeers, otherSpec.profile(home))
+		}
+	}
+	return store, nil
+}
+
+// newShellStore is NewShellStore falling back to ~/.profile (POSIX
+// standard) for shells the tool does not know
+func newShellStore(home, shell string) *ProfileStore {
+	store, err := NewShellStore(home, shell)
+	if err != nil {
+		store, _ = NewShellStore(home, "sh")
+	}
+	return store
+}
+
+// normalizeShell turns a shell path or process name into a key of shells
+func normalizeShell(shell string) string {
+	name := strings.ToLower(filepath.Base(strings.TrimSpace(shell)))
+	name = strings.TrimPrefix(name, "-") // login shells show up as -zsh
+	name = strings.TrimSuffix(name, ".exe")
+
+	if alias, ok := shellAliases[name]; ok {
+		return alias
+	}
+	if _, ok := shells[name]; ok {
+		return name
+	}
+
+	// Versioned binaries such as bash5 or zsh-5.9
+	for _, known := range []string{"bash", "zsh", "fish", "tcsh", "xonsh", "pwsh"} {
+		if strings.HasPrefix(name, known) {
+			return known
+		}
+	}
+	return name
+}
+
+// nuConfigDir returns nushell's configuration directory under home
+func nuConfigDir(home string) string {
+	if runtime.GOOS == "darwin" {
+		return filepath.Join(home, "Library", "Application Support", "nushell")
+	}
+	return filepath.Join(home, ".config", "nushell")
+}
+
+// firstExisting returns the first path that exists, or the last one
+func firstExisting(paths ...string) string {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return paths[len(paths)-1]
+}
+
+// QuotedForms returns value as each shell dialect and the settings files
+// write it, quotes included, keyed by dialect name (see Dialect.Name) or
+// "json"
+func QuotedForms(value string) map[string]string {
+	forms := map[string]string{"json": string(jsonString(value))}
+	for _, spec := range shells {
+		var quoted string
+		switch spec.dialect.(type) {
+		case posixDialect:
+			quoted = posixQuote(value)
+		case cshDialect:
+			quoted = cshQuote(value)
+		case fishDialect:
+			quoted = fishQuote(value)
+		case nuDialect:
+			quoted = nuQuote(value)
+		case pwshDialect:
+			quoted = pwshQuote(value)
+		case xonshDialect:
+			quoted = pythonQuote(value)
+		default:
+			continue
+		}
+		forms[spec.dialect.Name()] = quoted
+	}
+	return forms
+}
@@ -0,0 +1,211 @@
+package config
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// allDialects lists every dialect with the shell used to check it for real
+var allDialects = []struct {
+	dialect Dialect
+	binary  string
+	args    func(script string) []string
+}{
+	{posixDialect{}, "sh", func(s string) []string { return []string{"-c", `. "$1" && printf '%s' "$KEY"`, "sh", s} }},
+	{fishDialect{}, "fish", func(s string) []string {
+		return []string{"--no-config", "-c", "source $argv[1]; printf '%s' \"$KEY\"", s}
+	}},
+	{cshDialect{name: "tcsh"}, "tcsh", func(s string) []string {
+		return []string{"-f", "-c", "source " + s + "; printenv KEY | head -c -1"}
+	}},
+	{nuDialect{}, "nu", func(s string) []string {
+		return []string{"--no-config-file", "-c", "source " + s + "; print -n $env.KEY"}
+	}},
+	{xonshDialect{}, "xonsh", func(s string) []string {
+		return []string{"--no-rc", "-c", "source " + s + "; print($KEY, end='')"}
+	}},
+	{pwshDialect{}, "pwsh", func(s string) []string {
+		return []string{"-NoProfile", "-Command", ". '" + s + "'; [Console]::Out.Write($env:KEY)"}
+	}},
+}
+
+// representable reports whether value can be written in dialect at all
+func representable(d Dialect, value string) bool {
+	return validateVar(d, "KEY", value) == nil
+}
+
+func TestAllDialectsRoundTrip(t *testing.T) {
+	for _, tt := range allDialects {
+		t.Run(tt.dialect.Name(), func(t *testing.T) {
+			begin, end := tt.dialect.Markers()
+			for _, value := range trickyValues {
+				if !representable(tt.dialect, value) {
+					continue
+				}
+				formatted := tt.dialect.FormatVar("KEY", value)
+				for _, line := range strings.Split(formatted, "\n") {
+					if isMarker(line, begin) || isMarker(line, end) {
+						t.Errorf("FormatVar(%q) produced a marker line", value)
+					}
+				}
+
+				vars, err := tt.dialect.ParseVars(formatted)
+				if err != nil {
+					t.Errorf("ParseVars(FormatVar(%q)) failed: %v", value, err)
+					continue
+				}
+				if vars["KEY"] != value {
+					t.Errorf("Round trip of %q produced %q", value, vars["KEY"])
+				}
+			}
+		})
+	}
+}
+
+func TestAllDialectsAgainstRealShells(t *testing.T) {
+	for _, tt := range allDialects {
+		t.Run(tt.dialect.Name(), func(t *testing.T) {
+			binary, err := exec.LookPath(tt.binary)
+			if err != nil {
+				t.Skipf("%s not available", tt.binary)
+			}
+
+			script := filepath.Join(t.TempDir(), "env")
+			for _, value := range trickyValues {
+				// Shells differ in how they treat bytes that are not
+				// UTF-8 and trailing newlines in command output
+				if !representable(tt.dialect, value) || !utf8.ValidString(value) || strings.HasSuffix(value, "\n") {
+					continue
+				}
+				content := tt.dialect.FormatVar("KEY", value) + "\n"
+				if err := os.WriteFile(script, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+				out, err := exec.Command(binary, tt.args(script)...).Output()
+				if err != nil {
+					t.Errorf("sourcing value %q failed: %v", value, err)
+					continue
+				}
+				if string(out) != value {
+					t.Errorf("%s read %q back as %q", tt.binary, value, out)
+				}
+			}
+		})
+	}
+}
+
+func TestUTF8DialectsRejectInvalidValues(t *testing.T) {
+	for _, d := range []Dialect{nuDialect{}, xonshDialect{}, pwshDialect{}} {
+		if err := validateVar(d, "KEY", "\xff"); err == nil {
+			t.Errorf("%s should reject invalid UTF-8", d.Name())
+		}
+	}
+	if err := validateVar(posixDialect{}, "KEY", "\xff"); err != nil {
+		t.Errorf("posix should accept arbitrary bytes, got %v", err)
+	}
+}
+
+func TestNewShellStore(t *testing.T) {
+	home := t.TempDir()
+
+	tests := []struct {
+		shell   string
+		path    string
+		dialect string
+	}{
+		{"zsh", ".zshrc", "posix"},
+		{"/bin/bash", ".bashrc", "posix"},
+		{"-zsh", ".zshrc", "posix"},
+		{"dash", ".profile", "posix"},
+		{"fish", filepath.Join(".config", "fish", "conf.d", "claude-foundry.fish"), "fish"},
+		{"tcsh", ".tcshrc", "tcsh"},
+		{"csh", ".cshrc", "csh"},
+		{"xonsh", ".xonshrc", "xonsh"},
+		{"nushell", "env.nu", "nu"},
+		{"pwsh", "Microsoft.PowerShell_profile.ps1", "pwsh"},
+		{"powershell.exe", "Microsoft.PowerShell_profile.ps1", "pwsh"},
+	}
+
+	for _, tt := range tests {
+		store, err := NewShellStore(home, tt.shell)
+		if err != nil {
+			t.Errorf("NewShellStore(%q) failed: %v", tt.shell, err)
+			continue
+		}
+		if !strings.HasSuffix(store.Path(), tt.path) {
+			t.Errorf("NewShellStore(%q) path = %s, expected suffix %s", tt.shell, store.Path(), tt.path)
+		}
+		if store.dialect.Name() != tt.dialect {
+			t.Errorf("NewShellStore(%q) dialect = %s, expected %s", tt.shell, store.dialect.Name(), tt.dialect)
+		}
+	}
+
+	if _, err := NewShellStore(home, "cmd.exe"); err == nil {
+		t.Error("NewShellStore should reject unknown shells")
+	}
+	if store := newShellStore(home, "unknown"); !strings.HasSuffix(store.Path(), ".profile") {
+		t.Errorf("Unknown shells should fall back to .profile, got %s", store.Path())
+	}
+}
+
+func TestTcshPrefersExistingCshrc(t *testing.T) {
+	home := t.TempDir()
+	if err := os.WriteFile(filepath.Join(home, ".cshrc"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, _ := NewShellStore(home, "tcsh")
+	if filepath.Base(store.Path()) != ".cshrc" {
+		t.Errorf("tcsh should use the existing .cshrc, got %s", store.Path())
+	}
+}
+
+func TestDialectStoresUseOwnMarkers(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("profile layout differs on Windows")
+	}
+	home := t.TempDir()
+
+	for _, shell := range []string{"tcsh", "nu", "xonsh", "pwsh"} {
+		store, _ := NewShellStore(home, shell)
+		if err := SetAllVars(store, map[string]string{EnvUseFoundry: "true"}); err != nil {
+			t.Fatalf("%s: SetAllVars failed: %v", shell, err)
+		}
+
+		data, _ := os.ReadFile(store.Path())
+		begin, _ := store.dialect.Markers()
+		if !strings.Contains(string(data), begin) || strings.Contains(string(data), markerBegin) {
+			t.Errorf("%s: block written with wrong markers:\n%s", shell, data)
+		}
+
+		if value, _ := store.Get(EnvUseFoundry); value != "true" {
+			t.Errorf("%s: read back %q", shell, value)
+		}
+	}
+}
+
+func FuzzDialectRoundTrip(f *testing.F) {
+	for _, value := range trickyValues {
+		f.Add(value)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		for _, tt := range allDialects {
+			if !representable(tt.dialect, value) {
+				continue
+			}
+			vars, err := tt.dialect.ParseVars(tt.dialect.FormatVar("KEY", value))
+			if err != nil {
+				t.Fatalf("%s: ParseVars(FormatVar(%q)) failed: %v", tt.dialect.Name(), value, err)
+			}
+			if vars["KEY"] != value {
+				t.Fatalf("%s: round trip of %q produced %q", tt.dialect.Name(), value, vars["KEY"])
+			}
+		}
+	})
+}
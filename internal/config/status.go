@@ -0,0 +1,256 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Source tells where a persisted variable is defined
+type Source struct {
+	Path string
+	Line int // 1-based, 0 when the source has no lines (e.g. the registry)
+}
+
+// String returns path:line, or just the path without a line
+func (s Source) String() string {
+	if s.Line == 0 {
+		return s.Path
+	}
+	return fmt.Sprintf("%s:%d", s.Path, s.Line)
+}
+
+// SourceStore is implemented by stores that can tell where each of their
+// variables is persisted
+type SourceStore interface {
+	Sources() (map[string]Source, error)
+}
+
+// VarStatus compares what is persisted for one variable with what the
+// running process sees
+type VarStatus struct {
+	Key       string
+	Persisted string
+	Source    Source // zero when not persisted or unknown
+	Live      string
+	LiveSet   bool
+	// Settings is true when Claude Code reads the variable from a settings
+	// file, so the shell not having it is no drift
+	Settings bool
+	// Elsewhere lists assignments outside the managed block, which may
+	// override or shadow the managed value (see FindOutsideAssignments)
+	Elsewhere []Source
+}
+
+// Drift describes how the live value differs from the persisted one and
+// where else the variable is set, or returns "" when all is in order
+func (v VarStatus) Drift() string {
+	problems := []string{}
+	switch {
+	case v.Settings:
+	case v.Persisted != "" && !v.LiveSet:
+		problems = append(problems, "persisted but not yet loaded in this shell")
+	case v.Persisted != "" && v.Live != v.Persisted:
+		problems = append(problems, "this shell has a different value, open a new shell to load the persisted one")
+	case v.Persisted == "" && v.LiveSet && len(v.Elsewhere) == 0:
+		problems = append(problems, "set in this shell but not persisted")
+	}
+
+	if len(v.Elsewhere) > 0 {
+		where := make([]string, len(v.Elsewhere))
+		for i, source := range v.Elsewhere {
+			where[i] = source.String()
+		}
+		if v.Persisted == "" {
+			problems = append(problems, "set outside the managed block in "+strings.Join(where, ", "))
+		} else {
+			problems = append(problems, "also set outside the managed block in "+strings.Join(where, ", "))
+		}
+	}
+	return strings.Join(problems, "; ")
+}
+
+// varStatuses reports the persisted and live state of the managed keys
+// that matter for the persisted provider: its own keys, the switches of
+// the other providers and anything else that is persisted. An AWS_REGION
+// in the shell is no drift when Bedrock is not in use.
+func varStatuses(store EnvStore, persisted map[string]string, provider Provider) ([]VarStatus, error) {
+	sources := map[string]Source{}
+	if s, ok := store.(SourceStore); ok {
+		var err error
+		if sources, err = s.Sources(); err != nil {
+			return nil, err
+		}
+	}
+
+	relevant := map[string]bool{}
+	for _, key := range provider.Keys() {
+		relevant[key] = true
+	}
+	for _, key := range providerSwitches {
+		relevant[key] = true
+	}
+
+	keys := ManagedKeys()
+	for _, key := range sortedKeys(ExtraVars(persisted)) {
+		if !containsKey(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys[len(allKeys):] {
+		relevant[key] = true // extra variables always matter
+	}
+
+	statuses := make([]VarStatus, 0, len(keys))
+	for _, key := range keys {
+		if !relevant[key] && persisted[key] == "" {
+			continue
+		}
+		status := VarStatus{Key: key, Persisted: persisted[key]}
+		if status.Persisted != "" {
+			status.Source = sources[key]
+		}
+		if shell, ok := store.(interface{ readsShell() bool }); ok && !shell.readsShell() {
+			status.Settings = true
+		} else {
+			status.Live, status.LiveSet = os.LookupEnv(key)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Sources returns the file and line each variable of the block is set on
+func (s *ProfileStore) Sources() (map[string]Source, error) {
+	state, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[string]Source)
+	for i, snap := range state.legacy {
+		text := state.legacyText[i]
+		for key, line := range statementLines(text.body(), state.vars) {
+			sources[key] = Source{Path: snap.path, Line: text.begin + 1 + line}
+		}
+	}
+	if state.storage == StorageFile {
+		for key, line := range statementLines(state.env.content, state.vars) {
+			sources[key] = Source{Path: s.envFile, Line: line}
+		}
+	} else {
+		for key, line := range statementLines(state.text.body(), state.vars) {
+			sources[key] = Source{Path: s.path, Line: state.text.begin + 1 + line}
+		}
+	}
+	return sources, nil
+}
+
+// Sources returns the sources of the first store
+func (m *MultiStore) Sources() (map[string]Source, error) {
+	if s, ok := m.stores[0].(SourceStore); ok {
+		return s.Sources()
+	}
+	return map[string]Source{}, nil
+}
+
+// assignmentPattern matches a line that starts setting key in any of the
+// supported shells (export, set -gx, setenv, $env.KEY, $env:KEY, $KEY,
+// declare -x, or a bare KEY=)
+func assignmentPattern(key string) *regexp.Regexp {
+	k := regexp.QuoteMeta(key)
+	return regexp.MustCompile(`^\s*(?:(?:export\s+|(?:set|declare|typeset)\s+(?:-\S+\s+)*|setenv\s+|\$env[.:]|\$)` +
+		k + `(?:[\s=]|$)|` + k + `=)`)
+}
+
+// statementLines returns the 1-based line within text on which each of
+// keys is assigned; the last assignment wins like it does in the shell
+func statementLines(text string, keys map[string]string) map[string]int {
+	lines := strings.Split(text, "\n")
+	found := make(map[string]int)
+	for key := range keys {
+		pattern := assignmentPattern(key)
+		for i, line := range lines {
+			if pattern.MatchString(line) {
+				found[key] = i + 1
+			}
+		}
+	}
+	return found
+}
+
+// startupFiles lists the shell startup files under home that may set
+// variables, including ones the tool never writes such as ~/.zshenv
+func startupFiles(home string) []string {
+	files := []string{
+		filepath.Join(home, ".zshenv"),
+		filepath.Join(home, ".zprofile"),
+		filepath.Join(home, ".zlogin"),
+		filepath.Join(home, ".bash_login"),
+		filepath.Join(home, ".login"),
+		filepath.Join(home, ".config", "fish", "config.fish"),
+		filepath.Join(nuConfigDir(home), "config.nu"),
+	}
+	for _, name := range SupportedShells() {
+		files = append(files, shells[name].profile(home))
+	}
+	for _, name := range []string{".bashrc", ".bash_profile", ".cshrc", ".tcshrc"} {
+		files = append(files, filepath.Join(home, name))
+	}
+	return files
+}
+
+// FindOutsideAssignments scans the shell startup files under home for
+// managed variables set outside a managed block
+func FindOutsideAssignments(home string) map[string][]Source {
+	found := make(map[string][]Source)
+	seen := make(map[string]bool)
+	patterns := make(map[string]*regexp.Regexp, len(allKeys))
+	for _, key := range allKeys {
+		patterns[key] = assignmentPattern(key)
+	}
+
+	for _, path := range startupFiles(home) {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		inBlock := false
+		for i, line := range strings.Split(string(data), "\n") {
+			trimmed := strings.TrimSpace(line)
+			switch {
+			case strings.HasPrefix(trimmed, "# >>> Claude Foundry Manager"):
+				inBlock = true
+				continue
+			case strings.HasPrefix(trimmed, "# <<< Claude Foundry Manager"):
+				inBlock = false
+				continue
+			case inBlock:
+				continue
+			}
+			for _, key := range allKeys {
+				if patterns[key].MatchString(line) {
+					found[key] = append(found[key], Source{Path: path, Line: i + 1})
+				}
+			}
+		}
+	}
+	return found
+}
+
+// AddOutsideAssignments fills in VarStatus.Elsewhere from the startup files
+// under home
+func AddOutsideAssignments(statuses []VarStatus, home string) {
+	outside := FindOutsideAssignments(home)
+	for i := range statuses {
+		statuses[i].Elsewhere = outside[statuses[i].Key]
+	}
+}
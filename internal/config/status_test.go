@@ -0,0 +1,111 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfileStoreSources(t *testing.T) {
+	home := t.TempDir()
+	store, _ := NewShellStore(home, "zsh")
+	if err := os.WriteFile(store.Path(), []byte("line one\nline two\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetAllVars(store, map[string]string{EnvFoundryResource: "res", EnvUseFoundry: "true"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Lines 1-2 user content, 3 blank, 4 marker, 5-6 header, then sorted vars
+	sources, err := store.Sources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sources[EnvFoundryResource]; got != (Source{Path: store.Path(), Line: 7}) {
+		t.Errorf("Unexpected source for %s: %v", EnvFoundryResource, got)
+	}
+	if got := sources[EnvUseFoundry]; got.Line != 8 {
+		t.Errorf("Unexpected source for %s: %v", EnvUseFoundry, got)
+	}
+
+	store.SetStorage(StorageFile)
+	if err := store.Set(EnvFoundryResource, "other"); err != nil {
+		t.Fatal(err)
+	}
+	sources, _ = store.Sources()
+	if got := sources[EnvFoundryResource]; got != (Source{Path: store.EnvFile(), Line: 3}) {
+		t.Errorf("Unexpected source in file mode: %v", got)
+	}
+}
+
+func TestGetCurrentConfigReportsDrift(t *testing.T) {
+	home := t.TempDir()
+	store, _ := NewShellStore(home, "bash")
+	if err := ApplyFoundryConfig(store, &FoundryConfig{Resource: "res", SonnetModel: "s"}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(EnvFoundryResource, "old")
+	t.Setenv(EnvDefaultSonnet, "s")
+	t.Setenv(EnvUseFoundry, "")
+	os.Unsetenv(EnvUseFoundry) // restored by t.Setenv
+	t.Setenv(EnvFoundryBaseURL, "https://example.com")
+
+	cfg, err := GetCurrentConfig(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drift := map[string]string{}
+	for _, v := range cfg.Vars {
+		drift[v.Key] = v.Drift()
+	}
+	expected := map[string]string{
+		EnvUseFoundry:      "persisted but not yet loaded in this shell",
+		EnvFoundryResource: "this shell has a different value, open a new shell to load the persisted one",
+		EnvDefaultSonnet:   "",
+		EnvFoundryBaseURL:  "set in this shell but not persisted",
+	}
+	for key, want := range expected {
+		if drift[key] != want {
+			t.Errorf("%s: expected %q, got %q", key, want, drift[key])
+		}
+	}
+}
+
+func TestFindOutsideAssignments(t *testing.T) {
+	home := t.TempDir()
+	zshenv := "# env\nexport ANTHROPIC_FOUNDRY_API_KEY=secret\n"
+	if err := os.WriteFile(filepath.Join(home, ".zshenv"), []byte(zshenv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, _ := NewShellStore(home, "zsh")
+	if err := store.Set(EnvFoundryAPIKey, "managed"); err != nil {
+		t.Fatal(err)
+	}
+
+	outside := FindOutsideAssignments(home)
+	sources := outside[EnvFoundryAPIKey]
+	if len(sources) != 1 || sources[0] != (Source{Path: filepath.Join(home, ".zshenv"), Line: 2}) {
+		t.Errorf("Expected only the .zshenv assignment, got %v", sources)
+	}
+
+	status := VarStatus{Key: EnvFoundryAPIKey, Persisted: "managed", Live: "managed", LiveSet: true, Elsewhere: sources}
+	if status.Drift() == "" {
+		t.Error("Expected drift for a variable also set outside the block")
+	}
+}
+
+func TestAssignmentPattern(t *testing.T) {
+	pattern := assignmentPattern("KEY")
+	for _, line := range []string{"export KEY=1", "  set -gx KEY 1", "setenv KEY 1", "$env.KEY = 1", "$env:KEY = 1", "$KEY = 1", "KEY=1", "declare -x KEY=1"} {
+		if !pattern.MatchString(line) {
+			t.Errorf("Expected %q to match", line)
+		}
+	}
+	for _, line := range []string{"export KEYS=1", "echo KEY=1", "# export KEY=1"} {
+		if pattern.MatchString(line) {
+			t.Errorf("Expected %q not to match", line)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package config
+
+import "sort"
+
+// EnvStore is a place where Claude Code environment variables are persisted.
+//
+// Implementations:
+// - ProfileStore: managed block inside a shell profile file (profile.go)
+// - RegistryStore: Windows system environment registry key (manager_windows.go)
+// - MemoryStore: in-memory map, useful for tests and dry runs
+//
+// DefaultStore returns the platform-appropriate implementation.
+type EnvStore interface {
+	// Get returns the persisted value of key, or "" if it is not set
+	Get(key string) (string, error)
+	// Set persists key=value
+	Set(key, value string) error
+	// Delete removes key; deleting a missing key is not an error
+	Delete(key string) error
+	// List returns all variables currently held by the store
+	List() (map[string]string, error)
+	// Commit makes the persisted changes visible to the rest of the system
+	Commit() error
+}
+
+// MemoryStore is an EnvStore backed by a map
+type MemoryStore struct {
+	vars    map[string]string
+	commits int
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{vars: make(map[string]string)}
+}
+
+// Get returns the value of key
+func (s *MemoryStore) Get(key string) (string, error) {
+	return s.vars[key], nil
+}
+
+// Set stores key=value
+func (s *MemoryStore) Set(key, value string) error {
+	s.vars[key] = value
+	return nil
+}
+
+// Delete removes key
+func (s *MemoryStore) Delete(key string) error {
+	delete(s.vars, key)
+	return nil
+}
+
+// List returns a copy of all stored variables
+func (s *MemoryStore) List() (map[string]string, error) {
+	vars := make(map[string]string, len(s.vars))
+	for k, v := range s.vars {
+		vars[k] = v
+	}
+	return vars, nil
+}
+
+// Commit records that a commit happened (see Commits)
+func (s *MemoryStore) Commit() error {
+	s.commits++
+	return nil
+}
+
+// Commits returns how many times Commit has been called
+func (s *MemoryStore) Commits() int {
+	return s.commits
+}
+
+// StoreFiles returns the files a store writes: the profile and its managed
+// env file, or the settings file. Stores that do not keep files, such as
+// the registry, have none.
+func StoreFiles(store EnvStore) []string {
+	files := []string{}
+	switch s := store.(type) {
+	case *MultiStore:
+		for _, child := range s.Stores() {
+			files = append(files, StoreFiles(child)...)
+		}
+	case *ProfileStore:
+		files = append(files, s.Path())
+		if s.EnvFile() != "" {
+			files = append(files, s.EnvFile())
+		}
+	case *SettingsStore:
+		files = append(files, s.Path())
+	}
+	return files
+}
+
+// ManagedFiles returns every file the tool may write for a user with the
+// given home and project: the files of the store, the profile and env file
+// of each supported shell, and the settings file of each scope
+func ManagedFiles(store EnvStore, home, projectDir string) []string {
+	files := StoreFiles(store)
+	for _, shell := range SupportedShells() {
+		if s, err := NewShellStore(home, shell); err == nil {
+			files = append(files, s.Path(), s.EnvFile())
+		}
+	}
+	return append(files, SettingsFiles(home, projectDir)...)
+}
+
+// sortedKeys returns the keys of vars in lexical order
+func sortedKeys(vars map[string]string) []string {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+
+	if err := store.Set("KEY", "value"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	value, err := store.Get("KEY")
+	if err != nil || value != "value" {
+		t.Errorf("Get = %q, %v; expected 'value'", value, err)
+	}
+
+	if err := store.Delete("KEY"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := store.Delete("MISSING"); err != nil {
+		t.Errorf("Deleting a missing key should succeed, got %v", err)
+	}
+
+	vars, _ := store.List()
+	if len(vars) != 0 {
+		t.Errorf("Expected empty store, got %v", vars)
+	}
+}
+
+func TestApplyAndRollbackWithMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	cfg := &FoundryConfig{
+		Resource:    "test-resource",
+		APIKey:      "test-key",
+		SonnetModel: "claude-sonnet-4-5",
+		HaikuModel:  "claude-haiku-4-5",
+		OpusModel:   "claude-opus-4-5",
+	}
+
+	if err := ApplyFoundryConfig(store, cfg); err != nil {
+		t.Fatalf("ApplyFoundryConfig failed: %v", err)
+	}
+
+	current, err := GetCurrentConfig(store)
+	if err != nil {
+		t.Fatalf("GetCurrentConfig failed: %v", err)
+	}
+	if !current.UseFoundry || current.Resource != "test-resource" || current.APIKey != "test-key" {
+		t.Errorf("Unexpected config after apply: %+v", current)
+	}
+	if current.BaseURL != "" {
+		t.Errorf("BaseURL should not be set when Resource is used, got %q", current.BaseURL)
+	}
+	if store.Commits() != 1 {
+		t.Errorf("Expected 1 commit, got %d", store.Commits())
+	}
+
+	if err := RollbackToDefault(store); err != nil {
+		t.Fatalf("RollbackToDefault failed: %v", err)
+	}
+	if vars := GetAllVars(store); len(vars) != 0 {
+		t.Errorf("Expected no variables after rollback, got %v", vars)
+	}
+}
+
+func TestDirStore(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("SHELL", "/bin/zsh")
+
+	store := NewDirStore(home)
+	if store.Path() != filepath.Join(home, ".zshrc") {
+		t.Fatalf("Unexpected profile path %s", store.Path())
+	}
+
+	// Existing user content must survive
+	userContent := "alias ll='ls -l'\n"
+	if err := os.WriteFile(store.Path(), []byte(userContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetAllVars(store, map[string]string{EnvUseFoundry: "true", EnvFoundryResource: "res"}); err != nil {
+		t.Fatalf("SetAllVars failed: %v", err)
+	}
+
+	vars := GetAllVars(store)
+	if vars[EnvUseFoundry] != "true" || vars[EnvFoundryResource] != "res" {
+		t.Errorf("Unexpected vars read back: %v", vars)
+	}
+
+	if err := RollbackToDefault(store); err != nil {
+		t.Fatalf("RollbackToDefault failed: %v", err)
+	}
+
+	data, err := os.ReadFile(store.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "alias ll='ls -l'") {
+		t.Errorf("User content lost: %q", data)
+	}
+	if strings.Contains(string(data), markerBegin) {
+		t.Errorf("Managed block not removed: %q", data)
+	}
+}
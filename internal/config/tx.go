@@ -0,0 +1,149 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// BatchStore is implemented by stores that can apply a set of changes in a
+// single write (e.g. one profile rewrite instead of one per variable).
+//
+// ApplyBatch must leave the store unchanged when it returns an error. On
+// success it returns an undo function that restores the exact state the
+// store was in before the batch.
+type BatchStore interface {
+	EnvStore
+	ApplyBatch(sets map[string]string, deletes []string) (undo func() error, err error)
+}
+
+// Tx stages sets and deletes and applies them to a store all at once.
+// Either every change is applied and committed, or the store is left in
+// its pre-transaction state.
+type Tx struct {
+	store   EnvStore
+	changes map[string]*string // nil value means delete
+	order   []string
+	done    bool
+}
+
+// Begin starts a transaction against store
+func Begin(store EnvStore) *Tx {
+	return &Tx{store: store, changes: make(map[string]*string)}
+}
+
+// Set stages key=value. A later Set or Delete of the same key wins.
+func (tx *Tx) Set(key, value string) {
+	tx.stage(key, &value)
+}
+
+// Delete stages the removal of key
+func (tx *Tx) Delete(key string) {
+	tx.stage(key, nil)
+}
+
+func (tx *Tx) stage(key string, value *string) {
+	if _, ok := tx.changes[key]; !ok {
+		tx.order = append(tx.order, key)
+	}
+	tx.changes[key] = value
+}
+
+// Commit applies all staged changes and commits the store. On any error the
+// store is restored to its state before the transaction.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return fmt.Errorf("transaction already committed")
+	}
+	tx.done = true
+
+	sets := make(map[string]string)
+	deletes := []string{}
+	for _, key := range tx.order {
+		if value := tx.changes[key]; value != nil {
+			sets[key] = *value
+		} else {
+			deletes = append(deletes, key)
+		}
+	}
+
+	var undo func() error
+	var err error
+	if batch, ok := tx.store.(BatchStore); ok {
+		undo, err = batch.ApplyBatch(sets, deletes)
+	} else {
+		undo, err = applyEach(tx.store, tx.order, tx.changes)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Notify system of environment changes
+	if err := tx.store.Commit(); err != nil {
+		return withUndo(fmt.Errorf("failed to notify system of changes: %w", err), undo)
+	}
+
+	return nil
+}
+
+// applyEach applies changes one key at a time, remembering the previous
+// values so a failure part way through can be undone
+func applyEach(store EnvStore, order []string, changes map[string]*string) (func() error, error) {
+	previous, err := store.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current values: %w", err)
+	}
+	for _, key := range order {
+		if _, ok := previous[key]; !ok {
+			// List may only cover part of the store, ask for the key directly
+			if value, err := store.Get(key); err == nil && value != "" {
+				previous[key] = value
+			}
+		}
+	}
+
+	applied := []string{}
+	undo := func() error {
+		var errs []error
+		for i := len(applied) - 1; i >= 0; i-- {
+			key := applied[i]
+			if value, ok := previous[key]; ok {
+				errs = append(errs, store.Set(key, value))
+			} else {
+				errs = append(errs, store.Delete(key))
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	for _, key := range order {
+		var err error
+		if value := changes[key]; value != nil {
+			err = store.Set(key, *value)
+			if err != nil {
+				err = fmt.Errorf("failed to set %s: %w", key, err)
+			}
+		} else {
+			err = store.Delete(key)
+			if err != nil {
+				err = fmt.Errorf("failed to delete %s: %w", key, err)
+			}
+		}
+		if err != nil {
+			return nil, withUndo(err, undo)
+		}
+		applied = append(applied, key)
+	}
+
+	return undo, nil
+}
+
+// withUndo runs undo and folds its failure, if any, into err
+func withUndo(err error, undo func() error) error {
+	if undo == nil {
+		return err
+	}
+	if undoErr := undo(); undoErr != nil {
+		return fmt.Errorf("%w (additionally, restoring the previous state failed: %v)", err, undoErr)
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// failingStore fails the Nth Set call
+type failingStore struct {
+	*MemoryStore
+	failAt int
+	sets   int
+}
+
+func (s *failingStore) Set(key, value string) error {
+	s.sets++
+	if s.sets == s.failAt {
+		return errors.New("disk full")
+	}
+	return s.MemoryStore.Set(key, value)
+}
+
+// failingCommitProfile is a profile store whose Commit always fails
+type failingCommitProfile struct {
+	*ProfileStore
+}
+
+func (s failingCommitProfile) Commit() error {
+	return errors.New("broadcast timed out")
+}
+
+func TestTxAppliesAllChanges(t *testing.T) {
+	store := NewMemoryStore()
+	store.Set("OLD", "1")
+
+	tx := Begin(store)
+	tx.Set("A", "1")
+	tx.Set("B", "2")
+	tx.Delete("OLD")
+	tx.Delete("A") // later operations win
+	tx.Set("A", "3")
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	vars, _ := store.List()
+	if len(vars) != 2 || vars["A"] != "3" || vars["B"] != "2" {
+		t.Errorf("Unexpected vars after commit: %v", vars)
+	}
+	if store.Commits() != 1 {
+		t.Errorf("Expected store to be committed once, got %d", store.Commits())
+	}
+
+	if err := tx.Commit(); err == nil {
+		t.Error("Committing twice should fail")
+	}
+}
+
+func TestTxRestoresStateOnFailure(t *testing.T) {
+	store := &failingStore{MemoryStore: NewMemoryStore(), failAt: 3}
+	store.MemoryStore.Set(EnvFoundryResource, "previous")
+	store.MemoryStore.Set(EnvDefaultOpus, "opus-old")
+
+	err := ApplyFoundryConfig(store, &FoundryConfig{
+		Resource:    "new-resource",
+		SonnetModel: "sonnet",
+		HaikuModel:  "haiku",
+		OpusModel:   "opus",
+	})
+	if err == nil {
+		t.Fatal("Expected ApplyFoundryConfig to fail")
+	}
+
+	vars, _ := store.List()
+	expected := map[string]string{EnvFoundryResource: "previous", EnvDefaultOpus: "opus-old"}
+	if len(vars) != len(expected) {
+		t.Fatalf("Store not restored, got %v", vars)
+	}
+	for key, value := range expected {
+		if vars[key] != value {
+			t.Errorf("%s = %q, expected %q", key, vars[key], value)
+		}
+	}
+	if store.Commits() != 0 {
+		t.Error("Store should not be committed after a failed transaction")
+	}
+}
+
+func TestProfileStoreBatchRestoresOnCommitFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".bashrc")
+	original := "export PATH=\"$HOME/bin:$PATH\"\n"
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := failingCommitProfile{NewProfileStore(path, posixDialect{})}
+	if err := SetAllVars(store, map[string]string{EnvUseFoundry: "true"}); err == nil {
+		t.Fatal("Expected SetAllVars to fail")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != original {
+		t.Errorf("Profile not restored exactly:\n got %q\nwant %q", data, original)
+	}
+}
+
+func TestProfileStoreBatchRemovesCreatedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".zshrc")
+
+	store := failingCommitProfile{NewProfileStore(path, posixDialect{})}
+	if err := SetAllVars(store, map[string]string{EnvUseFoundry: "true"}); err == nil {
+		t.Fatal("Expected SetAllVars to fail")
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Profile created by a failed transaction should be removed, stat err = %v", err)
+	}
+}
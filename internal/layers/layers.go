@@ -0,0 +1,322 @@
+package layers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+// Scope names a configuration layer. Layers are merged in the order of
+// Scopes, later ones overriding earlier ones.
+type Scope string
+
+const (
+	ScopeSystem  Scope = "system"  // machine-wide, e.g. /etc/claude-foundry-manager/config.yaml
+	ScopeTeam    Scope = "team"    // shared by a team, e.g. synced from a repository
+	ScopeUser    Scope = "user"    // ~/.config/claude-foundry-manager/config.yaml
+	ScopeProject Scope = "project" // .claude-foundry.yaml in the project tree
+)
+
+// Scopes lists every scope from lowest to highest priority
+var Scopes = []Scope{ScopeSystem, ScopeTeam, ScopeUser, ScopeProject}
+
+// ProjectFile is the name of the project layer, looked up from the working
+// directory towards the root
+const ProjectFile = ".claude-foundry.yaml"
+
+// TeamConfigEnv overrides the location of the team layer
+const TeamConfigEnv = "CLAUDE_FOUNDRY_TEAM_CONFIG"
+
+// Keys lists the settings a layer may hold, in the order they are written
+var Keys = []string{"resource", "base_url", "api_key", "sonnet_model", "haiku_model", "opus_model"}
+
+// Layer is the content of one layer file
+type Layer struct {
+	Scope  Scope
+	Path   string
+	Exists bool
+	Values map[string]string
+	Lines  map[string]int // line of each value in the file
+}
+
+// Origin tells which layer supplied a setting
+type Origin struct {
+	Scope Scope
+	Path  string
+	Line  int
+}
+
+// String returns "scope (path:line)"
+func (o Origin) String() string {
+	return fmt.Sprintf("%s (%s:%d)", o.Scope, o.Path, o.Line)
+}
+
+// Resolved is the result of merging all layers
+type Resolved struct {
+	Config config.FoundryConfig
+	// Origins maps each setting to the layer it came from
+	Origins map[string]Origin
+	// Overridden maps each setting to the lower layers that also set it
+	Overridden map[string][]Origin
+}
+
+// Locations tells where each layer lives
+type Locations struct {
+	System string
+	Team   string
+	User   string
+	// Cwd is where the search for the project file starts
+	Cwd string
+}
+
+// DefaultLocations returns the standard layer locations for this machine
+func DefaultLocations() (Locations, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return Locations{}, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return Locations{}, fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	system := filepath.Join("/etc", "claude-foundry-manager", "config.yaml")
+	if runtime.GOOS == "windows" {
+		programData := os.Getenv("ProgramData")
+		if programData == "" {
+			programData = `C:\ProgramData`
+		}
+		system = filepath.Join(programData, "claude-foundry-manager", "config.yaml")
+	}
+
+	team := os.Getenv(TeamConfigEnv)
+	if team == "" {
+		team = filepath.Join(config.ConfigDir(home), "team.yaml")
+	}
+
+	return Locations{
+		System: system,
+		Team:   team,
+		User:   filepath.Join(config.ConfigDir(home), "config.yaml"),
+		Cwd:    cwd,
+	}, nil
+}
+
+// ParseScope parses a --scope value
+func ParseScope(value string) (Scope, error) {
+	for _, scope := range Scopes {
+		if string(scope) == strings.ToLower(strings.TrimSpace(value)) {
+			return scope, nil
+		}
+	}
+	return "", fmt.Errorf("unknown scope %q (use system, team, user or project)", value)
+}
+
+// Path returns the file of the given layer. The project layer is the
+// nearest .claude-foundry.yaml above Cwd, or one in Cwd if there is none.
+func (l Locations) Path(scope Scope) string {
+	switch scope {
+	case ScopeSystem:
+		return l.System
+	case ScopeTeam:
+		return l.Team
+	case ScopeUser:
+		return l.User
+	}
+
+	for dir := l.Cwd; ; {
+		candidate := filepath.Join(dir, ProjectFile)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return filepath.Join(l.Cwd, ProjectFile)
+}
+
+// Load reads every layer, lowest priority first. Missing files are empty
+// layers.
+func (l Locations) Load() ([]Layer, error) {
+	layers := make([]Layer, 0, len(Scopes))
+	for _, scope := range Scopes {
+		layer, err := loadLayer(scope, l.Path(scope))
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+// loadLayer reads one layer file
+func loadLayer(scope Scope, path string) (Layer, error) {
+	layer := Layer{Scope: scope, Path: path, Values: map[string]string{}, Lines: map[string]int{}}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return layer, nil
+		}
+		return Layer{}, fmt.Errorf("failed to read %s layer: %w", scope, err)
+	}
+	layer.Exists = true
+
+	entries, err := parseYAML(string(data))
+	if err != nil {
+		return Layer{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for _, entry := range entries {
+		if !isKey(entry.key) {
+			return Layer{}, fmt.Errorf("failed to parse %s: line %d: unknown setting %q (known: %s)",
+				path, entry.line, entry.key, strings.Join(Keys, ", "))
+		}
+		if entry.value == "" {
+			continue
+		}
+		layer.Values[entry.key] = entry.value
+		layer.Lines[entry.key] = entry.line
+	}
+	return layer, nil
+}
+
+// Resolve merges layers, later ones winning. resource and base_url are
+// alternatives, so the layer that sets either of them decides both.
+func Resolve(layers []Layer) Resolved {
+	values := map[string]string{}
+	r := Resolved{Origins: map[string]Origin{}, Overridden: map[string][]Origin{}}
+
+	for _, layer := range layers {
+		_, hasResource := layer.Values["resource"]
+		_, hasBaseURL := layer.Values["base_url"]
+		if hasResource || hasBaseURL {
+			for _, key := range []string{"resource", "base_url"} {
+				if origin, ok := r.Origins[key]; ok {
+					r.Overridden[key] = append(r.Overridden[key], origin)
+					delete(r.Origins, key)
+					delete(values, key)
+				}
+			}
+		}
+
+		for _, key := range Keys {
+			value, ok := layer.Values[key]
+			if !ok {
+				continue
+			}
+			if origin, ok := r.Origins[key]; ok {
+				r.Overridden[key] = append(r.Overridden[key], origin)
+			}
+			values[key] = value
+			r.Origins[key] = Origin{Scope: layer.Scope, Path: layer.Path, Line: layer.Lines[key]}
+		}
+	}
+
+	r.Config = config.FoundryConfig{
+		Resource:    values["resource"],
+		BaseURL:     values["base_url"],
+		APIKey:      values["api_key"],
+		SonnetModel: values["sonnet_model"],
+		HaikuModel:  values["haiku_model"],
+		OpusModel:   values["opus_model"],
+	}
+	return r
+}
+
+// Write sets values in the layer file at path, keeping its other content.
+// An empty value removes the setting. Setting resource removes base_url
+// from the same layer and vice versa.
+func Write(path string, values map[string]string) error {
+	for key := range values {
+		if !isKey(key) {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+	}
+	changes := writeChanges(values)
+
+	content := ""
+	data, err := os.ReadFile(path)
+	if err == nil {
+		content = string(data)
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	// The layer may hold an API key, so new files are private
+	if err := config.WriteFileAtomic(path, []byte(updateYAML(content, Keys, changes)), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// WithValues returns the layer as Write would leave it after setting
+// values, without writing anything
+func (l Layer) WithValues(values map[string]string) Layer {
+	updated := l
+	updated.Values = map[string]string{}
+	for key, value := range l.Values {
+		updated.Values[key] = value
+	}
+	for key, value := range writeChanges(values) {
+		if value == "" {
+			delete(updated.Values, key)
+		} else {
+			updated.Values[key] = value
+		}
+	}
+	return updated
+}
+
+// writeChanges returns the settings Write changes for values: resource
+// and base_url each clear the other
+func writeChanges(values map[string]string) map[string]string {
+	changes := make(map[string]string, len(values)+1)
+	for key, value := range values {
+		changes[key] = value
+	}
+	if changes["resource"] != "" {
+		changes["base_url"] = ""
+	}
+	if changes["base_url"] != "" {
+		changes["resource"] = ""
+	}
+	return changes
+}
+
+// ValuesOf returns the layer settings for cfg, leaving out empty ones
+func ValuesOf(cfg *config.FoundryConfig) map[string]string {
+	values := map[string]string{
+		"resource":     cfg.Resource,
+		"base_url":     cfg.BaseURL,
+		"api_key":      cfg.APIKey,
+		"sonnet_model": cfg.SonnetModel,
+		"haiku_model":  cfg.HaikuModel,
+		"opus_model":   cfg.OpusModel,
+	}
+	for key, value := range values {
+		if value == "" {
+			delete(values, key)
+		}
+	}
+	return values
+}
+
+// isKey reports whether key is a known setting
+func isKey(key string) bool {
+	for _, known := range Keys {
+		if key == known {
+			return true
+		}
+	}
+	return false
+}
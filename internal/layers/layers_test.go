@@ -0,0 +1,165 @@
+package layers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	content := "\ufeff# team defaults\n---\nresource: team-res # shared\napi_key: \"a \\\"quoted\\\" key\"\nsonnet_model: 'it''s'\nopus_model: ~\n"
+	entries, err := parseYAML(content)
+	if err != nil {
+		t.Fatalf("parseYAML failed: %v", err)
+	}
+
+	expected := []yamlEntry{
+		{"resource", "team-res", 3},
+		{"api_key", `a "quoted" key`, 4},
+		{"sonnet_model", "it's", 5},
+		{"opus_model", "", 6},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, entries)
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], entries[i])
+		}
+	}
+
+	for _, bad := range []string{"resource", "resource: \"open", "models: [a, b]", "a key: x"} {
+		if _, err := parseYAML(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestUpdateYAMLKeepsComments(t *testing.T) {
+	content := "# project layer\nresource: old\n\n# models\nsonnet_model: s\n"
+	got := updateYAML(content, Keys, map[string]string{"resource": "", "base_url": "https://x/y", "sonnet_model": "new model"})
+
+	expected := "# project layer\n\n# models\nsonnet_model: \"new model\"\nbase_url: https://x/y\n"
+	if got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	entries, err := parseYAML(got)
+	if err != nil || len(entries) != 2 || entries[0].value != "new model" {
+		t.Errorf("Expected the update to parse back, got %v (%v)", entries, err)
+	}
+}
+
+// writeLayers creates one layer file per scope that has content
+func writeLayers(t *testing.T, content map[Scope]string) Locations {
+	dir := t.TempDir()
+	project := filepath.Join(dir, "repo", "sub", "dir")
+	if err := os.MkdirAll(project, 0755); err != nil {
+		t.Fatal(err)
+	}
+	loc := Locations{
+		System: filepath.Join(dir, "system.yaml"),
+		Team:   filepath.Join(dir, "team.yaml"),
+		User:   filepath.Join(dir, "user.yaml"),
+		Cwd:    project,
+	}
+	paths := map[Scope]string{
+		ScopeSystem:  loc.System,
+		ScopeTeam:    loc.Team,
+		ScopeUser:    loc.User,
+		ScopeProject: filepath.Join(dir, "repo", ProjectFile),
+	}
+	for scope, text := range content {
+		if err := os.WriteFile(paths[scope], []byte(text), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return loc
+}
+
+func TestResolve(t *testing.T) {
+	loc := writeLayers(t, map[Scope]string{
+		ScopeSystem:  "base_url: https://corp.example\nsonnet_model: sys-sonnet\nhaiku_model: sys-haiku\n",
+		ScopeTeam:    "resource: team-res\n",
+		ScopeUser:    "api_key: secret\nsonnet_model: user-sonnet\n",
+		ScopeProject: "sonnet_model: project-sonnet\n",
+	})
+
+	if got := loc.Path(ScopeProject); !strings.HasSuffix(got, filepath.Join("repo", ProjectFile)) {
+		t.Errorf("Expected the project file to be found above the working directory, got %s", got)
+	}
+
+	loaded, err := loc.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	r := Resolve(loaded)
+
+	cfg := r.Config
+	if cfg.Resource != "team-res" || cfg.BaseURL != "" {
+		t.Errorf("Expected the team resource to replace the system base URL, got %+v", cfg)
+	}
+	if cfg.APIKey != "secret" || cfg.SonnetModel != "project-sonnet" || cfg.HaikuModel != "sys-haiku" || cfg.OpusModel != "" {
+		t.Errorf("Unexpected configuration: %+v", cfg)
+	}
+
+	if r.Origins["sonnet_model"].Scope != ScopeProject || r.Origins["haiku_model"].Scope != ScopeSystem {
+		t.Errorf("Unexpected origins: %v", r.Origins)
+	}
+	overridden := r.Overridden["sonnet_model"]
+	if len(overridden) != 2 || overridden[0].Scope != ScopeSystem || overridden[1].Scope != ScopeUser {
+		t.Errorf("Expected sonnet_model to override the system and user layers, got %v", overridden)
+	}
+	if len(r.Overridden["base_url"]) != 1 || r.Origins["base_url"].Scope != "" {
+		t.Errorf("Expected base_url to be overridden by the team resource, got %v", r.Overridden["base_url"])
+	}
+}
+
+func TestLoadRejectsUnknownSetting(t *testing.T) {
+	loc := writeLayers(t, map[Scope]string{ScopeUser: "resource: x\nresorce: y\n"})
+
+	_, err := loc.Load()
+	if err == nil || !strings.Contains(err.Error(), "line 2") || !strings.Contains(err.Error(), "resorce") {
+		t.Errorf("Expected an error naming line 2 and the unknown key, got %v", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	loc := writeLayers(t, map[Scope]string{ScopeUser: "# mine\nbase_url: https://old\nopus_model: o\n"})
+
+	if err := Write(loc.User, map[string]string{"resource": "new-res", "opus_model": ""}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	data, err := os.ReadFile(loc.User)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "# mine\nresource: new-res\n" {
+		t.Errorf("Expected base_url and opus_model to be replaced, got %q", got)
+	}
+
+	project := loc.Path(ScopeProject)
+	if err := Write(project, map[string]string{"haiku_model": "h"}); err != nil {
+		t.Fatal(err)
+	}
+	if project != filepath.Join(loc.Cwd, ProjectFile) {
+		t.Errorf("Expected a new project file in the working directory, got %s", project)
+	}
+
+	if err := Write(loc.User, map[string]string{"model": "x"}); err == nil {
+		t.Error("Expected an error for an unknown setting")
+	}
+}
+
+func TestWithValues(t *testing.T) {
+	layer := Layer{Scope: ScopeUser, Values: map[string]string{"resource": "res", "sonnet_model": "s"}}
+	updated := layer.WithValues(map[string]string{"base_url": "https://example.com", "sonnet_model": ""})
+
+	if len(updated.Values) != 1 || updated.Values["base_url"] != "https://example.com" {
+		t.Errorf("Expected only base_url to be left, got %v", updated.Values)
+	}
+	if layer.Values["resource"] != "res" || layer.Values["sonnet_model"] != "s" {
+		t.Errorf("Expected the original layer to be unchanged, got %v", layer.Values)
+	}
+}
@@ -0,0 +1,166 @@
+package layers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The layer files use a flat subset of YAML: one `key: value` pair per
+// line, `#` comments and blank lines. Values may be plain, 'single' or
+// "double" quoted. That is all a layer needs, and it keeps the tool free of
+// a YAML dependency.
+
+// yamlEntry is one `key: value` line of a layer file
+type yamlEntry struct {
+	key   string
+	value string
+	line  int // 1-based
+}
+
+// parseYAML reads the entries of a flat YAML document
+func parseYAML(content string) ([]yamlEntry, error) {
+	entries := []yamlEntry{}
+	for i, raw := range strings.Split(content, "\n") {
+		line := strings.TrimSpace(strings.TrimPrefix(raw, "\ufeff"))
+		if line == "" || strings.HasPrefix(line, "#") || line == "---" {
+			continue
+		}
+
+		key, rest, ok := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t\"'") {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", i+1)
+		}
+
+		value, err := parseYAMLValue(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		entries = append(entries, yamlEntry{key: key, value: value, line: i + 1})
+	}
+	return entries, nil
+}
+
+// parseYAMLValue reads a scalar, dropping a trailing comment
+func parseYAMLValue(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := closingQuote(s)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated double quote")
+		}
+		if rest := strings.TrimSpace(s[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected text after quoted value")
+		}
+		value, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return "", fmt.Errorf("invalid double-quoted value")
+		}
+		return value, nil
+	case strings.HasPrefix(s, "'"):
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			if s[i] != '\'' {
+				b.WriteByte(s[i])
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			if rest := strings.TrimSpace(s[i+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+				return "", fmt.Errorf("unexpected text after quoted value")
+			}
+			return b.String(), nil
+		}
+		return "", fmt.Errorf("unterminated single quote")
+	case strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{") || strings.HasPrefix(s, "|") || strings.HasPrefix(s, ">"):
+		return "", fmt.Errorf("only plain and quoted values are supported")
+	}
+
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if s == "~" || s == "null" {
+		return "", nil
+	}
+	return s, nil
+}
+
+// closingQuote returns the index of the quote closing the double-quoted
+// string at the start of s, or -1
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// formatYAMLValue writes value plain when that is unambiguous and double
+// quoted otherwise
+func formatYAMLValue(value string) string {
+	plain := value != ""
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.IndexByte("-_./:@", c) >= 0 && i > 0:
+		default:
+			plain = false
+		}
+	}
+	if plain && value != "null" && value != "true" && value != "false" {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+// updateYAML returns content with the given keys set (or removed when the
+// value is ""), keeping comments and other keys in place. New keys are
+// appended in the given order.
+func updateYAML(content string, keys []string, values map[string]string) string {
+	lines := strings.Split(content, "\n")
+	if content == "" {
+		lines = nil
+	}
+	done := make(map[string]bool)
+
+	out := make([]string, 0, len(lines)+len(keys))
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		key, _, ok := strings.Cut(trimmed, ":")
+		key = strings.TrimSpace(key)
+		value, managed := values[key]
+		if !ok || strings.HasPrefix(trimmed, "#") || !managed {
+			out = append(out, line)
+			continue
+		}
+		if done[key] || value == "" {
+			continue // duplicate or removed
+		}
+		out = append(out, key+": "+formatYAMLValue(value))
+		done[key] = true
+	}
+
+	// Drop the trailing empty line so new keys go before the final newline
+	if len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	for _, key := range keys {
+		if value := values[key]; value != "" && !done[key] {
+			out = append(out, key+": "+formatYAMLValue(value))
+		}
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	return strings.Join(out, "\n") + "\n"
+}
@@ -0,0 +1,252 @@
+package profiles
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+// AnthropicProfile is the built-in profile that switches back to the direct
+// Anthropic API (a rollback)
+const AnthropicProfile = "anthropic"
+
+// Profile is a named Foundry setup that can be applied with Apply
+type Profile struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Foundry is nil for the anthropic profile
+	Foundry   *config.FoundryConfig `json:"foundry,omitempty"`
+	CreatedAt time.Time             `json:"created_at"`
+	UpdatedAt time.Time             `json:"updated_at"`
+}
+
+// Difference is one variable that two profiles set differently
+type Difference struct {
+	Key string
+	A   string
+	B   string
+}
+
+// GetProfileDir returns the directory where profiles are stored
+func GetProfileDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic("failed to get home directory")
+	}
+	return filepath.Join(config.ConfigDir(home), "profiles")
+}
+
+// ValidateName checks that name can be used as a profile (and file) name
+func ValidateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("profile name is required")
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return fmt.Errorf("invalid profile name %q: use letters, digits, '-', '_' and '.'", name)
+		}
+	}
+	if strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid profile name %q: must not start with '.'", name)
+	}
+	return nil
+}
+
+// IsAnthropic reports whether applying the profile rolls back to the
+// direct Anthropic API
+func (p *Profile) IsAnthropic() bool {
+	return p.Foundry == nil
+}
+
+// Vars returns the environment variables applying the profile sets
+func (p *Profile) Vars() map[string]string {
+	if p.IsAnthropic() {
+		return map[string]string{}
+	}
+	return config.FoundryVars(p.Foundry)
+}
+
+// Apply writes the profile's configuration to the store. Extra variables
+// set with --env are kept.
+func Apply(store config.EnvStore, p *Profile) error {
+	if p.IsAnthropic() {
+		return config.ApplyProvider(store, config.Anthropic, nil)
+	}
+	return config.ApplyFoundryConfig(store, p.Foundry)
+}
+
+// CreateProfile saves a new profile, failing if the name is taken
+func CreateProfile(p *Profile) error {
+	if err := ValidateName(p.Name); err != nil {
+		return err
+	}
+	if p.Name == AnthropicProfile {
+		return fmt.Errorf("%q is a built-in profile", AnthropicProfile)
+	}
+	if p.Foundry == nil {
+		return fmt.Errorf("profile %q has no Foundry configuration", p.Name)
+	}
+	if _, err := os.Stat(profilePath(p.Name)); err == nil {
+		return fmt.Errorf("profile %q already exists", p.Name)
+	}
+
+	now := time.Now()
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	return writeProfile(p)
+}
+
+// SaveProfile overwrites an existing profile, e.g. after editing it
+func SaveProfile(p *Profile) error {
+	if p.Name == AnthropicProfile {
+		return fmt.Errorf("the built-in %q profile cannot be changed", AnthropicProfile)
+	}
+	if _, err := LoadProfile(p.Name); err != nil {
+		return err
+	}
+
+	p.UpdatedAt = time.Now()
+	return writeProfile(p)
+}
+
+// LoadProfile reads the named profile
+func LoadProfile(name string) (*Profile, error) {
+	if name == AnthropicProfile {
+		return anthropic(), nil
+	}
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(profilePath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("profile %q not found", name)
+		}
+		return nil, fmt.Errorf("failed to read profile: %w", err)
+	}
+
+	var p Profile
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse profile %q: %w", name, err)
+	}
+	p.Name = name
+	if p.Foundry == nil {
+		p.Foundry = &config.FoundryConfig{}
+	}
+	return &p, nil
+}
+
+// ListProfiles returns the built-in anthropic profile followed by the
+// saved profiles sorted by name
+func ListProfiles() ([]*Profile, error) {
+	profiles := []*Profile{anthropic()}
+
+	entries, err := os.ReadDir(GetProfileDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return profiles, nil
+		}
+		return nil, fmt.Errorf("failed to read profile directory: %w", err)
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p, err := LoadProfile(name)
+		if err != nil {
+			continue // Skip files that can't be read
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// DeleteProfile removes a saved profile
+func DeleteProfile(name string) error {
+	if name == AnthropicProfile {
+		return fmt.Errorf("the built-in %q profile cannot be deleted", AnthropicProfile)
+	}
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	if err := os.Remove(profilePath(name)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("profile %q not found", name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Diff returns the variables a and b set differently, sorted by name
+func Diff(a, b map[string]string) []Difference {
+	keys := []string{}
+	for key := range a {
+		if a[key] != b[key] {
+			keys = append(keys, key)
+		}
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	diffs := make([]Difference, len(keys))
+	for i, key := range keys {
+		diffs[i] = Difference{Key: key, A: a[key], B: b[key]}
+	}
+	return diffs
+}
+
+// Matches reports whether vars (e.g. the current configuration) is exactly
+// what applying the profile would produce. Extra variables are ignored
+// since profiles leave them alone.
+func (p *Profile) Matches(vars map[string]string) bool {
+	return len(Diff(p.Vars(), config.ProviderVars(vars))) == 0
+}
+
+// anthropic returns the built-in anthropic profile
+func anthropic() *Profile {
+	return &Profile{Name: AnthropicProfile, Description: "Direct Anthropic API (removes the Foundry configuration)"}
+}
+
+// profilePath returns the file holding the named profile
+func profilePath(name string) string {
+	return filepath.Join(GetProfileDir(), name+".json")
+}
+
+// writeProfile stores p, readable only by the user since it may hold an
+// API key
+func writeProfile(p *Profile) error {
+	if err := os.MkdirAll(GetProfileDir(), 0700); err != nil {
+		return fmt.Errorf("failed to create profile directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal profile: %w", err)
+	}
+
+	if err := os.WriteFile(profilePath(p.Name), data, 0600); err != nil {
+		return fmt.Errorf("failed to write profile: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package profiles
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+// useTempHome points the profile directory at a temporary home
+func useTempHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+}
+
+func TestCreateLoadAndList(t *testing.T) {
+	useTempHome(t)
+
+	dev := &Profile{Name: "dev", Description: "Dev", Foundry: &config.FoundryConfig{Resource: "dev-res", APIKey: "secret"}}
+	if err := CreateProfile(dev); err != nil {
+		t.Fatalf("CreateProfile failed: %v", err)
+	}
+	if err := CreateProfile(&Profile{Name: "dev", Foundry: &config.FoundryConfig{Resource: "x"}}); err == nil {
+		t.Error("Expected an error for a duplicate profile")
+	}
+	if err := CreateProfile(&Profile{Name: "prod", Foundry: &config.FoundryConfig{BaseURL: "https://prod"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadProfile("dev")
+	if err != nil {
+		t.Fatalf("LoadProfile failed: %v", err)
+	}
+	if loaded.Foundry.Resource != "dev-res" || loaded.Foundry.APIKey != "secret" || loaded.Description != "Dev" {
+		t.Errorf("Unexpected profile: %+v", loaded)
+	}
+
+	info, err := os.Stat(profilePath("dev"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+
+	list, err := ListProfiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, p := range list {
+		names = append(names, p.Name)
+	}
+	if len(names) != 3 || names[0] != AnthropicProfile || names[1] != "dev" || names[2] != "prod" {
+		t.Errorf("Unexpected profile list: %v", names)
+	}
+}
+
+func TestBuiltInAnthropicProfile(t *testing.T) {
+	useTempHome(t)
+
+	if err := CreateProfile(&Profile{Name: AnthropicProfile, Foundry: &config.FoundryConfig{Resource: "x"}}); err == nil {
+		t.Error("Expected an error when creating a profile named anthropic")
+	}
+	if err := DeleteProfile(AnthropicProfile); err == nil {
+		t.Error("Expected an error when deleting the anthropic profile")
+	}
+
+	store := config.NewMemoryStore()
+	store.Set(config.EnvUseFoundry, "true")
+	store.Set(config.EnvFoundryResource, "res")
+
+	p, err := LoadProfile(AnthropicProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(store, p); err != nil {
+		t.Fatal(err)
+	}
+	vars, _ := store.List()
+	if len(vars) != 0 {
+		t.Errorf("Expected the anthropic profile to clear the store, got %v", vars)
+	}
+	if !p.Matches(vars) {
+		t.Error("Expected the anthropic profile to match an empty configuration")
+	}
+}
+
+func TestApplyReplacesPreviousProfile(t *testing.T) {
+	store := config.NewMemoryStore()
+	dev := &Profile{Name: "dev", Foundry: &config.FoundryConfig{Resource: "dev-res", APIKey: "secret"}}
+	prod := &Profile{Name: "prod", Foundry: &config.FoundryConfig{BaseURL: "https://prod"}}
+
+	if err := Apply(store, dev); err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(store, prod); err != nil {
+		t.Fatal(err)
+	}
+
+	vars, _ := store.List()
+	if !prod.Matches(vars) || dev.Matches(vars) {
+		t.Errorf("Expected only prod to match, got %v", vars)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	diffs := Diff(map[string]string{"A": "1", "B": "2"}, map[string]string{"B": "3", "C": "4"})
+	expected := []Difference{{"A", "1", ""}, {"B", "2", "3"}, {"C", "", "4"}}
+	if len(diffs) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, diffs)
+	}
+	for i := range expected {
+		if diffs[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], diffs[i])
+		}
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"dev", "prod-eu_1", "v1.2"} {
+		if err := ValidateName(name); err != nil {
+			t.Errorf("Expected %q to be valid: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "../x", "a/b", ".hidden", "with space"} {
+		if err := ValidateName(name); err == nil {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+	}
+}
+
+func TestDeleteProfile(t *testing.T) {
+	useTempHome(t)
+
+	if err := CreateProfile(&Profile{Name: "dev", Foundry: &config.FoundryConfig{Resource: "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteProfile("dev"); err != nil {
+		t.Fatalf("DeleteProfile failed: %v", err)
+	}
+	if _, err := LoadProfile("dev"); err == nil {
+		t.Error("Expected the profile to be gone")
+	}
+	if err := DeleteProfile("dev"); err == nil {
+		t.Error("Expected an error when deleting a missing profile")
+	}
+}
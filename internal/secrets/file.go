@@ -0,0 +1,213 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+// The file backend encrypts the secret with AES-256-GCM under a random key
+// kept next to it, both readable only by the user. This keeps the key out
+// of dotfile repositories, backups and screen shares; it does not protect
+// against someone who can read files as the user.
+
+const (
+	keyFile = "key"
+	// newKeyFile holds the key of a rotation until the secret is encrypted
+	// under it
+	newKeyFile = "key.new"
+	secretFile = "api-key.enc"
+	// secretAAD binds the ciphertext to its purpose
+	secretAAD = "claude-foundry-manager api-key v1"
+)
+
+// ErrNoSecret is returned when no secret has been stored
+var ErrNoSecret = errors.New("no API key stored, run 'claude-foundry-manager secret set'")
+
+// FileStore keeps the secret encrypted in dir
+type FileStore struct {
+	dir string
+}
+
+// encryptedSecret is the content of the secret file
+type encryptedSecret struct {
+	Version    int    `json:"version"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// NewFileStore returns a store keeping the secret in dir
+func NewFileStore(dir string) *FileStore {
+	return &FileStore{dir: dir}
+}
+
+// Get decrypts the secret
+func (f *FileStore) Get() (string, error) {
+	data, err := os.ReadFile(filepath.Join(f.dir, secretFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrNoSecret
+		}
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	key, err := os.ReadFile(filepath.Join(f.dir, keyFile))
+	if err != nil {
+		return "", fmt.Errorf("failed to read encryption key: %w", err)
+	}
+	// A rotation that stopped after encrypting the secret under the new key
+	// left that key in newKeyFile
+	newKey, _ := os.ReadFile(filepath.Join(f.dir, newKeyFile))
+
+	var enc encryptedSecret
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return "", fmt.Errorf("failed to parse secret: %w", err)
+	}
+	if enc.Version != 1 {
+		return "", fmt.Errorf("unsupported secret version %d", enc.Version)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(enc.Nonce)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse secret: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(enc.Ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse secret: %w", err)
+	}
+
+	plaintext, err := decrypt(key, nonce, ciphertext)
+	if err != nil && newKey != nil {
+		if fromNew, newErr := decrypt(newKey, nonce, ciphertext); newErr == nil {
+			return fromNew, nil
+		}
+	}
+	return plaintext, err
+}
+
+// decrypt opens the secret ciphertext with key
+func decrypt(key, nonce, ciphertext []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return "", fmt.Errorf("failed to parse secret: bad nonce")
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(secretAAD))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret (was the key file replaced?): %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// Set encrypts value, creating the encryption key on first use
+func (f *FileStore) Set(value string) error {
+	key, err := os.ReadFile(filepath.Join(f.dir, keyFile))
+	if os.IsNotExist(err) {
+		return f.Rotate(value)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read encryption key: %w", err)
+	}
+	return f.write(key, value)
+}
+
+// Rotate stores value under a freshly generated encryption key. The new
+// key is written next to the old one, the secret is encrypted under it and
+// only then does it replace the old key, so Get finds the key of the
+// secret wherever a rotation stops.
+func (f *FileStore) Rotate(value string) error {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return fmt.Errorf("failed to generate encryption key: %w", err)
+	}
+	if err := os.MkdirAll(f.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+
+	newKey := filepath.Join(f.dir, newKeyFile)
+	if err := writePrivate(newKey, key); err != nil {
+		return fmt.Errorf("failed to write encryption key: %w", err)
+	}
+	if err := f.write(key, value); err != nil {
+		os.Remove(newKey)
+		return err
+	}
+	if err := os.Rename(newKey, filepath.Join(f.dir, keyFile)); err != nil {
+		return fmt.Errorf("failed to write encryption key: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the secret and its encryption key
+func (f *FileStore) Delete() error {
+	for _, name := range []string{secretFile, keyFile, newKeyFile} {
+		if err := os.Remove(filepath.Join(f.dir, name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Describe names the encrypted file
+func (f *FileStore) Describe() string {
+	return "encrypted file " + filepath.Join(f.dir, secretFile)
+}
+
+// write encrypts value with key into the secret file
+func (f *FileStore) write(key []byte, value string) error {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	data, err := json.MarshalIndent(encryptedSecret{
+		Version:    1,
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, []byte(value), []byte(secretAAD))),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal secret: %w", err)
+	}
+	if err := writePrivate(filepath.Join(f.dir, secretFile), data); err != nil {
+		return fmt.Errorf("failed to write secret: %w", err)
+	}
+	return nil
+}
+
+// newGCM returns AES-GCM for a 32-byte key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid encryption key length %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// writePrivate atomically replaces path with data, readable only by the
+// user
+func writePrivate(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := config.WriteFileAtomic(path, data, 0600); err != nil {
+		return err
+	}
+	// WriteFileAtomic keeps the mode of an existing file
+	return os.Chmod(path, 0600)
+}
@@ -0,0 +1,208 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Azure Key Vault references read the key from a vault secret, so a key
+// rotated in the vault reaches the configuration with refresh-secrets:
+//
+//	keyvault:https://myvault.vault.azure.net/secrets/foundry-key
+//	keyvault:https://myvault.vault.azure.net/secrets/foundry-key/<version>
+//	keyvault:myvault/foundry-key
+//
+// The vault is called with an Entra access token for Key Vault, taken from
+// AZURE_KEYVAULT_TOKEN or else from "az account get-access-token".
+
+// RefKeyVault is the prefix of Key Vault references
+const RefKeyVault = "keyvault:"
+
+// KeyVaultTokenEnv holds an Entra access token for Key Vault, used instead
+// of the az CLI when set
+const KeyVaultTokenEnv = "AZURE_KEYVAULT_TOKEN"
+
+// keyVaultAPIVersion is the Key Vault REST API version used
+const keyVaultAPIVersion = "7.4"
+
+// keyVaultResource is the resource Key Vault access tokens are issued for
+const keyVaultResource = "https://vault.azure.net"
+
+// keyVaultSuffixes are the DNS suffixes of the vaults in the Azure clouds.
+// The access token is only ever sent to hosts under one of them.
+var keyVaultSuffixes = []string{
+	".vault.azure.net",
+	".vault.azure.cn",
+	".vault.usgovcloudapi.net",
+	".vault.microsoftazure.de",
+}
+
+// KeyVaultSecret identifies a secret in a vault
+type KeyVaultSecret struct {
+	VaultURL string // e.g. https://myvault.vault.azure.net
+	Name     string
+	Version  string // empty for the current version
+}
+
+// ParseKeyVaultRef parses a Key Vault reference, with or without its
+// keyvault: prefix
+func ParseKeyVaultRef(ref string) (KeyVaultSecret, error) {
+	value := strings.TrimPrefix(ref, RefKeyVault)
+
+	if !strings.Contains(value, "://") {
+		vault, name, ok := strings.Cut(value, "/")
+		if !ok || vault == "" || name == "" || strings.Contains(name, "/") || strings.ContainsAny(vault, ".:@") {
+			return KeyVaultSecret{}, fmt.Errorf("invalid Key Vault reference %q, use keyvault:VAULT/SECRET or keyvault:https://VAULT.vault.azure.net/secrets/SECRET", ref)
+		}
+		return KeyVaultSecret{VaultURL: "https://" + vault + ".vault.azure.net", Name: name}, nil
+	}
+
+	u, err := url.Parse(value)
+	if err != nil {
+		return KeyVaultSecret{}, fmt.Errorf("invalid Key Vault reference %q: %w", ref, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return KeyVaultSecret{}, fmt.Errorf("invalid Key Vault reference %q: the vault URL must use https", ref)
+	}
+	if !isKeyVaultHost(u) {
+		return KeyVaultSecret{}, fmt.Errorf("invalid Key Vault reference %q: %s is not a Key Vault host (*%s)", ref, u.Host, strings.Join(keyVaultSuffixes, ", *"))
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] != "secrets" || parts[1] == "" {
+		return KeyVaultSecret{}, fmt.Errorf("invalid Key Vault reference %q, expected a /secrets/NAME[/VERSION] path", ref)
+	}
+
+	secret := KeyVaultSecret{VaultURL: u.Scheme + "://" + u.Host, Name: parts[1]}
+	if len(parts) == 3 {
+		secret.Version = parts[2]
+	}
+	return secret, nil
+}
+
+// isKeyVaultHost reports whether u names a vault, by host alone, under one
+// of the Key Vault DNS suffixes
+func isKeyVaultHost(u *url.URL) bool {
+	if u.User != nil || u.Port() != "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, suffix := range keyVaultSuffixes {
+		if vault := strings.TrimSuffix(host, suffix); vault != host && vault != "" && !strings.Contains(vault, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyVault reads secrets through the Key Vault REST API
+type KeyVault struct {
+	// Client sends the requests; tests point it at a local server
+	Client *http.Client
+	// Token returns an Entra access token for Key Vault
+	Token func(ctx context.Context) (string, error)
+}
+
+// NewKeyVault returns a client using the default HTTP client and tokens
+// from AZURE_KEYVAULT_TOKEN or the az CLI
+func NewKeyVault() *KeyVault {
+	return &KeyVault{
+		Client: &http.Client{Timeout: 30 * time.Second},
+		Token:  AzureToken,
+	}
+}
+
+// defaultKeyVault resolves keyvault: references
+var defaultKeyVault = NewKeyVault()
+
+// keyVaultError is the error body Key Vault returns
+type keyVaultError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// GetSecret returns the value of the secret
+func (k *KeyVault) GetSecret(ctx context.Context, secret KeyVaultSecret) (string, error) {
+	token, err := k.Token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get a Key Vault access token: %w", err)
+	}
+
+	endpoint := secret.VaultURL + "/secrets/" + url.PathEscape(secret.Name)
+	if secret.Version != "" {
+		endpoint += "/" + url.PathEscape(secret.Version)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?api-version="+keyVaultAPIVersion, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := k.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach Key Vault: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read Key Vault response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var e keyVaultError
+		if json.Unmarshal(body, &e) == nil && e.Error.Code != "" {
+			return "", fmt.Errorf("Key Vault returned %s for %s: %s: %s", resp.Status, secret.Name, e.Error.Code, e.Error.Message)
+		}
+		return "", fmt.Errorf("Key Vault returned %s for %s", resp.Status, secret.Name)
+	}
+
+	var bundle struct {
+		Value *string `json:"value"`
+	}
+	if err := json.Unmarshal(body, &bundle); err != nil {
+		return "", fmt.Errorf("failed to parse Key Vault response: %w", err)
+	}
+	if bundle.Value == nil {
+		return "", fmt.Errorf("Key Vault returned no value for %s", secret.Name)
+	}
+	return *bundle.Value, nil
+}
+
+// AzureToken returns an Entra access token for Key Vault from
+// AZURE_KEYVAULT_TOKEN, or else from the az CLI
+func AzureToken(ctx context.Context) (string, error) {
+	if token := strings.TrimSpace(os.Getenv(KeyVaultTokenEnv)); token != "" {
+		return token, nil
+	}
+	out, err := run(exec.CommandContext(ctx, "az", "account", "get-access-token",
+		"--resource", keyVaultResource, "--query", "accessToken", "--output", "tsv"), "")
+	if err != nil {
+		return "", fmt.Errorf("set %s or sign in with 'az login': %w", KeyVaultTokenEnv, err)
+	}
+	token := strings.TrimSpace(out)
+	if token == "" {
+		return "", fmt.Errorf("az returned an empty access token")
+	}
+	return token, nil
+}
+
+// resolveKeyVault resolves a keyvault: reference with the default client
+func resolveKeyVault(ref string) (string, error) {
+	secret, err := ParseKeyVaultRef(ref)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	return defaultKeyVault.GetSecret(ctx, secret)
+}
@@ -0,0 +1,128 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeKeyVault mimics the Key Vault "get secret" REST API
+func fakeKeyVault(secrets map[string]string) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.Header().Set("WWW-Authenticate", `Bearer authorization="https://login.microsoftonline.com/tenant", resource="https://vault.azure.net"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"code": "Unauthorized", "message": "AKV10000: Request is missing a Bearer or PoP token."}})
+			return
+		}
+		if r.Method != http.MethodGet || r.URL.Query().Get("api-version") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"code": "BadParameter", "message": "The request URI contains an invalid API version."}})
+			return
+		}
+
+		// /secrets/{name} or /secrets/{name}/{version}
+		path := strings.TrimPrefix(r.URL.Path, "/secrets/")
+		value, ok := secrets[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"code": "SecretNotFound", "message": "A secret with (name/id) " + path + " was not found in this key vault."}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"value":      value,
+			"id":         "https://" + r.Host + r.URL.Path + "/0123456789abcdef",
+			"attributes": map[string]any{"enabled": true},
+		})
+	}))
+}
+
+func testKeyVault(server *httptest.Server, token string) *KeyVault {
+	return &KeyVault{
+		Client: server.Client(),
+		Token:  func(context.Context) (string, error) { return token, nil },
+	}
+}
+
+func TestKeyVaultGetSecret(t *testing.T) {
+	server := fakeKeyVault(map[string]string{
+		"foundry-key":     "sk-current",
+		"foundry-key/abc": "sk-old",
+	})
+	defer server.Close()
+	kv := testKeyVault(server, "test-token")
+	ctx := context.Background()
+
+	got, err := kv.GetSecret(ctx, KeyVaultSecret{VaultURL: server.URL, Name: "foundry-key"})
+	if err != nil || got != "sk-current" {
+		t.Errorf("Expected the current version, got %q, %v", got, err)
+	}
+	got, err = kv.GetSecret(ctx, KeyVaultSecret{VaultURL: server.URL, Name: "foundry-key", Version: "abc"})
+	if err != nil || got != "sk-old" {
+		t.Errorf("Expected the pinned version, got %q, %v", got, err)
+	}
+
+	if _, err := kv.GetSecret(ctx, KeyVaultSecret{VaultURL: server.URL, Name: "missing"}); err == nil || !strings.Contains(err.Error(), "SecretNotFound") {
+		t.Errorf("Expected a SecretNotFound error, got %v", err)
+	}
+	if _, err := testKeyVault(server, "wrong").GetSecret(ctx, KeyVaultSecret{VaultURL: server.URL, Name: "foundry-key"}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected a 401 error, got %v", err)
+	}
+}
+
+func TestResolveKeyVaultRef(t *testing.T) {
+	server := fakeKeyVault(map[string]string{"foundry-key": "sk-from-vault"})
+	defer server.Close()
+
+	saved := defaultKeyVault
+	defer func() { defaultKeyVault = saved }()
+	defaultKeyVault = testKeyVault(server, "test-token")
+	// Send the requests for the vault host to the local server, which
+	// holds a certificate for example.com
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+	}
+	transport.TLSClientConfig.ServerName = "example.com"
+	defaultKeyVault.Client = &http.Client{Transport: transport}
+
+	got, err := Resolve("keyvault:https://myvault.vault.azure.net/secrets/foundry-key")
+	if err != nil || got != "sk-from-vault" {
+		t.Errorf("Expected the vault secret, got %q, %v", got, err)
+	}
+}
+
+func TestParseKeyVaultRef(t *testing.T) {
+	cases := map[string]KeyVaultSecret{
+		"keyvault:myvault/foundry-key":                                     {VaultURL: "https://myvault.vault.azure.net", Name: "foundry-key"},
+		"keyvault:https://myvault.vault.azure.net/secrets/foundry-key":     {VaultURL: "https://myvault.vault.azure.net", Name: "foundry-key"},
+		"keyvault:https://myvault.vault.azure.net/secrets/foundry-key/v1/": {VaultURL: "https://myvault.vault.azure.net", Name: "foundry-key", Version: "v1"},
+		"keyvault:https://govvault.vault.usgovcloudapi.net/secrets/key":    {VaultURL: "https://govvault.vault.usgovcloudapi.net", Name: "key"},
+	}
+	for ref, want := range cases {
+		if got, err := ParseKeyVaultRef(ref); err != nil || got != want {
+			t.Errorf("ParseKeyVaultRef(%q) = %+v, %v; expected %+v", ref, got, err, want)
+		}
+	}
+
+	for _, ref := range []string{
+		"keyvault:myvault",
+		"keyvault:http://myvault.vault.azure.net/secrets/x",
+		"keyvault:https://myvault.vault.azure.net/keys/x",
+		"keyvault:https://attacker.example.com/secrets/x",
+		"keyvault:https://vault.azure.net.attacker.example.com/secrets/x",
+		"keyvault:https://a.b.vault.azure.net/secrets/x",
+		"keyvault:https://myvault.vault.azure.net:8443/secrets/x",
+		"keyvault:https://user@myvault.vault.azure.net/secrets/x",
+		"keyvault:myvault.example.com/x",
+	} {
+		if _, err := ParseKeyVaultRef(ref); err == nil {
+			t.Errorf("Expected an error for %q", ref)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A secret reference names where a key comes from instead of holding it,
+// so it stays out of shell history, ps output and backups:
+//
+//	env:FOUNDRY_KEY              a variable of the environment configure runs in
+//	file:/run/secrets/foundry    the content of a file
+//	cmd:az keyvault secret ...   the output of a command
+//	keyvault:myvault/foundry-key a secret in Azure Key Vault (see keyvault.go)
+//
+// References are resolved when the configuration is applied.
+
+// Reference prefixes
+const (
+	RefEnv     = "env:"
+	RefFile    = "file:"
+	RefCommand = "cmd:"
+)
+
+// IsRef reports whether value is a secret reference
+func IsRef(value string) bool {
+	for _, prefix := range []string{RefEnv, RefFile, RefCommand, RefKeyVault} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the secret value names, or value itself when it is not a
+// reference. Surrounding whitespace, such as the newline ending a file or
+// command output, is trimmed.
+func Resolve(value string) (string, error) {
+	var resolved string
+	switch {
+	case strings.HasPrefix(value, RefEnv):
+		name := strings.TrimPrefix(value, RefEnv)
+		resolved = os.Getenv(name)
+		if strings.TrimSpace(resolved) == "" {
+			return "", fmt.Errorf("%s: %s is not set", value, name)
+		}
+	case strings.HasPrefix(value, RefFile):
+		path, err := expandHome(strings.TrimPrefix(value, RefFile))
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", value, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", value, err)
+		}
+		resolved = string(data)
+	case strings.HasPrefix(value, RefCommand):
+		command := strings.TrimPrefix(value, RefCommand)
+		if strings.TrimSpace(command) == "" {
+			return "", fmt.Errorf("%s: no command given", value)
+		}
+		out, err := run(shellCommand(command), "")
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", value, err)
+		}
+		resolved = out
+	case strings.HasPrefix(value, RefKeyVault):
+		out, err := resolveKeyVault(value)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", value, err)
+		}
+		resolved = out
+	default:
+		return value, nil
+	}
+
+	resolved = strings.TrimSpace(resolved)
+	if resolved == "" {
+		return "", fmt.Errorf("%s resolved to an empty value", value)
+	}
+	if strings.ContainsAny(resolved, "\r\n") {
+		return "", fmt.Errorf("%s resolved to more than one line", value)
+	}
+	return resolved, nil
+}
+
+// expandHome replaces a leading ~ with the home directory
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
@@ -0,0 +1,266 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+// The API key can be kept out of the shell profile. Claude Code then asks
+// for it through its apiKeyHelper setting, which runs
+// "claude-foundry-manager secret get", and that reads it from one of these
+// backends.
+
+// Backend names
+const (
+	BackendFile    = "file"    // AES-GCM encrypted file in the config directory
+	BackendPass    = "pass"    // the pass password manager
+	BackendCommand = "command" // a user-supplied command that prints the key
+)
+
+// Settings tells which backend holds the API key. They are saved in the
+// secrets directory so that "secret get" finds the key again.
+type Settings struct {
+	Backend   string `json:"backend"`
+	PassEntry string `json:"pass_entry,omitempty"`
+	Command   string `json:"command,omitempty"`
+}
+
+// Store keeps one secret, the API key
+type Store interface {
+	Get() (string, error)
+	Set(value string) error
+	Delete() error
+	// Describe tells the user where the secret is kept
+	Describe() string
+}
+
+// DefaultPassEntry is the pass entry used when none is given
+const DefaultPassEntry = "claude-foundry-manager/api-key"
+
+// settingsFile is the name of the backend settings in the secrets directory
+const settingsFile = "backend.json"
+
+// GetSecretsDir returns the directory holding the secret and its settings
+func GetSecretsDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic("failed to get home directory")
+	}
+	return filepath.Join(config.ConfigDir(home), "secrets")
+}
+
+// LoadSettings reads the backend settings, defaulting to the encrypted file
+func LoadSettings() (Settings, error) {
+	data, err := os.ReadFile(filepath.Join(GetSecretsDir(), settingsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Settings{Backend: BackendFile}, nil
+		}
+		return Settings{}, fmt.Errorf("failed to read secret settings: %w", err)
+	}
+
+	var s Settings
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Settings{}, fmt.Errorf("failed to parse secret settings: %w", err)
+	}
+	return s, nil
+}
+
+// SaveSettings stores the backend settings
+func SaveSettings(s Settings) error {
+	if _, err := Open(s); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(GetSecretsDir(), 0700); err != nil {
+		return fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal secret settings: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(GetSecretsDir(), settingsFile), data, 0600); err != nil {
+		return fmt.Errorf("failed to write secret settings: %w", err)
+	}
+	return nil
+}
+
+// Open returns the store for the given settings
+func Open(s Settings) (Store, error) {
+	switch s.Backend {
+	case BackendFile, "":
+		return NewFileStore(GetSecretsDir()), nil
+	case BackendPass:
+		entry := s.PassEntry
+		if entry == "" {
+			entry = DefaultPassEntry
+		}
+		return &PassStore{Entry: entry}, nil
+	case BackendCommand:
+		if strings.TrimSpace(s.Command) == "" {
+			return nil, fmt.Errorf("the command backend needs a command that prints the key")
+		}
+		return &CommandStore{Command: s.Command}, nil
+	}
+	return nil, fmt.Errorf("unknown secret backend %q (use file, pass or command)", s.Backend)
+}
+
+// OpenDefault returns the store of the saved settings
+func OpenDefault() (Store, error) {
+	s, err := LoadSettings()
+	if err != nil {
+		return nil, err
+	}
+	return Open(s)
+}
+
+// Rotate replaces the secret with value. Stores that encrypt also get a new
+// encryption key, so copies of the old file are useless.
+func Rotate(store Store, value string) error {
+	if r, ok := store.(interface{ Rotate(string) error }); ok {
+		return r.Rotate(value)
+	}
+	return store.Set(value)
+}
+
+// PassStore keeps the secret in the pass password manager
+type PassStore struct {
+	Entry string
+}
+
+// Get returns the first line of the pass entry
+func (p *PassStore) Get() (string, error) {
+	out, err := run(exec.Command("pass", "show", p.Entry), "")
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := strings.Cut(out, "\n")
+	return strings.TrimSpace(line), nil
+}
+
+// Set overwrites the pass entry
+func (p *PassStore) Set(value string) error {
+	_, err := run(exec.Command("pass", "insert", "--multiline", "--force", p.Entry), value+"\n")
+	return err
+}
+
+// Delete removes the pass entry
+func (p *PassStore) Delete() error {
+	_, err := run(exec.Command("pass", "rm", "--force", p.Entry), "")
+	return err
+}
+
+// Describe names the pass entry
+func (p *PassStore) Describe() string {
+	return "pass entry " + p.Entry
+}
+
+// CommandStore reads the secret from the output of a user-supplied
+// command. It cannot change the secret.
+type CommandStore struct {
+	Command string
+}
+
+// Get runs the command and returns its trimmed output
+func (c *CommandStore) Get() (string, error) {
+	out, err := run(shellCommand(c.Command), "")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// Set fails, the command's source has to be updated instead
+func (c *CommandStore) Set(string) error {
+	return fmt.Errorf("the key comes from %q, update it where that command reads it", c.Command)
+}
+
+// Delete fails like Set
+func (c *CommandStore) Delete() error {
+	return c.Set("")
+}
+
+// Describe shows the command
+func (c *CommandStore) Describe() string {
+	return "output of " + c.Command
+}
+
+// shellCommand runs command through the platform shell
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+// run executes cmd with stdin and returns its output, including stderr in
+// the error when it fails
+func run(cmd *exec.Cmd, stdin string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s failed: %w: %s", cmd.Args[0], err, msg)
+		}
+		return "", fmt.Errorf("%s failed: %w", cmd.Args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// HelperSetting is the Claude Code setting that runs a command to get the
+// API key
+const HelperSetting = "apiKeyHelper"
+
+// helperArgs are appended to the executable to form the helper command
+const helperArgs = "secret get"
+
+// HelperCommand returns the apiKeyHelper command for this executable
+func HelperCommand() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to find executable: %w", err)
+	}
+	if runtime.GOOS == "windows" {
+		return `"` + exe + `" ` + helperArgs, nil
+	}
+	return "'" + strings.ReplaceAll(exe, "'", `'\''`) + "' " + helperArgs, nil
+}
+
+// WireHelper points apiKeyHelper in the settings file at "secret get"
+func WireHelper(settings *config.SettingsStore) error {
+	command, err := HelperCommand()
+	if err != nil {
+		return err
+	}
+	return settings.SetSetting(HelperSetting, command)
+}
+
+// HelperWired reports whether apiKeyHelper in the settings file runs
+// "secret get", from this or an earlier install of the tool
+func HelperWired(settings *config.SettingsStore) (bool, error) {
+	value, err := settings.Setting(HelperSetting)
+	if err != nil {
+		return false, err
+	}
+	return strings.HasSuffix(value, " "+helperArgs), nil
+}
+
+// UnwireHelper removes apiKeyHelper from the settings file if it is ours;
+// a helper the user configured themselves is left alone
+func UnwireHelper(settings *config.SettingsStore) error {
+	wired, err := HelperWired(settings)
+	if err != nil || !wired {
+		return err
+	}
+	return settings.SetSetting(HelperSetting, "")
+}
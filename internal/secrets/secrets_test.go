@@ -0,0 +1,218 @@
+package secrets
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gilbe/claude-foundry-manager/internal/config"
+)
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "secrets")
+	store := NewFileStore(dir)
+
+	if _, err := store.Get(); err != ErrNoSecret {
+		t.Errorf("Expected ErrNoSecret before a key is set, got %v", err)
+	}
+	if err := store.Set("sk-plaintext-123"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, err := store.Get(); err != nil || got != "sk-plaintext-123" {
+		t.Errorf("Expected the stored key back, got %q, %v", got, err)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, secretFile))
+	if strings.Contains(string(data), "sk-plaintext-123") {
+		t.Error("Expected the secret file not to contain the key in plaintext")
+	}
+	if runtime.GOOS != "windows" {
+		for _, name := range []string{secretFile, keyFile} {
+			info, err := os.Stat(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("Expected %s to have mode 0600, got %v", name, info.Mode().Perm())
+			}
+		}
+	}
+}
+
+func TestFileStoreRotateAndDelete(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileStore(dir)
+	if err := store.Set("old"); err != nil {
+		t.Fatal(err)
+	}
+	oldKey, _ := os.ReadFile(filepath.Join(dir, keyFile))
+	oldSecret, _ := os.ReadFile(filepath.Join(dir, secretFile))
+
+	if err := Rotate(store, "new"); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	newKey, _ := os.ReadFile(filepath.Join(dir, keyFile))
+	if string(oldKey) == string(newKey) {
+		t.Error("Expected Rotate to generate a new encryption key")
+	}
+	if got, _ := store.Get(); got != "new" {
+		t.Errorf("Expected the rotated key, got %q", got)
+	}
+
+	// A copy of the old secret file is useless with the new key
+	if err := os.WriteFile(filepath.Join(dir, secretFile), oldSecret, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(); err == nil {
+		t.Error("Expected the old secret not to decrypt under the new key")
+	}
+
+	if err := store.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(); err != ErrNoSecret {
+		t.Errorf("Expected ErrNoSecret after Delete, got %v", err)
+	}
+}
+
+func TestFileStoreInterruptedRotate(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileStore(dir)
+	if err := store.Set("old"); err != nil {
+		t.Fatal(err)
+	}
+	oldKey, _ := os.ReadFile(filepath.Join(dir, keyFile))
+
+	// Stop the rotation after the new secret replaced the old one but
+	// before its key replaced the old key
+	if err := store.Rotate("new"); err != nil {
+		t.Fatal(err)
+	}
+	newKey, _ := os.ReadFile(filepath.Join(dir, keyFile))
+	if err := os.WriteFile(filepath.Join(dir, newKeyFile), newKey, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, keyFile), oldKey, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Get(); err != nil || got != "new" {
+		t.Errorf("Expected the secret to decrypt with the pending key, got %q, %v", got, err)
+	}
+
+	// Stopping before the secret was replaced leaves the old pair intact
+	if err := store.Set("old"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Get(); err != nil || got != "old" {
+		t.Errorf("Expected the old key to still decrypt the old secret, got %q, %v", got, err)
+	}
+
+	if err := store.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, newKeyFile)); !os.IsNotExist(err) {
+		t.Errorf("Expected Delete to remove the pending key, got %v", err)
+	}
+}
+
+func TestCommandStore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	store := &CommandStore{Command: "echo ' sk-from-command '"}
+	if got, err := store.Get(); err != nil || got != "sk-from-command" {
+		t.Errorf("Expected the trimmed command output, got %q, %v", got, err)
+	}
+	if err := store.Set("x"); err == nil {
+		t.Error("Expected Set to fail for the command backend")
+	}
+	if _, err := (&CommandStore{Command: "echo oops >&2; exit 3"}).Get(); err == nil || !strings.Contains(err.Error(), "oops") {
+		t.Errorf("Expected the command's stderr in the error, got %v", err)
+	}
+}
+
+func TestSettingsAndHelper(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	if s, err := LoadSettings(); err != nil || s.Backend != BackendFile {
+		t.Errorf("Expected the file backend by default, got %+v, %v", s, err)
+	}
+	if err := SaveSettings(Settings{Backend: "vault"}); err == nil {
+		t.Error("Expected an unknown backend to be refused")
+	}
+	if err := SaveSettings(Settings{Backend: BackendCommand}); err == nil {
+		t.Error("Expected the command backend without a command to be refused")
+	}
+	if err := SaveSettings(Settings{Backend: BackendPass, PassEntry: "work/foundry"}); err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenDefault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Describe() != "pass entry work/foundry" {
+		t.Errorf("Unexpected store: %s", store.Describe())
+	}
+
+	settings := config.NewSettingsStore(filepath.Join(home, ".claude", "settings.json"))
+	if err := WireHelper(settings); err != nil {
+		t.Fatal(err)
+	}
+	value, _ := settings.Setting(HelperSetting)
+	if wired, _ := HelperWired(settings); !wired {
+		t.Errorf("Expected apiKeyHelper to run secret get, got %q", value)
+	}
+	if err := UnwireHelper(settings); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := settings.Setting(HelperSetting); value != "" {
+		t.Errorf("Expected apiKeyHelper to be removed, got %q", value)
+	}
+
+	// A helper configured by the user is left alone
+	if err := settings.SetSetting(HelperSetting, "my-helper.sh"); err != nil {
+		t.Fatal(err)
+	}
+	if err := UnwireHelper(settings); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := settings.Setting(HelperSetting); value != "my-helper.sh" {
+		t.Errorf("Expected the user's apiKeyHelper to be kept, got %q", value)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "key")
+	if err := os.WriteFile(path, []byte("sk-from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_RESOLVE_KEY", "sk-from-env")
+
+	cases := map[string]string{
+		"sk-literal":           "sk-literal",
+		"env:TEST_RESOLVE_KEY": "sk-from-env",
+		"file:" + path:         "sk-from-file",
+	}
+	if runtime.GOOS != "windows" {
+		cases["cmd:printf 'sk-from-cmd\\n'"] = "sk-from-cmd"
+	}
+	for ref, want := range cases {
+		if got, err := Resolve(ref); err != nil || got != want {
+			t.Errorf("Resolve(%q) = %q, %v; expected %q", ref, got, err, want)
+		}
+	}
+
+	for _, ref := range []string{"env:TEST_RESOLVE_UNSET", "file:" + filepath.Join(dir, "missing"), "cmd:"} {
+		if _, err := Resolve(ref); err == nil {
+			t.Errorf("Expected an error for %q", ref)
+		}
+	}
+	if IsRef("sk-literal") || !IsRef("cmd:x") {
+		t.Error("Unexpected IsRef result")
+	}
+}
@@ -2,12 +2,15 @@ package ui
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/gilbe/claude-foundry-manager/internal/backup"
 	"github.com/gilbe/claude-foundry-manager/internal/config"
+	"github.com/gilbe/claude-foundry-manager/internal/profiles"
+	"github.com/gilbe/claude-foundry-manager/internal/secrets"
 )
 
 // Color codes for terminal output
@@ -23,13 +26,18 @@ const (
 
 var reader = bufio.NewReader(os.Stdin)
 
-// RunInteractive starts the interactive menu
-func RunInteractive() error {
+// store is the environment store the interactive session operates on
+var store config.EnvStore
+
+// RunInteractive starts the interactive menu against the given store
+func RunInteractive(s config.EnvStore) error {
+	store = s
+
 	for {
 		showBanner()
 		showMenu()
 
-		choice, err := readInput("Enter your choice (1-7): ")
+		choice, err := readInput("Enter your choice (1-9): ")
 		if err != nil {
 			return err
 		}
@@ -61,11 +69,19 @@ func RunInteractive() error {
 			if err := handleCreateBackup(); err != nil {
 				printError(fmt.Sprintf("Failed to create backup: %v", err))
 			}
-		case "7", "q", "quit", "exit":
+		case "7":
+			if err := handleUseProfile(); err != nil {
+				printError(fmt.Sprintf("Failed to switch profile: %v", err))
+			}
+		case "8":
+			if err := handlePruneBackups(); err != nil {
+				printError(fmt.Sprintf("Failed to prune backups: %v", err))
+			}
+		case "9", "q", "quit", "exit":
 			printInfo("\nGoodbye!")
 			return nil
 		default:
-			printError("Invalid choice. Please enter 1-7.")
+			printError("Invalid choice. Please enter 1-9.")
 		}
 
 		fmt.Println("\nPress Enter to continue...")
@@ -90,7 +106,9 @@ func showMenu() {
 	fmt.Println("  " + colorCyan + "[4]" + colorReset + " List Available Backups")
 	fmt.Println("  " + colorCyan + "[5]" + colorReset + " Restore from Backup")
 	fmt.Println("  " + colorCyan + "[6]" + colorReset + " Save Manual Backup")
-	fmt.Println("  " + colorRed + "[7]" + colorReset + " Exit")
+	fmt.Println("  " + colorGreen + "[7]" + colorReset + " Switch Profile")
+	fmt.Println("  " + colorCyan + "[8]" + colorReset + " Prune Old Backups")
+	fmt.Println("  " + colorRed + "[9]" + colorReset + " Exit")
 	fmt.Println()
 }
 
@@ -135,11 +153,18 @@ func handleConfigure() error {
 		return fmt.Errorf("invalid choice, please select 1 or 2")
 	}
 
-	apiKey, err := readInput("Enter API Key (leave empty for Entra ID): ")
+	apiKey, err := readInput("Enter API Key, or env:VAR, file:PATH or cmd:COMMAND to read it from there (leave empty for Entra ID): ")
 	if err != nil {
 		return err
 	}
 	apiKey = strings.TrimSpace(apiKey)
+	apiKeyRef := ""
+	if secrets.IsRef(apiKey) {
+		apiKeyRef = apiKey
+		if apiKey, err = secrets.Resolve(apiKeyRef); err != nil {
+			return err
+		}
+	}
 
 	sonnetModel, err := readInputWithDefault("Sonnet model deployment name", "claude-sonnet-4-5")
 	if err != nil {
@@ -165,7 +190,9 @@ func handleConfigure() error {
 		fmt.Printf("  Base URL: %s\n", baseURL)
 		fmt.Println("  (Will set ANTHROPIC_FOUNDRY_BASE_URL only)")
 	}
-	if apiKey != "" {
+	if apiKeyRef != "" {
+		fmt.Printf("  API Key: %s... (masked, from %s)\n", maskAPIKey(apiKey), apiKeyRef)
+	} else if apiKey != "" {
 		fmt.Printf("  API Key: %s... (masked)\n", maskAPIKey(apiKey))
 	} else {
 		fmt.Println("  API Key: (using Entra ID)")
@@ -185,8 +212,8 @@ func handleConfigure() error {
 	}
 
 	// Create backup
-	if err := backup.CreateAutoBackup("Before configuring Azure Foundry"); err != nil {
-		printWarning(fmt.Sprintf("Failed to create backup: %v", err))
+	if err := backup.CreateAutoBackup(store, "Before configuring Azure Foundry"); err != nil {
+		warnBackup(err)
 	}
 
 	// Apply configuration
@@ -199,9 +226,17 @@ func handleConfigure() error {
 		OpusModel:   opusModel,
 	}
 
-	if err := config.ApplyFoundryConfig(cfg); err != nil {
+	if err := config.ApplyFoundryConfig(store, cfg); err != nil {
+		return err
+	}
+	if err := config.RecordSecretRef(config.EnvFoundryAPIKey, apiKeyRef, apiKey); err != nil {
 		return err
 	}
+	if apiKey != "" {
+		if err := unwireKeyHelper(); err != nil {
+			return err
+		}
+	}
 
 	printSuccess("\n✓ Azure Foundry configuration applied successfully!")
 	printInfo("\nPlease restart your terminal for the changes to take effect.")
@@ -224,12 +259,15 @@ func handleRollback() error {
 	}
 
 	// Create backup
-	if err := backup.CreateAutoBackup("Before rollback to default"); err != nil {
-		printWarning(fmt.Sprintf("Failed to create backup: %v", err))
+	if err := backup.CreateAutoBackup(store, "Before rollback to default"); err != nil {
+		warnBackup(err)
 	}
 
 	// Rollback
-	if err := config.RollbackToDefault(); err != nil {
+	if err := config.RollbackToDefault(store); err != nil {
+		return err
+	}
+	if err := unwireKeyHelper(); err != nil {
 		return err
 	}
 
@@ -240,7 +278,7 @@ func handleRollback() error {
 }
 
 func handleShowConfig() error {
-	cfg, err := config.GetCurrentConfig()
+	cfg, err := config.GetCurrentConfig(store)
 	if err != nil {
 		return err
 	}
@@ -249,6 +287,8 @@ func handleShowConfig() error {
 
 	if cfg.UseFoundry {
 		printSuccess("Status: Azure Foundry ENABLED")
+	} else if cfg.Provider != config.Anthropic {
+		printSuccess("Status: " + cfg.Provider.Title() + " in use (run 'claude-foundry-manager show' for its variables)")
 	} else {
 		printInfo("Status: Azure Foundry DISABLED")
 	}
@@ -270,10 +310,20 @@ func handleShowConfig() error {
 	fmt.Printf("  ANTHROPIC_DEFAULT_HAIKU_MODEL:  %s\n", formatStringValue(cfg.HaikuModel))
 	fmt.Printf("  ANTHROPIC_DEFAULT_OPUS_MODEL:   %s\n", formatStringValue(cfg.OpusModel))
 
-	if !cfg.UseFoundry {
+	if cfg.Provider == config.Anthropic {
 		fmt.Println("\n" + colorCyan + "Note: Using default Anthropic direct API configuration." + colorReset)
 	}
 
+	drift := 0
+	for _, v := range cfg.Vars {
+		if v.Drift() != "" {
+			drift++
+		}
+	}
+	if drift > 0 {
+		printWarning(fmt.Sprintf("\n%d variable(s) differ from this shell. Run 'claude-foundry-manager show' for details.", drift))
+	}
+
 	fmt.Println()
 	return nil
 }
@@ -290,17 +340,35 @@ func handleListBackups() error {
 		return nil
 	}
 
-	fmt.Printf("\n" + colorCyan + colorBold + "=== Available Backups (%d total) ===" + colorReset + "\n\n", len(backups))
+	fmt.Printf("\n"+colorCyan+colorBold+"=== Available Backups (%d total) ==="+colorReset+"\n\n", len(backups))
 
 	for i, b := range backups {
-		fmt.Printf(colorYellow+"[%d]"+colorReset+" %s\n", i+1, b.Filename)
+		if b.Problem != "" {
+			fmt.Printf(colorYellow+"[%d]"+colorReset+" %s\n", i+1, b.Filename)
+			printWarning("    Unreadable: " + b.Problem)
+			fmt.Println()
+			continue
+		}
+		fmt.Printf(colorYellow+"[%d]"+colorReset+" %s", i+1, b.Filename)
+		if b.Manual {
+			fmt.Print(" [manual]")
+		}
+		if b.Pinned {
+			fmt.Print(" [pinned]")
+		}
+		fmt.Println()
 		fmt.Printf("    Created: %s\n", b.Timestamp.Format("2006-01-02 15:04:05"))
 		fmt.Printf("    Description: %s\n", b.Description)
 		if b.UseFoundry {
 			fmt.Printf("    Resource: %s\n", b.Resource)
+		} else if b.Provider != config.Anthropic.Title() {
+			fmt.Printf("    Provider: %s\n", b.Provider)
 		} else {
 			fmt.Printf("    Resource: (default Anthropic)\n")
 		}
+		if b.Secrets != backup.SecretsPlain {
+			fmt.Printf("    Secrets: %s\n", b.Secrets)
+		}
 		fmt.Println()
 	}
 
@@ -309,10 +377,16 @@ func handleListBackups() error {
 }
 
 func handleRestoreBackup() error {
-	backups, err := backup.ListBackups()
+	listed, err := backup.ListBackups()
 	if err != nil {
 		return err
 	}
+	backups := []backup.BackupInfo{}
+	for _, b := range listed {
+		if b.Problem == "" {
+			backups = append(backups, b)
+		}
+	}
 
 	if len(backups) == 0 {
 		printInfo("\nNo backups available to restore.")
@@ -343,24 +417,46 @@ func handleRestoreBackup() error {
 
 	selectedBackup := backups[selection-1]
 
+	// Show the backup and what restoring it changes
+	b, err := backup.LoadBackup(selectedBackup.Filename)
+	if err != nil {
+		return err
+	}
+	changes, err := backup.PreviewRestore(store, selectedBackup.Filename, nil)
+	if err != nil {
+		return err
+	}
+	showBackup(selectedBackup, b)
+	fmt.Println("\n" + colorCyan + "=== Changes on Restore ===" + colorReset)
+	showChanges(changes)
+
 	// Confirm
-	confirm, err := readInput(fmt.Sprintf("\nRestore from '%s'? (y/n): ", selectedBackup.Filename))
+	confirm, err := readInput(fmt.Sprintf("\nRestore from '%s'? (y = restore, d = delete the backup, n = cancel): ", selectedBackup.Filename))
 	if err != nil {
 		return err
 	}
 
-	if !strings.EqualFold(strings.TrimSpace(confirm), "y") {
+	switch strings.ToLower(strings.TrimSpace(confirm)) {
+	case "y":
+	case "d":
+		return deleteBackup(selectedBackup)
+	default:
 		printInfo("Restore cancelled.")
 		return nil
 	}
 
 	// Create backup before restoring
-	if err := backup.CreateAutoBackup("Before restore operation"); err != nil {
-		printWarning(fmt.Sprintf("Failed to create backup: %v", err))
+	backup.ConfirmCommandFunc = confirmBackupCommand
+	if err := backup.CreateRestoreBackup(store, selectedBackup.Filename); err != nil {
+		warnBackup(err)
 	}
 
 	// Restore
-	if err := backup.RestoreBackup(selectedBackup.Filename); err != nil {
+	warnings, err := backup.RestoreBackup(store, selectedBackup.Filename)
+	for _, warning := range warnings {
+		printWarning(warning)
+	}
+	if err != nil {
 		return err
 	}
 
@@ -370,6 +466,125 @@ func handleRestoreBackup() error {
 	return nil
 }
 
+// confirmBackupCommand asks whether to run the command of a cmd: reference
+// in the backup being restored
+func confirmBackupCommand(key, command string) (bool, error) {
+	printWarning(fmt.Sprintf("The backup reads %s from the command:\n  %s", key, command))
+	answer, err := readInput("Run it? (y/n): ")
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(answer, "y"), nil
+}
+
+// showBackup prints the details and variables of a backup, masking secrets
+func showBackup(info backup.BackupInfo, b *backup.Backup) {
+	fmt.Println("\n" + colorCyan + "=== " + info.Filename + " ===" + colorReset)
+	fmt.Printf("  Created:     %s\n", info.Timestamp.Format("2006-01-02 15:04:05"))
+	fmt.Printf("  Description: %s\n", info.Description)
+	fmt.Printf("  Provider:    %s\n", info.Provider)
+	path := "-"
+	for _, e := range b.Entries() {
+		if e.Path != path {
+			path = e.Path
+			if path == "" {
+				fmt.Println("  Variables:")
+			} else {
+				fmt.Printf("  Settings %s:\n", path)
+			}
+		}
+		note := ""
+		if e.Note != "" {
+			note = " [" + e.Note + "]"
+		}
+		fmt.Printf("    %s=%s%s\n", e.Key, e.Value, note)
+	}
+}
+
+// showChanges prints the changes a restore makes, in color
+func showChanges(changes []backup.Change) {
+	if len(changes) == 0 {
+		printInfo("  Nothing changes; the backup matches the current configuration.")
+		return
+	}
+	path := "-"
+	for _, c := range changes {
+		if c.Path != path {
+			path = c.Path
+			if path != "" {
+				fmt.Printf("  Settings %s:\n", path)
+			}
+		}
+		switch c.Change {
+		case backup.ChangeAdded:
+			fmt.Printf("  %s+ %s=%s%s\n", colorGreen, c.Key, c.New, colorReset)
+		case backup.ChangeRemoved:
+			fmt.Printf("  %s- %s=%s%s\n", colorRed, c.Key, c.Old, colorReset)
+		default:
+			fmt.Printf("  %s~ %s: %s -> %s%s\n", colorYellow, c.Key, c.Old, c.New, colorReset)
+		}
+	}
+}
+
+// deleteBackup deletes a backup after a confirmation; pinned backups stay
+func deleteBackup(info backup.BackupInfo) error {
+	if info.Pinned {
+		printWarning(fmt.Sprintf("%s is pinned; unpin it first.", info.Filename))
+		return nil
+	}
+	confirm, err := readInput(fmt.Sprintf("Delete '%s'? (y/n): ", info.Filename))
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(strings.TrimSpace(confirm), "y") {
+		printInfo("Delete cancelled.")
+		return nil
+	}
+	if err := backup.DeleteBackup(info.Filename); err != nil {
+		return fmt.Errorf("failed to delete backup: %w", err)
+	}
+	printSuccess(fmt.Sprintf("✓ Deleted %s", info.Filename))
+	return nil
+}
+
+func handlePruneBackups() error {
+	settings, err := backup.LoadSettings()
+	if err != nil {
+		return err
+	}
+	prunable, err := backup.Prune(true)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("\n" + colorCyan + "=== Prune Old Backups ===" + colorReset)
+	fmt.Printf("Retention: %s (manual and pinned backups are kept)\n", settings.RetentionPolicy())
+	if len(prunable) == 0 {
+		printInfo("\nNothing to prune.")
+		return nil
+	}
+
+	fmt.Println()
+	for _, b := range prunable {
+		fmt.Printf("  %s  %s  %s\n", b.Filename, b.Timestamp.Format("2006-01-02 15:04:05"), b.Description)
+	}
+	confirm, err := readInput(fmt.Sprintf("\nRemove these %d backup(s)? (y/n): ", len(prunable)))
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(strings.TrimSpace(confirm), "y") {
+		printInfo("Prune cancelled.")
+		return nil
+	}
+
+	pruned, err := backup.Prune(false)
+	if err != nil {
+		return err
+	}
+	printSuccess(fmt.Sprintf("\n✓ Removed %d backup(s)", len(pruned)))
+	return nil
+}
+
 func handleCreateBackup() error {
 	fmt.Println("\n" + colorCyan + "=== Create Manual Backup ===" + colorReset)
 
@@ -383,8 +598,11 @@ func handleCreateBackup() error {
 		description = "Manual backup"
 	}
 
-	filename, err := backup.CreateManualBackup(description)
-	if err != nil {
+	filename, err := backup.CreateManualBackup(store, description)
+	var warning *backup.Warning
+	if errors.As(err, &warning) {
+		printWarning(fmt.Sprintf("Backup created, but %v", warning))
+	} else if err != nil {
 		return err
 	}
 
@@ -394,8 +612,86 @@ func handleCreateBackup() error {
 	return nil
 }
 
+func handleUseProfile() error {
+	list, err := profiles.ListProfiles()
+	if err != nil {
+		return err
+	}
+
+	current, _ := store.List()
+
+	fmt.Println("\n" + colorCyan + "=== Select Profile ===" + colorReset)
+	for i, p := range list {
+		name := p.Name
+		if current != nil && p.Matches(current) {
+			name += colorGreen + " (active)" + colorReset
+		}
+		if p.Description != "" {
+			name += " - " + p.Description
+		}
+		fmt.Printf(colorYellow+"[%d]"+colorReset+" %s\n", i+1, name)
+	}
+	if len(list) == 1 {
+		printInfo("\nCreate more profiles with 'claude-foundry-manager profile create <name>'.")
+	}
+
+	input, err := readInput("\nEnter profile number (or 'c' to cancel): ")
+	if err != nil {
+		return err
+	}
+
+	input = strings.TrimSpace(input)
+	if strings.EqualFold(input, "c") {
+		printInfo("Switch cancelled.")
+		return nil
+	}
+
+	var selection int
+	if _, err := fmt.Sscanf(input, "%d", &selection); err != nil || selection < 1 || selection > len(list) {
+		return fmt.Errorf("invalid selection")
+	}
+	selected := list[selection-1]
+
+	// Create backup
+	if err := backup.CreateAutoBackup(store, fmt.Sprintf("Before using profile %s", selected.Name)); err != nil {
+		warnBackup(err)
+	}
+
+	if err := profiles.Apply(store, selected); err != nil {
+		return err
+	}
+	if selected.IsAnthropic() || selected.Foundry.APIKey != "" {
+		if err := unwireKeyHelper(); err != nil {
+			return err
+		}
+	}
+
+	printSuccess(fmt.Sprintf("\n✓ Now using profile: %s", selected.Name))
+	printInfo("\nPlease restart your terminal for the changes to take effect.")
+
+	return nil
+}
+
 // Helper functions
 
+// unwireKeyHelper removes the apiKeyHelper this tool set in the user
+// settings, once the configuration no longer takes the key from it
+func unwireKeyHelper() error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+	helper := config.NewSettingsStore(config.SettingsPath(config.SettingsUser, home, ""))
+	if wired, err := secrets.HelperWired(helper); err != nil || !wired {
+		return err
+	}
+	if err := secrets.UnwireHelper(helper); err != nil {
+		return fmt.Errorf("failed to remove apiKeyHelper: %w", err)
+	}
+	printInfo(fmt.Sprintf("apiKeyHelper removed from %s", helper.Path()))
+	return nil
+}
+
 func readInput(prompt string) (string, error) {
 	fmt.Print(prompt)
 	input, err := reader.ReadString('\n')
@@ -449,6 +745,17 @@ func printWarning(msg string) {
 	fmt.Println(colorYellow + "Warning: " + msg + colorReset)
 }
 
+// warnBackup warns that the automatic backup before a change failed, or
+// of a problem with the backup that was created anyway
+func warnBackup(err error) {
+	var warning *backup.Warning
+	if errors.As(err, &warning) {
+		printWarning(fmt.Sprintf("Backup created, but %v", err))
+		return
+	}
+	printWarning(fmt.Sprintf("Failed to create backup: %v", err))
+}
+
 func printInfo(msg string) {
 	fmt.Println(colorCyan + msg + colorReset)
 }
@@ -0,0 +1,27 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReadPassword asks for a passphrase on stderr without echoing it when
+// stdin is a terminal
+func ReadPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		if restore, err := disableEcho(); err == nil {
+			defer func() {
+				restore()
+				fmt.Fprintln(os.Stderr)
+			}()
+		}
+	}
+
+	input, err := reader.ReadString('\n')
+	if err != nil && input == "" {
+		return "", err
+	}
+	return strings.TrimRight(input, "\r\n"), nil
+}